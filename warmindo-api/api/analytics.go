@@ -0,0 +1,348 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Ways menus and categories can be ranked
+const (
+	RankByRevenue   = "revenue"
+	RankByQuantity  = "quantity"
+	RankByFrequency = "frequency"
+)
+
+// performanceAggregates sums the lines of the report period ($5 to $3) and
+// of the period before it ($2 to the day before $5) side by side
+const performanceAggregates = `
+	SUM(amount) FILTER (WHERE day >= $5::date),
+	SUM(total) FILTER (WHERE day >= $5::date),
+	COUNT(DISTINCT order_code) FILTER (WHERE day >= $5::date),
+	SUM(amount) FILTER (WHERE day < $5::date),
+	SUM(total) FILTER (WHERE day < $5::date),
+	COUNT(DISTINCT order_code) FILTER (WHERE day < $5::date)`
+
+// previousPeriod is the range of the same length that ends the day before from
+func previousPeriod(from, to string) (string, error) {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return "", err
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return "", err
+	}
+	days := int(end.Sub(start).Hours()/24) + 1
+	return start.AddDate(0, 0, -days).Format("2006-01-02"), nil
+}
+
+// percentChange is the change from previous to current in percent, rounded to
+// one decimal, or nil when previous is zero
+func percentChange(current, previous int) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := math.Round(float64(current-previous)/float64(previous)*1000) / 10
+	return &change
+}
+
+func performanceChange(current, previous db.PeriodPerformance) db.PerformanceChange {
+	return db.PerformanceChange{
+		QuantityPct:       percentChange(current.Quantity, previous.Quantity),
+		RevenuePct:        percentChange(current.Revenue, previous.Revenue),
+		OrderFrequencyPct: percentChange(current.OrderFrequency, previous.OrderFrequency),
+	}
+}
+
+// revenueShare is part's share of total in percent, rounded to one decimal
+func revenueShare(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*1000) / 10
+}
+
+// rankMetric is the figure a ranking sorts on
+func rankMetric(p db.PeriodPerformance, by string) int {
+	switch by {
+	case RankByQuantity:
+		return p.Quantity
+	case RankByFrequency:
+		return p.OrderFrequency
+	default:
+		return p.Revenue
+	}
+}
+
+// menuAnalytics is the menu performance report of an outlet
+type menuAnalytics struct {
+	PreviousFrom   string                   `json:"previous_from"`
+	Sort           string                   `json:"sort"`
+	Totals         db.PeriodPerformance     `json:"totals"`
+	PreviousTotals db.PeriodPerformance     `json:"previous_totals"`
+	Menus          []db.MenuPerformance     `json:"menus"`
+	Categories     []db.CategoryPerformance `json:"categories"`
+	Heatmap        *db.SalesHeatmap         `json:"heatmap"`
+}
+
+// GetMenuAnalytics ranks the current outlet's menus and categories by
+// revenue, quantity or order frequency (?sort=) over ?from=&to=, compares
+// them with the period of the same length just before, and spreads the
+// period's sales over a weekday by hour heatmap (?menu_id= for one menu).
+// Menus that sold nothing are listed too, at the bottom. ?format= exports it
+// as a file.
+func GetMenuAnalytics(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+	from, to, err := reportRange(c, dbConn, outletID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	sortBy := c.Query("sort", RankByRevenue)
+	if sortBy != RankByRevenue && sortBy != RankByQuantity && sortBy != RankByFrequency {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort harus revenue, quantity atau frequency"})
+	}
+	previousFrom, err := previousPeriod(from, to)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	args := []interface{}{outletID, previousFrom, to, db.StatusPaid, from}
+
+	report := menuAnalytics{PreviousFrom: previousFrom, Sort: sortBy}
+	report.Menus, err = menuPerformance(dbConn, args)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	report.Categories, err = categoryPerformance(dbConn, args)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	report.rank()
+
+	report.Heatmap, err = salesHeatmap(dbConn, outletID, from, to, c.QueryInt("menu_id", 0))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		return sendExport(c, format, "performa-menu-"+from+"-"+to, "Performa Menu "+periodLabel(from, to), report.export)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":         true,
+		"outlet_id":       outletID,
+		"from":            from,
+		"to":              to,
+		"previous_from":   report.PreviousFrom,
+		"sort":            report.Sort,
+		"totals":          report.Totals,
+		"previous_totals": report.PreviousTotals,
+		"menus":           report.Menus,
+		"categories":      report.Categories,
+		"heatmap":         report.Heatmap,
+	})
+}
+
+// rank works out the totals and revenue shares and orders menus and
+// categories by the report's sort
+func (r *menuAnalytics) rank() {
+	for _, m := range r.Menus {
+		r.Totals.Quantity += m.Quantity
+		r.Totals.Revenue += m.Revenue
+		r.PreviousTotals.Quantity += m.Previous.Quantity
+		r.PreviousTotals.Revenue += m.Previous.Revenue
+	}
+	for i := range r.Menus {
+		r.Menus[i].RevenueShare = revenueShare(r.Menus[i].Revenue, r.Totals.Revenue)
+	}
+	for i := range r.Categories {
+		r.Categories[i].RevenueShare = revenueShare(r.Categories[i].Revenue, r.Totals.Revenue)
+	}
+
+	menus, categories := r.Menus, r.Categories
+	sort.SliceStable(menus, func(i, j int) bool {
+		a, b := rankMetric(menus[i].PeriodPerformance, r.Sort), rankMetric(menus[j].PeriodPerformance, r.Sort)
+		if a != b {
+			return a > b
+		}
+		return menus[i].MenuName < menus[j].MenuName
+	})
+	for i := range menus {
+		menus[i].Rank = i + 1
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		a, b := rankMetric(categories[i].PeriodPerformance, r.Sort), rankMetric(categories[j].PeriodPerformance, r.Sort)
+		if a != b {
+			return a > b
+		}
+		return categories[i].CategoryName < categories[j].CategoryName
+	})
+	for i := range categories {
+		categories[i].Rank = i + 1
+	}
+}
+
+var performanceColumns = []string{"Jumlah", "Pendapatan", "Frekuensi", "Porsi pendapatan (%)",
+	"Jumlah sebelumnya", "Pendapatan sebelumnya", "Frekuensi sebelumnya",
+	"Perubahan jumlah (%)", "Perubahan pendapatan (%)", "Perubahan frekuensi (%)"}
+
+func performanceCells(p, previous db.PeriodPerformance, share float64, change db.PerformanceChange) []interface{} {
+	return []interface{}{p.Quantity, p.Revenue, p.OrderFrequency, share,
+		previous.Quantity, previous.Revenue, previous.OrderFrequency,
+		change.QuantityPct, change.RevenuePct, change.OrderFrequencyPct}
+}
+
+func (r *menuAnalytics) export(w export.Writer) error {
+	if err := w.Section("Menu", append([]string{"Peringkat", "Menu", "Kategori"}, performanceColumns...)); err != nil {
+		return err
+	}
+	for _, m := range r.Menus {
+		cells := append([]interface{}{m.Rank, m.MenuName, m.CategoryName}, performanceCells(m.PeriodPerformance, m.Previous, m.RevenueShare, m.Change)...)
+		if err := w.Row(cells...); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Section("Kategori", append([]string{"Peringkat", "Kategori"}, performanceColumns...)); err != nil {
+		return err
+	}
+	for _, cat := range r.Categories {
+		cells := append([]interface{}{cat.Rank, cat.CategoryName}, performanceCells(cat.PeriodPerformance, cat.Previous, cat.RevenueShare, cat.Change)...)
+		if err := w.Row(cells...); err != nil {
+			return err
+		}
+	}
+
+	// The heatmap as a weekday by hour table of quantities
+	columns := []string{"Hari"}
+	for hour := 0; hour < 24; hour++ {
+		columns = append(columns, fmt.Sprintf("%02d", hour))
+	}
+	if err := w.Section("Jumlah per jam", columns); err != nil {
+		return err
+	}
+	for day, hours := range r.Heatmap.Quantity {
+		cells := []interface{}{utils.DayName(time.Weekday(day))}
+		for _, quantity := range hours {
+			cells = append(cells, quantity)
+		}
+		if err := w.Row(cells...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func menuPerformance(dbConn *sql.DB, args []interface{}) ([]db.MenuPerformance, error) {
+	rows, err := dbConn.Query(db.SalesLinesQuery+`,
+	performance AS (
+		SELECT menu_id, `+performanceAggregates+`
+		FROM lines
+		WHERE day BETWEEN $2::date AND $3::date
+		GROUP BY menu_id
+	)
+	SELECT m.id, m.name, c.id, c.name, p.*
+	FROM menus m
+	JOIN categories c ON c.id = m.category_id
+	LEFT JOIN performance p ON p.menu_id = m.id
+	WHERE m.deleted IS NOT TRUE OR p.menu_id IS NOT NULL`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	menus := []db.MenuPerformance{}
+	for rows.Next() {
+		var m db.MenuPerformance
+		var menuID sql.NullInt64
+		var figures [6]sql.NullInt64
+		if err := rows.Scan(&m.MenuID, &m.MenuName, &m.CategoryID, &m.CategoryName, &menuID,
+			&figures[0], &figures[1], &figures[2], &figures[3], &figures[4], &figures[5]); err != nil {
+			return nil, err
+		}
+		m.PeriodPerformance, m.Previous = periodFigures(figures)
+		m.Change = performanceChange(m.PeriodPerformance, m.Previous)
+		menus = append(menus, m)
+	}
+	return menus, rows.Err()
+}
+
+func categoryPerformance(dbConn *sql.DB, args []interface{}) ([]db.CategoryPerformance, error) {
+	rows, err := dbConn.Query(db.SalesLinesQuery+`,
+	performance AS (
+		SELECT category_id, `+performanceAggregates+`
+		FROM lines
+		WHERE day BETWEEN $2::date AND $3::date
+		GROUP BY category_id
+	)
+	SELECT c.id, c.name, p.*
+	FROM categories c
+	LEFT JOIN performance p ON p.category_id = c.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []db.CategoryPerformance{}
+	for rows.Next() {
+		var cat db.CategoryPerformance
+		var categoryID sql.NullInt64
+		var figures [6]sql.NullInt64
+		if err := rows.Scan(&cat.CategoryID, &cat.CategoryName, &categoryID,
+			&figures[0], &figures[1], &figures[2], &figures[3], &figures[4], &figures[5]); err != nil {
+			return nil, err
+		}
+		cat.PeriodPerformance, cat.Previous = periodFigures(figures)
+		cat.Change = performanceChange(cat.PeriodPerformance, cat.Previous)
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// periodFigures splits the columns of performanceAggregates, which are NULL
+// for menus and categories without sales, into the two periods
+func periodFigures(f [6]sql.NullInt64) (db.PeriodPerformance, db.PeriodPerformance) {
+	current := db.PeriodPerformance{Quantity: int(f[0].Int64), Revenue: int(f[1].Int64), OrderFrequency: int(f[2].Int64)}
+	previous := db.PeriodPerformance{Quantity: int(f[3].Int64), Revenue: int(f[4].Int64), OrderFrequency: int(f[5].Int64)}
+	return current, previous
+}
+
+// salesHeatmap spreads an outlet's sales from from to to over weekdays and
+// hours, for one menu when menuID isn't 0
+func salesHeatmap(dbConn *sql.DB, outletID int, from, to string, menuID int) (*db.SalesHeatmap, error) {
+	rows, err := dbConn.Query(db.SalesLinesQuery+`
+	SELECT EXTRACT(DOW FROM local_at)::int, EXTRACT(HOUR FROM local_at)::int,
+	       SUM(amount), SUM(total), COUNT(DISTINCT order_code)
+	FROM lines
+	WHERE day BETWEEN $2::date AND $3::date
+	  AND ($5 = 0 OR menu_id = $5)
+	GROUP BY 1, 2`, outletID, from, to, db.StatusPaid, menuID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heatmap db.SalesHeatmap
+	for rows.Next() {
+		var weekday, hour, quantity, revenue, orderCodes int
+		if err := rows.Scan(&weekday, &hour, &quantity, &revenue, &orderCodes); err != nil {
+			return nil, err
+		}
+		heatmap.Quantity[weekday][hour] = quantity
+		heatmap.Revenue[weekday][hour] = revenue
+		heatmap.OrderCodes[weekday][hour] = orderCodes
+	}
+	return &heatmap, rows.Err()
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RefreshTokenTTL is how long a refresh token can be exchanged. Every exchange
+// rotates it, so an active client stays signed in indefinitely.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// issueTokens starts a login session for the user in an outlet and returns the
+// access and refresh tokens for the response body.
+func issueTokens(c *fiber.Ctx, dbConn *sql.DB, user *db.User, outletID int) (fiber.Map, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sessionID, err := db.CreateAuthSession(tx, user.ID, truncate(c.Get(fiber.HeaderUserAgent), 255), c.IP(), 0, outletID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.CreateRefreshToken(tx, sessionID, utils.HashToken(refreshToken), time.Now().Add(RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := middleware.GenerateJWT(strconv.Itoa(user.ID), user.RoleID, sessionID, outletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(middleware.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Presenting an already used refresh token revokes the whole
+// session, since it means the token was copied.
+func RefreshToken(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Permintaan tidak valid"}})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	defer tx.Rollback()
+
+	var tokenID, sessionID, staffID, roleID, outletID int
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(`
+	SELECT rt.id, rt.session_id, rt.expires_at, rt.used_at, s.revoked_at, s.staff_id, st.role_id, s.outlet_id
+	FROM refresh_tokens rt
+	JOIN auth_sessions s ON s.id = rt.session_id
+	JOIN staffs st ON st.id = s.staff_id
+	WHERE rt.token_hash = $1
+	FOR UPDATE OF rt, s`, utils.HashToken(req.RefreshToken)).Scan(&tokenID, &sessionID, &expiresAt, &usedAt, &revokedAt, &staffID, &roleID, &outletID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Refresh token tidak valid"}})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	if usedAt.Valid {
+		if err := db.RevokeAuthSession(tx, sessionID); err == nil {
+			tx.Commit()
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Refresh token sudah digunakan, sesi dicabut"}})
+	}
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Sesi telah berakhir"}})
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if _, err := tx.Exec("UPDATE auth_sessions SET last_used_at = NOW() WHERE id = $1", sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan dalam menghasilkan token"}})
+	}
+	if err := db.CreateRefreshToken(tx, sessionID, utils.HashToken(refreshToken), time.Now().Add(RefreshTokenTTL)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	accessToken, err := middleware.GenerateJWT(strconv.Itoa(staffID), roleID, sessionID, outletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan dalam menghasilkan token"}})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":       true,
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(middleware.AccessTokenTTL.Seconds()),
+	})
+}
+
+// Logout revokes the session of the access token used for the request
+func Logout(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	if err := db.RevokeAuthSession(dbConn, identity.SessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal keluar dari sesi"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Berhasil keluar"})
+}
+
+// LogoutAll revokes every session of the current user, on all devices
+func LogoutAll(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	if err := db.RevokeStaffSessions(dbConn, identity.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal keluar dari semua sesi"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Berhasil keluar dari semua perangkat"})
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"warmindo-api/db"
 
+	"warmindo-api/middleware"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -12,10 +14,31 @@ func SetupCategoryRoutes(app *fiber.App, dbConn *sql.DB) {
 	categoryAPI.Get("/", func(c *fiber.Ctx) error {
 		return GetCategories(c, dbConn)
 	})
+
+	// Protected endpoints
+	canWrite := middleware.RequirePermission(dbConn, db.PermissionCategoriesWrite)
+	categoryAPI.Delete("/:id", canWrite, func(c *fiber.Ctx) error {
+		return DeleteCategory(c, dbConn)
+	})
+	categoryAPI.Get("/:id/translations", canWrite, func(c *fiber.Ctx) error {
+		return GetCategoryTranslations(c, dbConn)
+	})
+	categoryAPI.Put("/:id/translations/:lang", canWrite, func(c *fiber.Ctx) error {
+		return UpsertCategoryTranslation(c, dbConn)
+	})
+	categoryAPI.Delete("/:id/translations/:lang", canWrite, func(c *fiber.Ctx) error {
+		return DeleteCategoryTranslation(c, dbConn)
+	})
 }
 
 func GetCategories(c *fiber.Ctx, dbConn *sql.DB) error {
-	rows, err := dbConn.Query("SELECT id, name, created_at, updated_at FROM categories")
+	lang := requestLanguage(c)
+
+	rows, err := dbConn.Query(`
+	SELECT c.id, COALESCE(t.name, c.name), c.created_at, c.updated_at
+	FROM categories c
+	LEFT JOIN category_translations t ON t.category_id = c.id AND t.language = $1
+	WHERE c.deleted_at IS NULL`, lang)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -27,8 +50,94 @@ func GetCategories(c *fiber.Ctx, dbConn *sql.DB) error {
 		if err := rows.Scan(&category.ID, &category.Name, &category.CreatedAt, &category.UpdatedAt); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		category.Language = lang
 		categories = append(categories, category)
 	}
 
-	return c.JSON(fiber.Map{"success": true, "categories": categories})
+	return c.JSON(fiber.Map{"success": true, "language": lang, "categories": categories})
+}
+
+// DeleteCategory moves a category to the trash. Menus still listed under it
+// have to be moved or deleted first.
+func DeleteCategory(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID kategori tidak valid"})
+	}
+
+	var inUse bool
+	if err := dbConn.QueryRow("SELECT EXISTS (SELECT 1 FROM menus WHERE category_id = $1 AND deleted_at IS NULL)", id).Scan(&inUse); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if inUse {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Kategori masih dipakai oleh menu"})
+	}
+
+	result, err := dbConn.Exec("UPDATE categories SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL", id, middleware.CurrentIdentity(c).UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kategori tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetCategoryTranslations lists every stored translation of a category
+func GetCategoryTranslations(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query("SELECT language, name FROM category_translations WHERE category_id = $1 ORDER BY language", c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	translations := []db.CategoryTranslation{}
+	for rows.Next() {
+		var translation db.CategoryTranslation
+		if err := rows.Scan(&translation.Language, &translation.Name); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		translations = append(translations, translation)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "translations": translations})
+}
+
+// UpsertCategoryTranslation creates or replaces the translation of a category for one language
+func UpsertCategoryTranslation(c *fiber.Ctx, dbConn *sql.DB) error {
+	var translation db.CategoryTranslation
+	if err := c.BodyParser(&translation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	translation.Language = normalizeLanguage(c.Params("lang"))
+
+	if !db.IsSupportedLanguage(translation.Language) || translation.Language == db.DefaultLanguage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bahasa tidak didukung: " + translation.Language})
+	}
+	if translation.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nama terjemahan wajib diisi"})
+	}
+
+	_, err := dbConn.Exec(`
+	INSERT INTO category_translations (category_id, language, name)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (category_id, language)
+	DO UPDATE SET name = EXCLUDED.name, updated_at = NOW()`,
+		c.Params("id"), translation.Language, translation.Name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "translation": translation})
+}
+
+// DeleteCategoryTranslation removes a translation so the category falls back to the default language
+func DeleteCategoryTranslation(c *fiber.Ctx, dbConn *sql.DB) error {
+	_, err := dbConn.Exec("DELETE FROM category_translations WHERE category_id = $1 AND language = $2", c.Params("id"), normalizeLanguage(c.Params("lang")))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
 }
@@ -2,30 +2,34 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"math"
-	"math/rand"
-	"time"
+	"log"
 	"warmindo-api/db"
+	"warmindo-api/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 )
 
-const EarthRadiusKm = 6371 // Earth's radius in kilometers
-
 // SetupCustomerRoutes sets up the routes for customer-related operations
 func SetupCustomerRoutes(app *fiber.App, dbConn *sql.DB) {
+	// Public endpoints used by diners before they have an order code. They
+	// are rate limited per IP; opening a session gets the tightest limit.
+	createLimit := customerRateLimit(SessionCreateLimit, CustomerLimitWindow)
+	checkLimit := customerRateLimit(CustomerCheckLimit, CustomerLimitWindow)
+
 	customerAPI := app.Group("/api/customer")
 
-	customerAPI.Post("/check-radius", func(c *fiber.Ctx) error {
+	customerAPI.Post("/check-radius", createLimit, func(c *fiber.Ctx) error {
 		return CheckLocationAndGenerateOrderCode(c, dbConn)
 	})
 
-	customerAPI.Post("/check-code", func(c *fiber.Ctx) error {
+	customerAPI.Post("/check-code", checkLimit, func(c *fiber.Ctx) error {
 		return CheckOrderCodeAndTableNumber(c, dbConn)
 	})
 	// New endpoint to check if a table has an active order
-	customerAPI.Post("/check-active", func(c *fiber.Ctx) error {
+	customerAPI.Post("/check-active", checkLimit, func(c *fiber.Ctx) error {
 		return CheckActiveOrder(c, dbConn)
 	})
 }
@@ -41,60 +45,56 @@ func CheckActiveOrder(c *fiber.Ctx, dbConn *sql.DB) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": false, "error": "Body permintaan tidak valid"})
 	}
 
-	// Check if the active field for the table_number is true
+	// Look the session up by its code alone: staff may have moved it to
+	// another table since the diner scanned the QR code
 	var active bool
-	err := dbConn.QueryRow("SELECT active FROM customers WHERE order_code = $1 AND table_number = $2 ORDER BY start_date ASC LIMIT 1", req.OrderCode, req.TableNumber).Scan(&active)
+	tableNumber := req.TableNumber
+	err := dbConn.QueryRow("SELECT active, table_number FROM customers WHERE order_code = $1 ORDER BY start_date ASC LIMIT 1", req.OrderCode).Scan(&active, &tableNumber)
 	if err != nil && err != sql.ErrNoRows {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal memeriksa status aktif"})
 	}
 
-	return c.JSON(fiber.Map{"status": true, "table_number": req.TableNumber, "active": active})
+	return c.JSON(fiber.Map{"status": true, "table_number": tableNumber, "active": active})
 }
 
-// isWithinRadius calculates if a location is within a specified radius using the Haversine formula
-func isWithinRadius(lat1, lon1, lat2, lon2, radius float64) bool {
-	dLat := degreesToRadians(lat2 - lat1)
-	dLon := degreesToRadians(lon2 - lon1)
+// errTableOccupied means the table already had an open session
+var errTableOccupied = errors.New("table already has an active session")
 
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(degreesToRadians(lat1))*math.Cos(degreesToRadians(lat2))*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+// OrderCodeAttempts bounds the retries when a fresh order code collides with
+// an existing one
+const OrderCodeAttempts = 5
 
-	distance := EarthRadiusKm * c
-	return distance <= radius
-}
-
-func degreesToRadians(degrees float64) float64 {
-	return degrees * math.Pi / 180
-}
+// createCustomerSession opens a session on an outlet's table with a random order code
+// and returns the code together with the customer access token. openedBy is
+// the staff member who opened it for the diner, 0 when the diner did. The
+// unique constraint on order_code settles collisions; the partial unique
+// index on active sessions settles two diners racing for the same table.
+func createCustomerSession(dbConn *sql.DB, outletID, tableNumber, openedBy int) (string, string, error) {
+	accessToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", "", err
+	}
 
-// Generate a unique order code
-func generateUniqueOrderCode(dbConn *sql.DB) (string, error) {
-	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	const digits = "0123456789"
-	rand.Seed(time.Now().UnixNano())
-
-	for {
-		orderCode := fmt.Sprintf("%c%c%c%c-%d%d",
-			letters[rand.Intn(len(letters))],
-			letters[rand.Intn(len(letters))],
-			letters[rand.Intn(len(letters))],
-			letters[rand.Intn(len(letters))],
-			digits[rand.Intn(len(digits))],
-			digits[rand.Intn(len(digits))],
-		)
-
-		// Check if the order code already exists
-		var count int
-		err := dbConn.QueryRow("SELECT COUNT(*) FROM customers WHERE order_code = $1", orderCode).Scan(&count)
+	for attempt := 0; attempt < OrderCodeAttempts; attempt++ {
+		orderCode, err := utils.GenerateOrderCode()
 		if err != nil {
-			return "", err
+			return "", "", err
+		}
+
+		_, err = dbConn.Exec("INSERT INTO customers (order_code, outlet_id, table_number, access_token_hash, opened_by, start_date, active) VALUES ($1, $2, $3, $4, NULLIF($5, 0), NOW(), true)",
+			orderCode, outletID, tableNumber, utils.HashToken(accessToken), openedBy)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			if pqErr.Constraint == db.CustomerOrderCodeConstraint {
+				continue
+			}
+			return "", "", errTableOccupied
 		}
-		if count == 0 {
-			return orderCode, nil
+		if err != nil {
+			return "", "", err
 		}
+		return orderCode, accessToken, nil
 	}
+	return "", "", fmt.Errorf("no free order code after %d attempts", OrderCodeAttempts)
 }
 
 // CheckLocationAndGenerateOrderCode handles checking the location and generating an order code
@@ -102,50 +102,78 @@ func CheckLocationAndGenerateOrderCode(c *fiber.Ctx, dbConn *sql.DB) error {
 	var req struct {
 		Latitude    float64 `json:"latitude"`
 		Longitude   float64 `json:"longitude"`
-		TableNumber int     `json:"table_number"`
+		Accuracy    float64 `json:"accuracy"`
+		TableToken  string  `json:"table_token"`
+		TableNumber int     `json:"-"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": false, "error": "Body permintaan tidak valid"})
 	}
 
-	// Get settings from the database
-	var settings db.Settings
-	err := dbConn.QueryRow("SELECT latitude, longitude, radius FROM settings WHERE id = 1").Scan(&settings.Latitude, &settings.Longitude, &settings.Radius)
+	// The table, and with it the outlet, comes from the signed token in the
+	// table's QR code, never from a number the client picks
+	tableID, err := utils.VerifyTableToken(req.TableToken)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal mengambil pengaturan"})
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "QR meja tidak valid, silakan pindai ulang"})
 	}
 
-	// Check if the location is within the radius
-	if !isWithinRadius(req.Latitude, req.Longitude, settings.Latitude, settings.Longitude, settings.Radius) {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "Lokasi berada di luar radius"})
+	table, err := db.GetTableByID(dbConn, tableID)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal memeriksa meja"})
+	}
+	if err == sql.ErrNoRows || !table.Active {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "Meja tidak ditemukan atau tidak aktif"})
+	}
+	req.TableNumber = table.Number
+
+	// No new sessions while the outlet is closed
+	store, err := storeStatus(dbConn, table.OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal memeriksa jam buka"})
+	}
+	if !store.Open {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "closed": true, "error": store.Message, "store": store})
+	}
+
+	// Check that the diner is inside one of the outlet's geofences
+	if _, err := locateDiner(dbConn, table.OutletID, db.GeoPoint{Lat: req.Latitude, Lng: req.Longitude}, req.Accuracy); err != nil {
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			return c.Status(fiberErr.Code).JSON(fiber.Map{"status": false, "error": fiberErr.Message})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal memeriksa lokasi"})
 	}
 
 	// Check if the active field for the table_number is true
 	var active bool
-	err = dbConn.QueryRow("SELECT active FROM customers WHERE table_number = $1 ORDER BY start_date DESC LIMIT 1", req.TableNumber).Scan(&active)
+	err = dbConn.QueryRow("SELECT active FROM customers WHERE outlet_id = $1 AND table_number = $2 ORDER BY start_date DESC LIMIT 1", table.OutletID, req.TableNumber).Scan(&active)
 	if err != nil && err != sql.ErrNoRows {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal memeriksa status aktif"})
 	}
-	fmt.Print(active)
 	if active {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "Meja sudah memiliki kode pesanan aktif"})
 	}
 
-	// Generate a unique order code
-	orderCode, err := generateUniqueOrderCode(dbConn)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal membuat kode pesanan"})
+	orderCode, accessToken, err := createCustomerSession(dbConn, table.OutletID, req.TableNumber, 0)
+	if err == errTableOccupied {
+		// Another diner opened a session on this table at the same moment
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "Meja sudah memiliki kode pesanan aktif"})
 	}
-
-	// Insert into the database
-	_, err = dbConn.Exec("INSERT INTO customers (order_code, table_number, start_date, active) VALUES ($1, $2, NOW(), true)", orderCode, req.TableNumber)
 	if err != nil {
-		fmt.Print(err)
+		log.Printf("create customer session for table %d: %v", req.TableNumber, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Gagal menyimpan kode pesanan"})
 	}
 
-	return c.JSON(fiber.Map{"status": true, "order_code": orderCode})
+	// The access token is shown only here; the diner's device keeps it and
+	// sends it as X-Customer-Token to read and place the session's orders
+	return c.JSON(fiber.Map{
+		"status":       true,
+		"order_code":   orderCode,
+		"access_token": accessToken,
+		"table_number": req.TableNumber,
+		"table_label":  table.Label,
+		"outlet_id":    table.OutletID,
+	})
 }
 
 // CheckOrderCodeAndTableNumber handles checking the status of an order code and table number
@@ -159,9 +187,14 @@ func CheckOrderCodeAndTableNumber(c *fiber.Ctx, dbConn *sql.DB) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": false, "error": "Body permintaan tidak valid"})
 	}
 
-	// Check if the provided order code and table number are valid and get the end date
+	// Check if the order code is valid and get the end date. The table
+	// number returned is the session's current one, which differs from the
+	// request after a transfer; merged_into is set once the session has been
+	// merged into another table's order.
 	var endDate sql.NullTime
-	err := dbConn.QueryRow("SELECT end_date FROM customers WHERE order_code = $1 AND table_number = $2", req.OrderCode, req.TableNumber).Scan(&endDate)
+	var tableNumber int
+	var mergedInto string
+	err := dbConn.QueryRow("SELECT end_date, table_number, COALESCE(merged_into, '') FROM customers WHERE order_code = $1", req.OrderCode).Scan(&endDate, &tableNumber, &mergedInto)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": false, "error": "Kode pesanan atau nomor meja tidak ditemukan"})
@@ -172,5 +205,12 @@ func CheckOrderCodeAndTableNumber(c *fiber.Ctx, dbConn *sql.DB) error {
 	// Determine the status based on end_date
 	orderStatus := !endDate.Valid // true if end_date is empty, false otherwise
 
-	return c.JSON(fiber.Map{"status": true, "order_status": orderStatus, "table_number": req.TableNumber, "end_date": endDate.Time})
+	return c.JSON(fiber.Map{
+		"status":       true,
+		"order_status": orderStatus,
+		"table_number": tableNumber,
+		"moved":        tableNumber != req.TableNumber,
+		"merged_into":  mergedInto,
+		"end_date":     endDate.Time,
+	})
 }
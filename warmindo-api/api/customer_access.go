@@ -0,0 +1,80 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// Limits on the public customer endpoints, per client IP
+const (
+	SessionCreateLimit  = 10
+	CustomerCheckLimit  = 60
+	CustomerLimitWindow = time.Minute
+)
+
+// customerOrStaff lets a request through when it carries the customer access
+// token of its order code's session in X-Customer-Token, or a staff token with
+// permission. The order code alone is no longer enough to read or add to an
+// order. orderCode picks the code out of the request.
+func customerOrStaff(dbConn *sql.DB, permission string, orderCode func(*fiber.Ctx) string) fiber.Handler {
+	staff := middleware.RequirePermission(dbConn, permission)
+
+	return func(c *fiber.Ctx) error {
+		token := c.Get("X-Customer-Token")
+		if token == "" {
+			if c.Get(fiber.HeaderAuthorization) != "" {
+				return staff(c)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": false, "error": "Token pelanggan diperlukan"})
+		}
+
+		var ok bool
+		if err := dbConn.QueryRow(db.CustomerAccessQuery, utils.HashToken(token), orderCode(c)).Scan(&ok); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Kesalahan database"})
+		}
+		if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "Token pelanggan tidak valid untuk kode pesanan ini"})
+		}
+		return c.Next()
+	}
+}
+
+// paramOrderCode reads the order code from the :order_code route param
+func paramOrderCode(c *fiber.Ctx) string {
+	return c.Params("order_code")
+}
+
+// bodyOrderCode reads the order code from an order_code field in the body
+func bodyOrderCode(c *fiber.Ctx) string {
+	var body struct {
+		OrderCode string `json:"order_code"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return ""
+	}
+	return body.OrderCode
+}
+
+// customerRateLimit limits a public customer endpoint to max requests per
+// window for each client IP
+func customerRateLimit(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:               max,
+		Expiration:        window,
+		LimiterMiddleware: limiter.SlidingWindow{},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(window.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"status": false, "error": "Terlalu banyak permintaan, silakan coba lagi nanti"})
+		},
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strings"
+	"warmindo-api/export"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportFormat reads ?format=. An empty format, or json, means the usual
+// JSON response.
+func exportFormat(c *fiber.Ctx) (string, error) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" || format == "json" {
+		return "", nil
+	}
+	if !export.IsFormat(format) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "format harus json, "+strings.Join(export.Formats, ", "))
+	}
+	return format, nil
+}
+
+// sendExport streams a file download. write runs after the handler has
+// returned, while the response body is sent, so it must not touch c. An
+// error at that point can only cut the download short and is logged.
+func sendExport(c *fiber.Ctx, format, filename, title string, write func(export.Writer) error) error {
+	filename = export.Filename(filename, format)
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ew, err := export.NewWriter(format, w, title)
+		if err == nil {
+			err = write(ew)
+		}
+		if err == nil {
+			err = ew.Close()
+		}
+		if err != nil {
+			log.Printf("export %s: %v", filename, err)
+		}
+	})
+	return nil
+}
+
+// periodLabel is from, or from–to when the range covers more than one day
+func periodLabel(from, to string) string {
+	if from == to {
+		return from
+	}
+	return from + " s.d. " + to
+}
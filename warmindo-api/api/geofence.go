@@ -0,0 +1,290 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxGPSAccuracyMeters is the worst reported GPS accuracy still accepted.
+// Vaguer fixes are turned away rather than trusted to be where they say.
+const MaxGPSAccuracyMeters = 150
+
+// SetupGeofenceRoutes sets up the admin endpoints for the areas diners must be in
+func SetupGeofenceRoutes(app *fiber.App, dbConn *sql.DB) {
+	canRead := middleware.RequirePermission(dbConn, db.PermissionSettingsRead)
+	canWrite := middleware.RequirePermission(dbConn, db.PermissionSettingsWrite)
+
+	geofenceAPI := app.Group("/api/geofences")
+	geofenceAPI.Get("/", canRead, func(c *fiber.Ctx) error {
+		return GetGeofences(c, dbConn)
+	})
+	geofenceAPI.Post("/check", canRead, func(c *fiber.Ctx) error {
+		return CheckGeofence(c, dbConn)
+	})
+	geofenceAPI.Post("/", canWrite, func(c *fiber.Ctx) error {
+		return CreateGeofence(c, dbConn)
+	})
+	geofenceAPI.Put("/:id", canWrite, func(c *fiber.Ctx) error {
+		return UpdateGeofence(c, dbConn)
+	})
+	geofenceAPI.Delete("/:id", canWrite, func(c *fiber.Ctx) error {
+		return DeleteGeofence(c, dbConn)
+	})
+}
+
+// getGeofences loads an outlet's geofences, only the active ones when activeOnly is set
+func getGeofences(dbConn *sql.DB, outletID int, activeOnly bool) ([]db.Geofence, error) {
+	query := db.GetGeofencesQuery + " WHERE outlet_id = $1"
+	if activeOnly {
+		query += " AND active = true"
+	}
+	query += " ORDER BY id"
+
+	rows, err := dbConn.Query(query, outletID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	geofences := []db.Geofence{}
+	for rows.Next() {
+		var g db.Geofence
+		var polygon string
+		if err := rows.Scan(&g.ID, &g.OutletID, &g.Name, &g.Kind, &g.Latitude, &g.Longitude, &g.Radius, &g.RadiusUnit,
+			&polygon, &g.Active, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if polygon != "" {
+			if err := json.Unmarshal([]byte(polygon), &g.Polygon); err != nil {
+				return nil, err
+			}
+		}
+		geofences = append(geofences, g)
+	}
+	return geofences, rows.Err()
+}
+
+// geofenceDistance is how far p is outside g in metres, 0 when inside
+func geofenceDistance(g db.Geofence, p db.GeoPoint) float64 {
+	if g.Kind == db.GeofencePolygon {
+		return utils.DistanceToPolygonMeters(p, g.Polygon)
+	}
+	center := db.GeoPoint{Lat: g.Latitude, Lng: g.Longitude}
+	return math.Max(0, utils.DistanceMeters(p, center)-g.RadiusMeters())
+}
+
+// locateDiner finds the outlet geofence a diner is in. The reported point has
+// to be inside it; accuracy, the radius in metres reported with the GPS fix
+// (0 when the client doesn't send it), only rejects fixes too imprecise to
+// go by. Without active geofences the outlet's legacy settings circle, in
+// kilometres, is used.
+func locateDiner(dbConn *sql.DB, outletID int, p db.GeoPoint, accuracy float64) (*db.Geofence, error) {
+	if !validCoordinate(p) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Koordinat lokasi tidak valid")
+	}
+	if accuracy < 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Akurasi lokasi tidak valid")
+	}
+	if accuracy > MaxGPSAccuracyMeters {
+		return nil, fiber.NewError(fiber.StatusUnprocessableEntity, "Akurasi lokasi terlalu rendah, aktifkan GPS lalu coba lagi")
+	}
+
+	geofences, err := getGeofences(dbConn, outletID, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(geofences) == 0 {
+		legacy := db.Geofence{OutletID: outletID, Name: "settings", Kind: db.GeofenceCircle, RadiusUnit: db.UnitKilometers}
+		err := dbConn.QueryRow("SELECT latitude, longitude, radius FROM settings WHERE outlet_id = $1", outletID).Scan(&legacy.Latitude, &legacy.Longitude, &legacy.Radius)
+		if err != nil {
+			return nil, err
+		}
+		geofences = append(geofences, legacy)
+	}
+
+	for i := range geofences {
+		if geofenceDistance(geofences[i], p) == 0 {
+			return &geofences[i], nil
+		}
+	}
+	return nil, fiber.NewError(fiber.StatusForbidden, "Lokasi berada di luar radius")
+}
+
+func validCoordinate(p db.GeoPoint) bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// validateGeofence checks a geofence and clears the fields its kind doesn't use
+func validateGeofence(g *db.Geofence) []string {
+	errs := []string{}
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		errs = append(errs, "Nama geofence wajib diisi")
+	}
+
+	switch g.Kind {
+	case db.GeofenceCircle:
+		if !validCoordinate(db.GeoPoint{Lat: g.Latitude, Lng: g.Longitude}) {
+			errs = append(errs, "Koordinat pusat tidak valid")
+		}
+		if g.Radius <= 0 {
+			errs = append(errs, "Radius harus lebih dari 0")
+		}
+		if g.RadiusUnit != db.UnitMeters && g.RadiusUnit != db.UnitKilometers {
+			errs = append(errs, "radius_unit harus m atau km")
+		}
+		g.Polygon = nil
+	case db.GeofencePolygon:
+		if len(g.Polygon) < 3 {
+			errs = append(errs, "Poligon membutuhkan minimal 3 titik")
+		}
+		for _, p := range g.Polygon {
+			if !validCoordinate(p) {
+				errs = append(errs, "Titik poligon tidak valid")
+				break
+			}
+		}
+		g.Latitude, g.Longitude, g.Radius, g.RadiusUnit = 0, 0, 0, ""
+	default:
+		errs = append(errs, "kind harus circle atau polygon")
+	}
+	return errs
+}
+
+// geofenceArgs are the circle and polygon columns of a geofence, NULL where
+// its kind doesn't use them
+func geofenceArgs(g db.Geofence) ([]interface{}, error) {
+	if g.Kind == db.GeofencePolygon {
+		polygon, err := json.Marshal(g.Polygon)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{nil, nil, nil, nil, string(polygon)}, nil
+	}
+	return []interface{}{g.Latitude, g.Longitude, g.Radius, g.RadiusUnit, nil}, nil
+}
+
+// GetGeofences lists the current outlet's geofences
+func GetGeofences(c *fiber.Ctx, dbConn *sql.DB) error {
+	geofences, err := getGeofences(dbConn, middleware.CurrentIdentity(c).OutletID, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"success": true, "geofences": geofences})
+}
+
+// CreateGeofence adds a circle or polygon geofence to the current outlet
+func CreateGeofence(c *fiber.Ctx, dbConn *sql.DB) error {
+	g := db.Geofence{Active: true}
+	if err := c.BodyParser(&g); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if errs := validateGeofence(&g); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	args, err := geofenceArgs(g)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	g.OutletID = middleware.CurrentIdentity(c).OutletID
+	args = append([]interface{}{g.Name, g.Kind}, append(args, g.Active, g.OutletID)...)
+
+	err = dbConn.QueryRow(`
+	INSERT INTO geofences (name, kind, latitude, longitude, radius, radius_unit, polygon, active, outlet_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8, $9) RETURNING id`, args...).Scan(&g.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "geofence": g})
+}
+
+// UpdateGeofence replaces a geofence
+func UpdateGeofence(c *fiber.Ctx, dbConn *sql.DB) error {
+	var g db.Geofence
+	if err := c.BodyParser(&g); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if errs := validateGeofence(&g); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	args, err := geofenceArgs(g)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	args = append([]interface{}{g.Name, g.Kind}, append(args, g.Active, c.Params("id"), middleware.CurrentIdentity(c).OutletID)...)
+
+	res, err := dbConn.Exec(`
+	UPDATE geofences
+	SET name = $1, kind = $2, latitude = $3, longitude = $4, radius = $5, radius_unit = $6,
+	    polygon = $7::jsonb, active = $8, updated_at = NOW()
+	WHERE id = $9 AND outlet_id = $10`, args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Geofence tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// DeleteGeofence removes a geofence
+func DeleteGeofence(c *fiber.Ctx, dbConn *sql.DB) error {
+	res, err := dbConn.Exec("DELETE FROM geofences WHERE id = $1 AND outlet_id = $2", c.Params("id"), middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Geofence tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// CheckGeofence tells an admin whether a point would be accepted and how far
+// it is from each geofence, for testing a setup on site
+func CheckGeofence(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Accuracy  float64 `json:"accuracy"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	p := db.GeoPoint{Lat: req.Latitude, Lng: req.Longitude}
+	outletID := middleware.CurrentIdentity(c).OutletID
+
+	geofences, err := getGeofences(dbConn, outletID, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	distances := []fiber.Map{}
+	for _, g := range geofences {
+		distances = append(distances, fiber.Map{"id": g.ID, "name": g.Name, "distance_meters": math.Round(geofenceDistance(g, p))})
+	}
+
+	result := fiber.Map{"success": true, "inside": true, "distances": distances}
+	match, err := locateDiner(dbConn, outletID, p, req.Accuracy)
+	if err != nil {
+		fiberErr, ok := err.(*fiber.Error)
+		if !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		result["inside"] = false
+		result["reason"] = fiberErr.Message
+	} else {
+		result["geofence"] = match.Name
+	}
+	return c.JSON(result)
+}
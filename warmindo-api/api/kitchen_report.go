@@ -0,0 +1,220 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// Which grouping a kitchen timing row belongs to, from GROUPING(menu_id,
+// staff_id, hour): a set bit means that column was rolled up
+const (
+	kitchenGroupOverall = 7
+	kitchenGroupMenu    = 3
+	kitchenGroupStaff   = 5
+	kitchenGroupHour    = 6
+)
+
+// GetKitchenReport measures, for order lines placed in ?from=&to= at the
+// current outlet, the minutes from placing the order to first reaching
+// cooking, served and paid: average, median, 90th and 95th percentile and
+// worst case, overall and per menu, per staff member who set the status and
+// per hour of the day the order was placed. ?format= exports it as a file.
+func GetKitchenReport(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+	from, to, err := reportRange(c, dbConn, outletID)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	// Only the first time a line reaches a status counts; a line sent back
+	// to cooking doesn't restart its clock
+	rows, err := dbConn.Query(`
+	WITH reached AS (
+		SELECT DISTINCT ON (e.order_id, e.status_id) e.order_id, e.status_id, e.staff_id, e.created_at
+		FROM order_status_events e
+		WHERE e.outlet_id = $1
+		ORDER BY e.order_id, e.status_id, e.created_at
+	),
+	transitions AS (
+		SELECT st.code AS status, o.menu_id, m.name AS menu_name,
+		       COALESCE(r.staff_id, 0) AS staff_id, COALESCE(sf.name, '') AS staff_name,
+		       EXTRACT(HOUR FROM placed)::int AS hour,
+		       EXTRACT(EPOCH FROM (r.created_at - o.created_at)) / 60 AS minutes
+		FROM reached r
+		JOIN orders o ON o.id = r.order_id
+		JOIN statuses st ON st.id = r.status_id
+		JOIN menus m ON m.id = o.menu_id
+		JOIN settings s ON s.outlet_id = o.outlet_id
+		LEFT JOIN staffs sf ON sf.id = r.staff_id
+		CROSS JOIN LATERAL (SELECT (o.created_at AT TIME ZONE current_setting('TimeZone')) AT TIME ZONE s.timezone AS placed) p
+		WHERE st.code = ANY($4)
+		  AND placed::date BETWEEN $2::date AND $3::date
+		  AND r.created_at >= o.created_at
+	)
+	SELECT GROUPING(menu_id, staff_id, hour), status,
+	       menu_id, menu_name, staff_id, staff_name, hour,
+	       COUNT(*),
+	       ROUND(AVG(minutes)::numeric, 1),
+	       ROUND((percentile_cont(0.5) WITHIN GROUP (ORDER BY minutes))::numeric, 1),
+	       ROUND((percentile_cont(0.9) WITHIN GROUP (ORDER BY minutes))::numeric, 1),
+	       ROUND((percentile_cont(0.95) WITHIN GROUP (ORDER BY minutes))::numeric, 1),
+	       ROUND(MAX(minutes)::numeric, 1)
+	FROM transitions
+	GROUP BY GROUPING SETS (
+		(status),
+		(status, menu_id, menu_name),
+		(status, staff_id, staff_name),
+		(status, hour)
+	)
+	ORDER BY menu_name NULLS FIRST, staff_name NULLS FIRST, hour NULLS FIRST, array_position($4, status)`,
+		outletID, from, to, pq.Array(db.KitchenStatusCodes))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	overall := []db.StatusTiming{}
+	menus := []db.MenuKitchenTiming{}
+	staff := []db.StaffKitchenTiming{}
+	hours := []db.HourKitchenTiming{}
+	menuIndex := map[int]int{}
+	staffIndex := map[int]int{}
+	hourIndex := map[int]int{}
+
+	for rows.Next() {
+		var grouping int
+		var menuID, staffID, hour sql.NullInt64
+		var menuName, staffName sql.NullString
+		var t db.StatusTiming
+		if err := rows.Scan(&grouping, &t.Status, &menuID, &menuName, &staffID, &staffName, &hour,
+			&t.Count, &t.AvgMinutes, &t.P50Minutes, &t.P90Minutes, &t.P95Minutes, &t.MaxMinutes); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		switch grouping {
+		case kitchenGroupOverall:
+			overall = append(overall, t)
+		case kitchenGroupMenu:
+			id := int(menuID.Int64)
+			i, ok := menuIndex[id]
+			if !ok {
+				i = len(menus)
+				menuIndex[id] = i
+				menus = append(menus, db.MenuKitchenTiming{MenuID: id, MenuName: menuName.String})
+			}
+			menus[i].Timings = append(menus[i].Timings, t)
+		case kitchenGroupStaff:
+			id := int(staffID.Int64)
+			i, ok := staffIndex[id]
+			if !ok {
+				i = len(staff)
+				staffIndex[id] = i
+				staff = append(staff, db.StaffKitchenTiming{StaffID: id, StaffName: staffName.String})
+			}
+			staff[i].Timings = append(staff[i].Timings, t)
+		case kitchenGroupHour:
+			h := int(hour.Int64)
+			i, ok := hourIndex[h]
+			if !ok {
+				i = len(hours)
+				hourIndex[h] = i
+				hours = append(hours, db.HourKitchenTiming{Hour: h})
+			}
+			hours[i].Timings = append(hours[i].Timings, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		report := kitchenReport{overall, menus, staff, hours}
+		return sendExport(c, format, "laporan-dapur-"+from+"-"+to, "Laporan Waktu Dapur "+periodLabel(from, to), report.export)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"outlet_id": outletID,
+		"from":      from,
+		"to":        to,
+		"statuses":  db.KitchenStatusCodes,
+		"overall":   overall,
+		"by_menu":   menus,
+		"by_staff":  staff,
+		"by_hour":   hours,
+	})
+}
+
+// kitchenReport holds the groupings of GetKitchenReport for export
+type kitchenReport struct {
+	overall []db.StatusTiming
+	menus   []db.MenuKitchenTiming
+	staff   []db.StaffKitchenTiming
+	hours   []db.HourKitchenTiming
+}
+
+var timingColumns = []string{"Status", "Jumlah", "Rata-rata (menit)", "Median (menit)", "P90 (menit)", "P95 (menit)", "Terlama (menit)"}
+
+func timingCells(t db.StatusTiming) []interface{} {
+	return []interface{}{t.Status, t.Count, t.AvgMinutes, t.P50Minutes, t.P90Minutes, t.P95Minutes, t.MaxMinutes}
+}
+
+// export writes one row per group and status
+func (r *kitchenReport) export(w export.Writer) error {
+	if err := w.Section("Keseluruhan", timingColumns); err != nil {
+		return err
+	}
+	for _, t := range r.overall {
+		if err := w.Row(timingCells(t)...); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Section("Per menu", append([]string{"Menu"}, timingColumns...)); err != nil {
+		return err
+	}
+	for _, m := range r.menus {
+		for _, t := range m.Timings {
+			if err := w.Row(append([]interface{}{m.MenuName}, timingCells(t)...)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := w.Section("Per staf", append([]string{"Staf"}, timingColumns...)); err != nil {
+		return err
+	}
+	for _, s := range r.staff {
+		name := s.StaffName
+		if s.StaffID == 0 {
+			name = "-"
+		}
+		for _, t := range s.Timings {
+			if err := w.Row(append([]interface{}{name}, timingCells(t)...)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := w.Section("Per jam", append([]string{"Jam"}, timingColumns...)); err != nil {
+		return err
+	}
+	for _, h := range r.hours {
+		for _, t := range h.Timings {
+			if err := w.Row(append([]interface{}{fmt.Sprintf("%02d:00", h.Hour)}, timingCells(t)...)...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
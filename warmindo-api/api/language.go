@@ -0,0 +1,69 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"warmindo-api/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestLanguage picks the language for public content. The "lang" query
+// parameter wins over the Accept-Language header; anything unsupported falls
+// back to db.DefaultLanguage.
+func requestLanguage(c *fiber.Ctx) string {
+	if lang := normalizeLanguage(c.Query("lang")); lang != "" {
+		if db.IsSupportedLanguage(lang) {
+			return lang
+		}
+		return db.DefaultLanguage
+	}
+
+	type weighted struct {
+		lang    string
+		quality float64
+	}
+
+	var candidates []weighted
+	for _, part := range strings.Split(c.Get(fiber.HeaderAcceptLanguage), ",") {
+		fields := strings.Split(part, ";")
+		lang := normalizeLanguage(fields[0])
+		if lang == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		candidates = append(candidates, weighted{lang, quality})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	for _, candidate := range candidates {
+		if candidate.quality > 0 && db.IsSupportedLanguage(candidate.lang) {
+			return candidate.lang
+		}
+	}
+
+	return db.DefaultLanguage
+}
+
+// normalizeLanguage reduces a language tag such as "en-US" to its primary subtag.
+func normalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// MaxFailedLogins locks an account after this many consecutive failures
+	MaxFailedLogins = 5
+	// LoginLockoutDuration is how long a locked account stays locked
+	LoginLockoutDuration = 15 * time.Minute
+	// FreeFailedLogins failures are allowed before the progressive delay kicks in
+	FreeFailedLogins = 2
+	// MaxFailedLoginsPerIP throttles an address trying many accounts
+	MaxFailedLoginsPerIP = 20
+	// LoginAttemptWindow is the period failed attempts per IP are counted over
+	LoginAttemptWindow = 15 * time.Minute
+)
+
+// invalidCredentialsMessage is returned for both unknown emails and wrong
+// passwords so the login form doesn't reveal which emails are registered.
+const invalidCredentialsMessage = "Email/username atau kata sandi salah"
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// compareDummyPassword spends the same bcrypt time as a real check so response
+// timing doesn't reveal whether the account exists.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.GetHash("warmindo-dummy-password")
+	})
+	utils.ComparePassword(dummyHash, password)
+}
+
+// loginDelay is the wait required after the nth consecutive failure:
+// nothing for the first FreeFailedLogins, then 2s, 4s, 8s...
+func loginDelay(failedCount int) time.Duration {
+	if failedCount < FreeFailedLogins {
+		return 0
+	}
+	return time.Duration(math.Pow(2, float64(failedCount-FreeFailedLogins+1))) * time.Second
+}
+
+// seconds converts a span measured by the database into a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// checkIPThrottle reports how long the client must wait when its address has
+// too many recent failures, or 0 when it may try. Times are compared in the
+// database, whose clock stamped the attempts.
+func checkIPThrottle(dbConn *sql.DB, ip string) (time.Duration, error) {
+	var failures int
+	var remaining sql.NullFloat64
+	err := dbConn.QueryRow(`
+	SELECT COUNT(*), EXTRACT(EPOCH FROM MIN(created_at) + make_interval(secs => $2) - NOW())
+	FROM login_attempts
+	WHERE ip_address = $1 AND success = false AND created_at > NOW() - make_interval(secs => $2)`,
+		ip, LoginAttemptWindow.Seconds()).Scan(&failures, &remaining)
+	if err != nil {
+		return 0, err
+	}
+	if failures < MaxFailedLoginsPerIP || !remaining.Valid {
+		return 0, nil
+	}
+	return seconds(remaining.Float64), nil
+}
+
+// failureWait is how long to wait after failedCount consecutive failures,
+// the last one elapsed ago: the lockout once MaxFailedLogins is reached,
+// the progressive delay before that
+func failureWait(failedCount int, elapsed time.Duration) time.Duration {
+	wait := loginDelay(failedCount)
+	if failedCount >= MaxFailedLogins {
+		wait = LoginLockoutDuration
+	}
+	if wait -= elapsed; wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// checkAccountThrottle reports how long the account must wait because it is
+// locked or inside its progressive delay, or 0 when it may try.
+func checkAccountThrottle(dbConn *sql.DB, staffID int) (time.Duration, error) {
+	var failedCount int
+	var locked, sinceFailure sql.NullFloat64
+	err := dbConn.QueryRow(`
+	SELECT failed_login_count,
+	       EXTRACT(EPOCH FROM locked_until - NOW()),
+	       EXTRACT(EPOCH FROM NOW() - last_failed_login_at)
+	FROM staffs WHERE id = $1`, staffID).Scan(&failedCount, &locked, &sinceFailure)
+	if err != nil {
+		return 0, err
+	}
+
+	if locked.Valid && locked.Float64 > 0 {
+		return seconds(locked.Float64), nil
+	}
+	if sinceFailure.Valid {
+		return failureWait(failedCount, seconds(sinceFailure.Float64)), nil
+	}
+	return 0, nil
+}
+
+// checkIdentifierThrottle applies the account throttle to an identifier no
+// account has, counting its failures since its last success within
+// LoginLockoutDuration, so guessing at unknown accounts is slowed the same
+// way and the responses don't tell the two apart.
+func checkIdentifierThrottle(dbConn *sql.DB, identifier string) (time.Duration, error) {
+	var failedCount int
+	var sinceFailure sql.NullFloat64
+	err := dbConn.QueryRow(`
+	SELECT COUNT(*), EXTRACT(EPOCH FROM NOW() - MAX(created_at))
+	FROM login_attempts
+	WHERE identifier = $1 AND success = false
+	  AND created_at > NOW() - make_interval(secs => $2)
+	  AND created_at > COALESCE((SELECT MAX(created_at) FROM login_attempts WHERE identifier = $1 AND success), '-infinity')`,
+		identifier, LoginLockoutDuration.Seconds()).Scan(&failedCount, &sinceFailure)
+	if err != nil {
+		return 0, err
+	}
+	if !sinceFailure.Valid {
+		return 0, nil
+	}
+	return failureWait(failedCount, seconds(sinceFailure.Float64)), nil
+}
+
+// recordLoginAttempt logs the attempt and updates the account's failure
+// counter, locking it once MaxFailedLogins is reached. staffID is 0 for
+// unknown accounts.
+func recordLoginAttempt(dbConn *sql.DB, identifier, ip string, staffID int, success bool) error {
+	if _, err := dbConn.Exec("INSERT INTO login_attempts (identifier, ip_address, success) VALUES ($1, $2, $3)", identifier, ip, success); err != nil {
+		return err
+	}
+	if staffID == 0 {
+		return nil
+	}
+
+	if success {
+		_, err := dbConn.Exec("UPDATE staffs SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1", staffID)
+		return err
+	}
+
+	_, err := dbConn.Exec(`
+	UPDATE staffs
+	SET failed_login_count = failed_login_count + 1,
+	    last_failed_login_at = NOW(),
+	    locked_until = CASE WHEN failed_login_count + 1 >= $2 THEN NOW() + $3 * INTERVAL '1 second' ELSE locked_until END
+	WHERE id = $1`, staffID, MaxFailedLogins, int(LoginLockoutDuration.Seconds()))
+	return err
+}
+
+// tooManyAttempts answers a throttled login
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, fmt.Sprint(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"success":     false,
+		"errors":      []string{"Terlalu banyak percobaan masuk, coba lagi nanti"},
+		"retry_after": retryAfter,
+	})
+}
+
+// GetLockedUsers lists the current outlet's staff accounts that are locked out
+func GetLockedUsers(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query(`
+	SELECT st.id, st.email, st.name, st.username, st.role_id, st.failed_login_count, st.last_failed_login_at, st.locked_until
+	FROM staffs st JOIN staff_outlets so ON so.staff_id = st.id
+	WHERE so.outlet_id = $1 AND st.locked_until > NOW() AND st.deleted_at IS NULL
+	ORDER BY st.locked_until DESC`, middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	lockedUsers := []fiber.Map{}
+	for rows.Next() {
+		var user db.User
+		var failedCount int
+		var lastFailedAt, lockedUntil time.Time
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID, &failedCount, &lastFailedAt, &lockedUntil); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		lockedUsers = append(lockedUsers, fiber.Map{
+			"user":                 user,
+			"failed_login_count":   failedCount,
+			"last_failed_login_at": lastFailedAt,
+			"locked_until":         lockedUntil,
+		})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "users": lockedUsers})
+}
+
+// UnlockUser clears the lockout and failure counter of a staff account
+func UnlockUser(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pengguna tidak valid"})
+	}
+	if err := requireOutletStaff(c, dbConn, id); err != nil {
+		return respondError(c, err)
+	}
+
+	res, err := dbConn.Exec("UPDATE staffs SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1", id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pengguna tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Akun berhasil dibuka"})
+}
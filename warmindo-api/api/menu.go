@@ -3,6 +3,8 @@ package api
 import (
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"strconv"
 	"warmindo-api/db"
@@ -24,16 +26,25 @@ func SetupMenuRoutes(app *fiber.App, dbConn *sql.DB) {
 	})
 
 	// Protected endpoints
-	protectedAPI := app.Group("/api/menus", middleware.AuthMiddleware(1))
-	protectedAPI.Post("/", func(c *fiber.Ctx) error {
+	canWrite := middleware.RequirePermission(dbConn, db.PermissionMenusWrite)
+	menuAPI.Post("/", canWrite, func(c *fiber.Ctx) error {
 		return CreateMenu(c, dbConn)
 	})
-	protectedAPI.Put("/:id", func(c *fiber.Ctx) error {
+	menuAPI.Put("/:id", canWrite, func(c *fiber.Ctx) error {
 		return UpdateMenu(c, dbConn)
 	})
-	protectedAPI.Delete("/:id", func(c *fiber.Ctx) error {
+	menuAPI.Delete("/:id", canWrite, func(c *fiber.Ctx) error {
 		return DeleteMenu(c, dbConn)
 	})
+	menuAPI.Get("/:id/translations", canWrite, func(c *fiber.Ctx) error {
+		return GetMenuTranslations(c, dbConn)
+	})
+	menuAPI.Put("/:id/translations/:lang", canWrite, func(c *fiber.Ctx) error {
+		return UpsertMenuTranslation(c, dbConn)
+	})
+	menuAPI.Delete("/:id/translations/:lang", canWrite, func(c *fiber.Ctx) error {
+		return DeleteMenuTranslation(c, dbConn)
+	})
 }
 
 // Handlers untuk Menu
@@ -49,8 +60,12 @@ func CreateMenu(c *fiber.Ctx, dbConn *sql.DB) error {
 	// Extract fields from the form
 	menu.Name = form.Value["name"][0]
 	menu.Description = form.Value["description"][0]
-	menu.Price, _ = strconv.Atoi(form.Value["price"][0])
-	menu.CategoryID, _ = strconv.Atoi(form.Value["category_id"][0])
+	if menu.Price, err = strconv.Atoi(form.Value["price"][0]); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Harga tidak valid"})
+	}
+	if menu.CategoryID, err = strconv.Atoi(form.Value["category_id"][0]); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kategori tidak valid"})
+	}
 
 	// Handle file upload
 	file, err := c.FormFile("image")
@@ -70,17 +85,47 @@ func CreateMenu(c *fiber.Ctx, dbConn *sql.DB) error {
 		menu.Image = base64.StdEncoding.EncodeToString(imageData)
 	}
 
-	_, err = dbConn.Exec("INSERT INTO menus (name, image, description, price, category_id) VALUES ($1, $2, $3, $4, $5)",
-		menu.Name, menu.Image, menu.Description, menu.Price, menu.CategoryID)
+	translations, err := parseMenuTranslations(form.Value["translations"])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// The menu and its translations are saved together or not at all
+	tx, err := dbConn.Begin()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	defer tx.Rollback()
 
-	return c.JSON(fiber.Map{"success": true})
+	err = tx.QueryRow("INSERT INTO menus (name, image, description, price, category_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		menu.Name, menu.Image, menu.Description, menu.Price, menu.CategoryID).Scan(&menu.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := saveMenuTranslations(tx, menu.ID, translations); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "id": menu.ID})
 }
 
+// GetMenus lists the menus sold at an outlet (?outlet_id=, default outlet
+// otherwise) with the outlet's prices
 func GetMenus(c *fiber.Ctx, dbConn *sql.DB) error {
-	rows, err := dbConn.Query("SELECT id, name, image, description, price, category_id, created_at, updated_at FROM menus WHERE deleted = false ORDER BY updated_at desc")
+	lang := requestLanguage(c)
+
+	rows, err := dbConn.Query(`
+	SELECT m.id, COALESCE(t.name, m.name), m.image, COALESCE(NULLIF(t.description, ''), m.description),
+	       COALESCE(om.price, m.price), m.category_id, m.created_at, m.updated_at
+	FROM menus m
+	LEFT JOIN menu_translations t ON t.menu_id = m.id AND t.language = $1
+	LEFT JOIN outlet_menus om ON om.menu_id = m.id AND om.outlet_id = $2
+	WHERE m.deleted = false AND COALESCE(om.available, true)
+	ORDER BY m.updated_at desc`, lang, requestOutlet(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -92,26 +137,38 @@ func GetMenus(c *fiber.Ctx, dbConn *sql.DB) error {
 		if err := rows.Scan(&menu.ID, &menu.Name, &menu.Image, &menu.Description, &menu.Price, &menu.CategoryID, &menu.CreatedAt, &menu.UpdatedAt); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		menu.Language = lang
 		menus = append(menus, menu)
 	}
 
-	return c.JSON(fiber.Map{"success": true, "menus": menus})
+	return c.JSON(fiber.Map{"success": true, "language": lang, "menus": menus})
 }
 
 func GetMenuByID(c *fiber.Ctx, dbConn *sql.DB) error {
 	id := c.Params("id")
+	lang := requestLanguage(c)
 	var menu db.Menu
 
-	err := dbConn.QueryRow("SELECT id, name, image, description, price, category_id, created_at, updated_at FROM menus WHERE id = $1", id).Scan(&menu.ID, &menu.Name, &menu.Image, &menu.Description, &menu.Price, &menu.CategoryID, &menu.CreatedAt, &menu.UpdatedAt)
+	err := dbConn.QueryRow(`
+	SELECT m.id, COALESCE(t.name, m.name), m.image, COALESCE(NULLIF(t.description, ''), m.description),
+	       COALESCE(om.price, m.price), m.category_id, m.created_at, m.updated_at
+	FROM menus m
+	LEFT JOIN menu_translations t ON t.menu_id = m.id AND t.language = $2
+	LEFT JOIN outlet_menus om ON om.menu_id = m.id AND om.outlet_id = $3
+	WHERE m.id = $1`, id, lang, requestOutlet(c)).Scan(&menu.ID, &menu.Name, &menu.Image, &menu.Description, &menu.Price, &menu.CategoryID, &menu.CreatedAt, &menu.UpdatedAt)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	menu.Language = lang
 
 	return c.JSON(fiber.Map{"success": true, "menu": menu})
 }
 
 func UpdateMenu(c *fiber.Ctx, dbConn *sql.DB) error {
-	id := c.Params("id")
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID menu tidak valid"})
+	}
 	var menu db.Menu
 
 	// Parse the multipart form
@@ -123,8 +180,12 @@ func UpdateMenu(c *fiber.Ctx, dbConn *sql.DB) error {
 	// Extract fields from the form
 	menu.Name = form.Value["name"][0]
 	menu.Description = form.Value["description"][0]
-	menu.Price, _ = strconv.Atoi(form.Value["price"][0])
-	menu.CategoryID, _ = strconv.Atoi(form.Value["category_id"][0])
+	if menu.Price, err = strconv.Atoi(form.Value["price"][0]); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Harga tidak valid"})
+	}
+	if menu.CategoryID, err = strconv.Atoi(form.Value["category_id"][0]); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kategori tidak valid"})
+	}
 
 	// Handle file upload
 	file, err := c.FormFile("image")
@@ -144,19 +205,139 @@ func UpdateMenu(c *fiber.Ctx, dbConn *sql.DB) error {
 		menu.Image = base64.StdEncoding.EncodeToString(imageData)
 	}
 
-	_, err = dbConn.Exec("UPDATE menus SET name = $1, image = $2, description = $3, price = $4, category_id = $5, updated_at = NOW() WHERE id = $6",
+	translations, err := parseMenuTranslations(form.Value["translations"])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE menus SET name = $1, image = $2, description = $3, price = $4, category_id = $5, updated_at = NOW() WHERE id = $6",
 		menu.Name, menu.Image, menu.Description, menu.Price, menu.CategoryID, id)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := saveMenuTranslations(tx, id, translations); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.JSON(fiber.Map{"success": true})
 }
 
+// DeleteMenu moves a menu to the trash. Past orders keep pointing at it.
 func DeleteMenu(c *fiber.Ctx, dbConn *sql.DB) error {
 	id := c.Params("id")
 
-	_, err := dbConn.Exec("UPDATE menus SET deleted = true WHERE id = $1", id)
+	_, err := dbConn.Exec("UPDATE menus SET deleted = true, deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL", id, middleware.CurrentIdentity(c).UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// parseMenuTranslations decodes the optional "translations" form field, a JSON
+// array of {language, name, description} objects.
+func parseMenuTranslations(values []string) ([]db.MenuTranslation, error) {
+	var translations []db.MenuTranslation
+	if len(values) == 0 || values[0] == "" {
+		return translations, nil
+	}
+
+	if err := json.Unmarshal([]byte(values[0]), &translations); err != nil {
+		return nil, fmt.Errorf("Format terjemahan tidak valid")
+	}
+	for _, translation := range translations {
+		if err := validateMenuTranslation(translation); err != nil {
+			return nil, err
+		}
+	}
+
+	return translations, nil
+}
+
+func validateMenuTranslation(translation db.MenuTranslation) error {
+	if !db.IsSupportedLanguage(translation.Language) || translation.Language == db.DefaultLanguage {
+		return fmt.Errorf("Bahasa tidak didukung: %s", translation.Language)
+	}
+	if translation.Name == "" {
+		return fmt.Errorf("Nama terjemahan wajib diisi")
+	}
+	return nil
+}
+
+func saveMenuTranslations(dbConn db.Execer, menuID int, translations []db.MenuTranslation) error {
+	for _, translation := range translations {
+		_, err := dbConn.Exec(`
+		INSERT INTO menu_translations (menu_id, language, name, description)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (menu_id, language)
+		DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description, updated_at = NOW()`,
+			menuID, translation.Language, translation.Name, translation.Description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMenuTranslations lists every stored translation of a menu for the admin UI
+func GetMenuTranslations(c *fiber.Ctx, dbConn *sql.DB) error {
+	id := c.Params("id")
+
+	rows, err := dbConn.Query("SELECT language, name, COALESCE(description, '') FROM menu_translations WHERE menu_id = $1 ORDER BY language", id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	translations := []db.MenuTranslation{}
+	for rows.Next() {
+		var translation db.MenuTranslation
+		if err := rows.Scan(&translation.Language, &translation.Name, &translation.Description); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		translations = append(translations, translation)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "translations": translations})
+}
+
+// UpsertMenuTranslation creates or replaces the translation of a menu for one language
+func UpsertMenuTranslation(c *fiber.Ctx, dbConn *sql.DB) error {
+	menuID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID menu tidak valid"})
+	}
+
+	var translation db.MenuTranslation
+	if err := c.BodyParser(&translation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	translation.Language = normalizeLanguage(c.Params("lang"))
+
+	if err := validateMenuTranslation(translation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := saveMenuTranslations(dbConn, menuID, []db.MenuTranslation{translation}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "translation": translation})
+}
+
+// DeleteMenuTranslation removes a translation so the menu falls back to the default language
+func DeleteMenuTranslation(c *fiber.Ctx, dbConn *sql.DB) error {
+	_, err := dbConn.Exec("DELETE FROM menu_translations WHERE menu_id = $1 AND language = $2", c.Params("id"), normalizeLanguage(c.Params("lang")))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -2,38 +2,59 @@ package api
 
 import (
 	"database/sql"
-	"fmt"
+	"strconv"
+	"strings"
 	"time"
 	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func SetupOrderRoutes(app *fiber.App, dbConn *sql.DB) {
 	orderAPI := app.Group("/api/orders")
-	orderAPI.Get("/", func(c *fiber.Ctx) error {
+	orderAPI.Get("/", middleware.RequirePermission(dbConn, db.PermissionOrdersRead), func(c *fiber.Ctx) error {
 		return GetOrders(c, dbConn)
 	})
-	orderAPI.Get("/:order_code", func(c *fiber.Ctx) error {
+
+	// Customers read and place their orders with the access token of their
+	// session; staff need the orders permissions to do it for them
+	orderAPI.Get("/:order_code", customerOrStaff(dbConn, db.PermissionOrdersRead, paramOrderCode), func(c *fiber.Ctx) error {
 		return GetOrdersByCode(c, dbConn)
 	})
-	orderAPI.Post("/", func(c *fiber.Ctx) error {
+	orderAPI.Post("/", customerOrStaff(dbConn, db.PermissionOrdersUpdate, bodyOrderCode), func(c *fiber.Ctx) error {
 		return CreateOrder(c, dbConn)
 	})
-	orderAPI.Put("/:id", func(c *fiber.Ctx) error {
+
+	orderAPI.Get("/:id/history", middleware.RequirePermission(dbConn, db.PermissionOrdersRead), func(c *fiber.Ctx) error {
+		return GetOrderStatusHistory(c, dbConn)
+	})
+
+	orderAPI.Put("/:id", middleware.RequirePermission(dbConn, db.PermissionOrdersUpdate), func(c *fiber.Ctx) error {
 		return UpdateOrder(c, dbConn)
 	})
-	orderAPI.Patch("/status", func(c *fiber.Ctx) error {
+	orderAPI.Patch("/status", middleware.RequirePermission(dbConn, db.PermissionOrdersUpdateStatus), func(c *fiber.Ctx) error {
 		return UpdateOrderStatus(c, dbConn)
 	})
-	orderAPI.Delete("/:id", func(c *fiber.Ctx) error {
+
+	// Lines are voided or cancelled with a reason; only cancelled lines can
+	// then be moved to the trash
+	canVoid := middleware.RequirePermission(dbConn, db.PermissionOrdersVoid)
+	orderAPI.Post("/:id/void", canVoid, func(c *fiber.Ctx) error {
+		return VoidOrder(c, dbConn)
+	})
+	orderAPI.Post("/:id/cancel", canVoid, func(c *fiber.Ctx) error {
+		return CancelOrder(c, dbConn)
+	})
+	orderAPI.Delete("/:id", middleware.RequirePermission(dbConn, db.PermissionOrdersDelete), func(c *fiber.Ctx) error {
 		return DeleteOrder(c, dbConn)
 	})
 }
 
 // Handlers untuk Order
 type CreateOrderRequest struct {
-	TableNumber string `json:"table_number" validate:"required"`
+	TableNumber string `json:"table_number"`
 	OrderCode   string `json:"order_code" validate:"required"`
 	MenuID      int    `json:"menu_id" validate:"required,number"`
 	Amount      int    `json:"amount" validate:"required,number"`
@@ -48,38 +69,75 @@ func CreateOrder(c *fiber.Ctx, dbConn *sql.DB) error {
 			"message": err.Error(),
 		})
 	}
+	if data.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Jumlah pesanan harus lebih dari 0"})
+	}
+
+	tableNumber, outletID, err := resolveOrderTable(dbConn, data.OrderCode, data.TableNumber)
+	if err != nil {
+		return orderTableError(c, err)
+	}
+	data.TableNumber = strconv.Itoa(tableNumber)
+
+	// Sessions opened before closing time can't keep ordering after it
+	store, err := storeStatus(dbConn, outletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error()})
+	}
+	if !store.Open {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": store.Message, "closed": true, "store": store})
+	}
 
-	// Check if the order already exists
-	var existingAmount int
-	err := dbConn.QueryRow("SELECT amount FROM orders WHERE order_code = $1 AND menu_id = $2 AND status_id = 1", data.OrderCode, data.MenuID).Scan(&existingAmount)
+	// The menu has to be sold at the session's outlet, and the line keeps
+	// the price it is sold at
+	var available bool
+	var unitPrice int
+	err = dbConn.QueryRow(`
+	SELECT COALESCE(om.available, true), COALESCE(om.price, m.price)
+	FROM menus m LEFT JOIN outlet_menus om ON om.menu_id = m.id AND om.outlet_id = $2
+	WHERE m.id = $1 AND m.deleted = false`, data.MenuID, outletID).Scan(&available, &unitPrice)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error()})
+	}
+	if !available {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Menu tidak tersedia di outlet ini"})
+	}
+
+	// A pending line of the same menu and price is added to rather than
+	// duplicated
+	var existingID int
+	err = dbConn.QueryRow("SELECT id FROM orders WHERE order_code = $1 AND menu_id = $2 AND unit_price = $3 AND status_id = 1 ORDER BY id LIMIT 1", data.OrderCode, data.MenuID, unitPrice).Scan(&existingID)
 	if err != nil && err != sql.ErrNoRows {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": err.Error(),
 		})
 	}
 
-	if existingAmount > 0 {
+	if existingID > 0 {
 		// Update the existing order by accumulating the amount
-		newAmount := existingAmount + data.Amount
-		_, err := dbConn.Exec(
-			"UPDATE orders SET amount = $1, updated_at = NOW() WHERE order_code = $2 AND menu_id = $3 AND status_id = 1",
-			newAmount, data.OrderCode, data.MenuID,
-		)
-		if err != nil {
+		var newAmount int
+		err := dbConn.QueryRow(
+			"UPDATE orders SET amount = amount + $1, updated_at = NOW() WHERE id = $2 AND status_id = 1 RETURNING amount",
+			data.Amount, existingID,
+		).Scan(&newAmount)
+		if err == nil {
+			return c.Status(fiber.StatusOK).JSON(fiber.Map{
+				"message":      "Order updated successfully",
+				"total_amount": newAmount,
+			})
+		}
+		// A line that left pending in the meantime gets a new line instead
+		if err != sql.ErrNoRows {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"message": err.Error(),
 			})
 		}
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message":      "Order updated successfully",
-			"total_amount": newAmount,
-		})
 	}
 
 	// Create a new order
 	_, err = dbConn.Exec(
-		"INSERT INTO orders (table_number, order_code, menu_id, amount, status_id, order_date) VALUES ($1, $2, $3, $4, $5, $6)",
-		data.TableNumber, data.OrderCode, data.MenuID, data.Amount, 1, time.Now(),
+		"INSERT INTO orders (table_number, order_code, menu_id, amount, unit_price, status_id, order_date, outlet_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		data.TableNumber, data.OrderCode, data.MenuID, data.Amount, unitPrice, 1, time.Now(), outletID,
 	)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -92,24 +150,104 @@ func CreateOrder(c *fiber.Ctx, dbConn *sql.DB) error {
 	})
 }
 
+// resolveOrderTable checks that an order code belongs to an open customer
+// session on an active table and returns that table's number and outlet. A
+// table number sent by the client must agree with the session.
+func resolveOrderTable(dbConn *sql.DB, orderCode, tableNumber string) (int, int, error) {
+	var number, outletID int
+	var tableActive bool
+	err := dbConn.QueryRow(`
+	SELECT cu.table_number, cu.outlet_id, t.active
+	FROM customers cu
+	JOIN tables t ON t.outlet_id = cu.outlet_id AND t.number = cu.table_number
+	WHERE cu.order_code = $1 AND cu.active = true`, orderCode).Scan(&number, &outletID, &tableActive)
+	if err == sql.ErrNoRows {
+		return 0, 0, fiber.NewError(fiber.StatusForbidden, "Kode pesanan tidak valid atau sesi sudah berakhir")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if !tableActive {
+		return 0, 0, fiber.NewError(fiber.StatusForbidden, "Meja tidak aktif")
+	}
+	if tableNumber = strings.TrimSpace(tableNumber); tableNumber != "" && tableNumber != strconv.Itoa(number) {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "Nomor meja tidak sesuai dengan kode pesanan")
+	}
+	return number, outletID, nil
+}
+
+// orderTableError writes a resolveOrderTable failure in the order handlers' shape
+func orderTableError(c *fiber.Ctx, err error) error {
+	if e, ok := err.(*fiber.Error); ok {
+		return c.Status(e.Code).JSON(fiber.Map{"message": e.Message})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error()})
+}
+
+// GetOrders lists the current outlet's order lines, newest first.
+// ?date= or ?from=&to= limits them to days in the outlet's time zone, and
+// ?format= streams them as a file, by default for today.
 func GetOrders(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+
 	query := `
 	SELECT o.id, o.amount, o.table_number, o.status_id, o.order_date, o.menu_id, o.order_code, 
            o.created_at, o.updated_at,
-           s.name as status_name,
-           m.name as menu_name, m.description as menu_description, m.price as menu_price,
+           st.name as status_name,
+           m.name as menu_name, m.description as menu_description, o.unit_price as menu_price,
            c.name as category_name,
-           (o.amount * m.price) as total_price
+           (o.amount * o.unit_price) as total_price
     FROM orders o
-    JOIN statuses s ON o.status_id = s.id
+    JOIN statuses st ON o.status_id = st.id
     JOIN menus m ON o.menu_id = m.id
     JOIN categories c ON m.category_id = c.id
+    JOIN settings s ON s.outlet_id = o.outlet_id
+    WHERE o.outlet_id = $1 AND o.deleted_at IS NULL`
+	args := []interface{}{outletID}
+
+	from, to := "", ""
+	if format != "" || c.Query("date") != "" || c.Query("from") != "" || c.Query("to") != "" {
+		if from, to, err = reportRange(c, dbConn, outletID); err != nil {
+			return respondError(c, err)
+		}
+		query += ` AND (` + db.LocalOrderDateSQL + `)::date BETWEEN $2::date AND $3::date`
+		args = append(args, from, to)
+	}
+	query += `
 	ORDER BY o.order_date DESC`
 
-	rows, err := dbConn.Query(query)
+	rows, err := dbConn.Query(query, args...)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+
+	if format != "" {
+		// The rows are read while the file is sent, so they stay open until then
+		return sendExport(c, format, "pesanan-"+from+"-"+to, "Daftar Pesanan "+periodLabel(from, to), func(w export.Writer) error {
+			defer rows.Close()
+			if err := w.Section("Pesanan", []string{"ID", "Kode pesanan", "Meja", "Menu", "Kategori", "Jumlah", "Harga", "Total", "Status", "Tanggal"}); err != nil {
+				return err
+			}
+			for rows.Next() {
+				var order db.Order
+				var statusName, menuName, menuDescription, categoryName string
+				var menuPrice, totalPrice int
+				if err := rows.Scan(&order.ID, &order.Amount, &order.TableNumber, &order.StatusID, &order.OrderDate, &order.MenuID, &order.OrderCode,
+					&order.CreatedAt, &order.UpdatedAt, &statusName, &menuName, &menuDescription, &menuPrice, &categoryName, &totalPrice); err != nil {
+					return err
+				}
+				if err := w.Row(order.ID, order.OrderCode, order.TableNumber, menuName, categoryName,
+					order.Amount, menuPrice, totalPrice, statusName, order.OrderDate); err != nil {
+					return err
+				}
+			}
+			return rows.Err()
+		})
+	}
 	defer rows.Close()
 
 	var orders []fiber.Map
@@ -152,22 +290,25 @@ func GetOrders(c *fiber.Ctx, dbConn *sql.DB) error {
 
 func GetOrdersByCode(c *fiber.Ctx, dbConn *sql.DB) error {
 	orderCode := c.Params("order_code")
+	lang := requestLanguage(c)
 
 	query := `
 	SELECT o.id, o.amount, o.table_number, o.status_id, o.order_date, o.menu_id, o.order_code, 
            o.created_at, o.updated_at,
            s.name as status_name,
-           m.name as menu_name, m.description as menu_description, m.price as menu_price,
-           c.name as category_name,
-           (o.amount * m.price) as total_price
+           COALESCE(mt.name, m.name) as menu_name, COALESCE(NULLIF(mt.description, ''), m.description) as menu_description, o.unit_price as menu_price,
+           COALESCE(ct.name, c.name) as category_name,
+           (o.amount * o.unit_price) as total_price
     FROM orders o
     JOIN statuses s ON o.status_id = s.id
     JOIN menus m ON o.menu_id = m.id
     JOIN categories c ON m.category_id = c.id
-    WHERE o.order_code = $1
+    LEFT JOIN menu_translations mt ON mt.menu_id = m.id AND mt.language = $2
+    LEFT JOIN category_translations ct ON ct.category_id = c.id AND ct.language = $2
+    WHERE o.order_code = $1 AND o.deleted_at IS NULL
 	ORDER BY o.order_date DESC`
 
-	rows, err := dbConn.Query(query, orderCode)
+	rows, err := dbConn.Query(query, orderCode, lang)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -230,35 +371,61 @@ func UpdateOrder(c *fiber.Ctx, dbConn *sql.DB) error {
 			"message": err.Error(),
 		})
 	}
+	if data.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Jumlah pesanan harus lebih dari 0"})
+	}
+
+	// The line can only be moved to an open session of the staff member's
+	// outlet, and it takes that session's table
+	outletID := middleware.CurrentIdentity(c).OutletID
+	tableNumber, sessionOutletID, err := resolveOrderTable(dbConn, data.OrderCode, data.TableNumber)
+	if err != nil {
+		return orderTableError(c, err)
+	}
+	if sessionOutletID != outletID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Kode pesanan tidak ditemukan di outlet ini"})
+	}
+	data.TableNumber = strconv.Itoa(tableNumber)
 
-	// Update the order in the database
-	_, err := dbConn.Exec(`
+	// Paid lines are settled and can't be changed any more
+	var paid bool
+	err = dbConn.QueryRow(db.OrderLinePaidQuery, id, outletID).Scan(&paid)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Pesanan tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error()})
+	}
+	if paid {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Pesanan sudah dibayar"})
+	}
+
+	// Update the order in the database. Switching the menu prices the line
+	// at the new menu's current price.
+	res, err := dbConn.Exec(`
         UPDATE orders 
-        SET amount = $1, table_number = $2, order_code = $3, menu_id = $4, updated_at = NOW() 
-        WHERE id = $5
-    `, data.Amount, data.TableNumber, data.OrderCode, data.MenuID, id)
+        SET amount = $1, table_number = $2, order_code = $3, menu_id = $4, updated_at = NOW(),
+            unit_price = CASE WHEN menu_id = $4 THEN unit_price ELSE (
+                SELECT COALESCE(om.price, m.price) FROM menus m
+                LEFT JOIN outlet_menus om ON om.menu_id = m.id AND om.outlet_id = $6
+                WHERE m.id = $4) END
+        WHERE id = $5 AND outlet_id = $6 AND cancelled_at IS NULL
+          AND payment_id IS NULL AND status_id <> 3
+    `, data.Amount, data.TableNumber, data.OrderCode, data.MenuID, id, outletID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": err.Error(),
 		})
 	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Pesanan tidak ditemukan"})
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Order updated successfully",
 	})
 }
 
-func DeleteOrder(c *fiber.Ctx, dbConn *sql.DB) error {
-	id := c.Params("id")
-
-	_, err := dbConn.Exec("DELETE FROM orders WHERE id = $1", id)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	return c.JSON(fiber.Map{"success": true})
-}
-
 func UpdateOrderStatus(c *fiber.Ctx, dbConn *sql.DB) error {
 	type UpdateStatusRequest struct {
 		OrderCode string `json:"order_code"`
@@ -267,7 +434,6 @@ func UpdateOrderStatus(c *fiber.Ctx, dbConn *sql.DB) error {
 	}
 
 	var request UpdateStatusRequest
-	fmt.Print(request)
 	if err := c.BodyParser(&request); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -276,23 +442,107 @@ func UpdateOrderStatus(c *fiber.Ctx, dbConn *sql.DB) error {
 	if request.OrderCode == "" && request.ID == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Order code or ID must be provided"})
 	}
+	if request.StatusID == db.StatusCancelled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Pembatalan pesanan harus disertai alasan, gunakan /api/orders/:id/cancel"})
+	}
+	if request.StatusID == db.StatusPaid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Pelunasan pesanan harus dicatat sebagai pembayaran, gunakan /api/payments"})
+	}
 
 	var err error
+	identity := middleware.CurrentIdentity(c)
+	outletID := identity.OutletID
+
+	// Paid lines are settled; changing their status would put them back on
+	// the bill and charge them twice
+	var paid sql.NullBool
+	if request.ID != 0 {
+		err = dbConn.QueryRow(db.OrderLinePaidQuery, request.ID, outletID).Scan(&paid)
+	} else {
+		err = dbConn.QueryRow(db.OrderCodePaidQuery, request.OrderCode, outletID).Scan(&paid)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if paid.Valid && paid.Bool {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Pesanan sudah dibayar"})
+	}
 
-	// Update the order status based on the provided order code or ID
+	// Update the order status based on the provided order code or ID; the
+	// change is recorded in the order's status history
 	if request.ID != 0 {
-		_, err = dbConn.Exec("UPDATE orders SET status_id = $1, updated_at = NOW() WHERE id = $2", request.StatusID, request.ID)
+		_, err = dbConn.Exec(db.UpdateOrderStatusByIDQuery, request.StatusID, request.ID, outletID, identity.UserID)
 	} else if request.OrderCode != "" {
-		_, err = dbConn.Exec("UPDATE orders SET status_id = $1, updated_at = NOW() WHERE order_code = $2", request.StatusID, request.OrderCode)
-		if request.StatusID == 3 {
-			_, err = dbConn.Exec("UPDATE customers SET active = false, end_date = NOW() WHERE order_code = $1", request.OrderCode)
+		_, err = dbConn.Exec(db.UpdateOrderStatusByCodeQuery, request.StatusID, request.OrderCode, outletID, identity.UserID)
+	}
 
-		}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// DeleteOrder moves a cancelled order line to the trash. Lines that still
+// count towards a bill have to be cancelled first.
+func DeleteOrder(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pesanan tidak valid"})
+	}
+	identity := middleware.CurrentIdentity(c)
+
+	var cancelled bool
+	err = dbConn.QueryRow("SELECT cancelled_at IS NOT NULL FROM orders WHERE id = $1 AND outlet_id = $2 AND deleted_at IS NULL", id, identity.OutletID).Scan(&cancelled)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pesanan tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !cancelled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Batalkan pesanan terlebih dahulu"})
+	}
+
+	_, err = dbConn.Exec("UPDATE orders SET deleted_at = NOW(), deleted_by = $3 WHERE id = $1 AND outlet_id = $2 AND deleted_at IS NULL", id, identity.OutletID, identity.UserID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(fiber.Map{"success": true})
 }
+
+// GetOrderStatusHistory lists the status changes of one order line of the
+// current outlet, oldest first
+func GetOrderStatusHistory(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pesanan tidak valid"})
+	}
+
+	var createdAt string
+	err = dbConn.QueryRow("SELECT created_at::text FROM orders WHERE id = $1 AND outlet_id = $2", id, middleware.CurrentIdentity(c).OutletID).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pesanan tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := dbConn.Query(db.GetOrderStatusEventsQuery, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	events := []db.OrderStatusEvent{}
+	for rows.Next() {
+		var e db.OrderStatusEvent
+		if err := rows.Scan(&e.ID, &e.StatusID, &e.StatusCode, &e.StatusName, &e.StaffID, &e.StaffName, &e.CreatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		events = append(events, e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "order_id": id, "created_at": createdAt, "history": events})
+}
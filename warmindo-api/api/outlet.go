@@ -0,0 +1,387 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// SetupOutletRoutes sets up outlet management, per-outlet menu prices, staff
+// assignments and switching the outlet a login session works in
+func SetupOutletRoutes(app *fiber.App, dbConn *sql.DB) {
+	canManage := middleware.RequirePermission(dbConn, db.PermissionOutletsManage)
+
+	outletAPI := app.Group("/api/outlets")
+	outletAPI.Get("/", canManage, func(c *fiber.Ctx) error {
+		return GetOutlets(c, dbConn)
+	})
+	outletAPI.Post("/", canManage, func(c *fiber.Ctx) error {
+		return CreateOutlet(c, dbConn)
+	})
+	outletAPI.Put("/:id", canManage, func(c *fiber.Ctx) error {
+		return UpdateOutlet(c, dbConn)
+	})
+	outletAPI.Get("/:id/staff", canManage, func(c *fiber.Ctx) error {
+		return GetOutletStaff(c, dbConn)
+	})
+	outletAPI.Put("/:id/staff", canManage, func(c *fiber.Ctx) error {
+		return SetOutletStaff(c, dbConn)
+	})
+	outletAPI.Get("/:id/menus", canManage, func(c *fiber.Ctx) error {
+		return GetOutletMenus(c, dbConn)
+	})
+	outletAPI.Put("/:id/menus/:menu_id", canManage, func(c *fiber.Ctx) error {
+		return SetOutletMenu(c, dbConn)
+	})
+	outletAPI.Delete("/:id/menus/:menu_id", canManage, func(c *fiber.Ctx) error {
+		return DeleteOutletMenu(c, dbConn)
+	})
+
+	app.Get("/api/me/outlets", middleware.AuthMiddleware(dbConn), func(c *fiber.Ctx) error {
+		return GetMyOutlets(c, dbConn)
+	})
+	app.Post("/api/auth/switch-outlet", middleware.AuthMiddleware(dbConn), func(c *fiber.Ctx) error {
+		return SwitchOutlet(c, dbConn)
+	})
+}
+
+// requireOutletStaff answers 404 for staff members who don't work at the
+// caller's outlet, so staff of other outlets can't be read or changed
+func requireOutletStaff(c *fiber.Ctx, dbConn *sql.DB, staffID int) error {
+	identity := middleware.CurrentIdentity(c)
+	assigned, err := db.StaffInOutlet(dbConn, staffID, identity.OutletID)
+	if err != nil {
+		return err
+	}
+	if !assigned {
+		return fiber.NewError(fiber.StatusNotFound, "Pengguna tidak ditemukan")
+	}
+	return nil
+}
+
+// requestOutlet is the outlet a public endpoint serves: ?outlet_id= when
+// given, otherwise the default outlet
+func requestOutlet(c *fiber.Ctx) int {
+	if outletID := c.QueryInt("outlet_id", 0); outletID > 0 {
+		return outletID
+	}
+	return db.DefaultOutletID
+}
+
+func validateOutlet(outlet *db.Outlet) []string {
+	errs := []string{}
+	outlet.Code = strings.ToUpper(strings.TrimSpace(outlet.Code))
+	outlet.Name = strings.TrimSpace(outlet.Name)
+	if outlet.Code == "" || len(outlet.Code) > 20 {
+		errs = append(errs, "Kode outlet wajib diisi, maksimal 20 karakter")
+	}
+	if outlet.Name == "" {
+		errs = append(errs, "Nama outlet wajib diisi")
+	}
+	return errs
+}
+
+// GetOutlets lists every outlet
+func GetOutlets(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query(db.GetOutletsQuery + " ORDER BY id")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	outlets := []db.Outlet{}
+	for rows.Next() {
+		var outlet db.Outlet
+		if err := rows.Scan(&outlet.ID, &outlet.Code, &outlet.Name, &outlet.Address, &outlet.Phone, &outlet.Active, &outlet.CreatedAt, &outlet.UpdatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		outlets = append(outlets, outlet)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "outlets": outlets})
+}
+
+// CreateOutlet opens an outlet with its own settings row. The admin creating
+// it is assigned to it so they can switch to it and set it up.
+func CreateOutlet(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		db.Outlet
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	}
+	req.Active = true
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if errs := validateOutlet(&req.Outlet); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	outlet := req.Outlet
+	err = tx.QueryRow("INSERT INTO outlets (code, name, address, phone, active) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		outlet.Code, outlet.Name, strings.TrimSpace(outlet.Address), strings.TrimSpace(outlet.Phone), outlet.Active).Scan(&outlet.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Kode outlet sudah digunakan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	_, err = tx.Exec("INSERT INTO settings (outlet_id, total_table, latitude, longitude, radius) VALUES ($1, 0, $2, $3, 0)",
+		outlet.ID, req.Latitude, req.Longitude)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	if _, err := tx.Exec("INSERT INTO staff_outlets (staff_id, outlet_id) VALUES ($1, $2)", identity.UserID, outlet.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "outlet": outlet})
+}
+
+// UpdateOutlet edits an outlet. Deactivating it ends the login sessions
+// working in it.
+func UpdateOutlet(c *fiber.Ctx, dbConn *sql.DB) error {
+	var outlet db.Outlet
+	if err := c.BodyParser(&outlet); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if errs := validateOutlet(&outlet); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	res, err := dbConn.Exec("UPDATE outlets SET code = $1, name = $2, address = $3, phone = $4, active = $5, updated_at = NOW() WHERE id = $6",
+		outlet.Code, outlet.Name, strings.TrimSpace(outlet.Address), strings.TrimSpace(outlet.Phone), outlet.Active, c.Params("id"))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Kode outlet sudah digunakan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Outlet tidak ditemukan"})
+	}
+
+	if !outlet.Active {
+		if _, err := dbConn.Exec("UPDATE auth_sessions SET revoked_at = NOW() WHERE outlet_id = $1 AND revoked_at IS NULL", c.Params("id")); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetOutletStaff lists the staff assigned to an outlet
+func GetOutletStaff(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query(`
+	SELECT st.id, st.email, st.name, st.username, st.role_id
+	FROM staffs st JOIN staff_outlets so ON so.staff_id = st.id
+	WHERE so.outlet_id = $1 AND st.deleted_at IS NULL
+	ORDER BY st.name`, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	users := []db.User{}
+	for rows.Next() {
+		var user db.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		users = append(users, user)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "users": users})
+}
+
+// SetOutletStaff replaces the staff assigned to an outlet. Staff removed from
+// it lose the login sessions working there. Staff in the trash keep their
+// assignment so that restoring them puts them back.
+func SetOutletStaff(c *fiber.Ctx, dbConn *sql.DB) error {
+	outletID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID outlet tidak valid"})
+	}
+
+	var req struct {
+		StaffIDs []int `json:"staff_ids"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	// A nil slice would be sent as NULL, which no staff id is unequal to
+	if req.StaffIDs == nil {
+		req.StaffIDs = []int{}
+	}
+	staffIDs := pq.Array(req.StaffIDs)
+	if _, err := tx.Exec(`
+	DELETE FROM staff_outlets so USING staffs st
+	WHERE st.id = so.staff_id AND so.outlet_id = $1 AND NOT (so.staff_id = ANY($2)) AND st.deleted_at IS NULL`, outletID, staffIDs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	_, err = tx.Exec(`
+	INSERT INTO staff_outlets (staff_id, outlet_id)
+	SELECT id, $1 FROM staffs WHERE id = ANY($2) AND deleted_at IS NULL
+	ON CONFLICT DO NOTHING`, outletID, staffIDs)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Outlet tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	_, err = tx.Exec("UPDATE auth_sessions SET revoked_at = NOW() WHERE outlet_id = $1 AND NOT (staff_id = ANY($2)) AND revoked_at IS NULL", outletID, staffIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetOutletMenus lists the catalog with an outlet's price overrides and availability
+func GetOutletMenus(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query(`
+	SELECT m.id, m.name, m.price, om.price, COALESCE(om.price, m.price), COALESCE(om.available, true)
+	FROM menus m
+	LEFT JOIN outlet_menus om ON om.menu_id = m.id AND om.outlet_id = $1
+	ORDER BY m.name`, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	menus := []db.OutletMenu{}
+	for rows.Next() {
+		var menu db.OutletMenu
+		var price sql.NullInt64
+		if err := rows.Scan(&menu.MenuID, &menu.Name, &menu.BasePrice, &price, &menu.EffectivePrice, &menu.Available); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if price.Valid {
+			p := int(price.Int64)
+			menu.Price = &p
+		}
+		menus = append(menus, menu)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "menus": menus})
+}
+
+// SetOutletMenu sets an outlet's price for a menu (null for the catalog price)
+// and whether the outlet sells it
+func SetOutletMenu(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Price     *int  `json:"price"`
+		Available *bool `json:"available"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if req.Price != nil && *req.Price < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Harga tidak boleh negatif"})
+	}
+	available := true
+	if req.Available != nil {
+		available = *req.Available
+	}
+
+	_, err := dbConn.Exec(`
+	INSERT INTO outlet_menus (outlet_id, menu_id, price, available) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (outlet_id, menu_id) DO UPDATE SET price = EXCLUDED.price, available = EXCLUDED.available, updated_at = NOW()`,
+		c.Params("id"), c.Params("menu_id"), req.Price, available)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Outlet atau menu tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// DeleteOutletMenu drops an outlet's override so the catalog price applies again
+func DeleteOutletMenu(c *fiber.Ctx, dbConn *sql.DB) error {
+	if _, err := dbConn.Exec("DELETE FROM outlet_menus WHERE outlet_id = $1 AND menu_id = $2", c.Params("id"), c.Params("menu_id")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetMyOutlets lists the outlets the current user can work in
+func GetMyOutlets(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+	outlets, err := db.GetStaffOutlets(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"success": true, "outlets": outlets, "current_outlet_id": identity.OutletID})
+}
+
+// SwitchOutlet moves the current login session to another of the user's
+// outlets and returns an access token for it. The refresh token stays valid;
+// access tokens issued for the previous outlet stop working.
+func SwitchOutlet(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+	if identity.Scope == middleware.ScopePOS {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Sesi terminal POS terikat pada outlet terminal"})
+	}
+
+	var req struct {
+		OutletID int `json:"outlet_id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.OutletID < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "outlet_id wajib diisi"})
+	}
+
+	outlet, err := db.GetStaffOutlet(dbConn, identity.UserID, req.OutletID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Pengguna tidak ditempatkan di outlet ini"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if _, err := dbConn.Exec("UPDATE auth_sessions SET outlet_id = $1 WHERE id = $2", outlet.ID, identity.SessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	token, err := middleware.GenerateJWT(strconv.Itoa(identity.UserID), identity.RoleID, identity.SessionID, outlet.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan dalam menghasilkan token"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"token":      token,
+		"expires_in": int(middleware.AccessTokenTTL.Seconds()),
+		"outlet":     outlet,
+	})
+}
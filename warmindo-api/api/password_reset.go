@@ -0,0 +1,132 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/notify"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PasswordResetTTL is how long a reset link stays valid
+const PasswordResetTTL = 30 * time.Minute
+
+// ForgotPassword sends a reset link to a registered staff email. It answers
+// the same way whether or not the email exists so it can't be used to probe
+// for accounts, and sends in the background so the time it takes to answer
+// doesn't give that away either.
+func ForgotPassword(c *fiber.Ctx, dbConn *sql.DB, notifier notify.Notifier) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Permintaan tidak valid"}})
+	}
+
+	response := fiber.Map{"success": true, "message": "Jika email terdaftar, tautan reset kata sandi telah dikirim"}
+
+	user, err := db.GetUserByEmail(dbConn, strings.TrimSpace(req.Email))
+	if err == sql.ErrNoRows {
+		return c.JSON(response)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan dalam menghasilkan token"}})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	defer tx.Rollback()
+
+	// Only the most recent link works
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE staff_id = $1 AND used_at IS NULL", user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	_, err = tx.Exec("INSERT INTO password_resets (staff_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		user.ID, utils.HashToken(token), time.Now().Add(PasswordResetTTL))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	body := fmt.Sprintf("Halo %s,\n\nKami menerima permintaan untuk mengatur ulang kata sandi akun Warmindo Anda.\n"+
+		"Buka tautan berikut dalam %d menit:\n\n%s/reset-password?token=%s\n\n"+
+		"Abaikan email ini jika Anda tidak memintanya.",
+		user.Name, int(PasswordResetTTL.Minutes()), os.Getenv("CLIENT_URL"), token)
+	go func(staffID int, email string) {
+		if err := notifier.Send(email, "Reset kata sandi Warmindo", body); err != nil {
+			// Don't reveal delivery problems to the caller, the admin can check the log
+			log.Printf("password reset: failed to notify staff %d: %v", staffID, err)
+		}
+	}(user.ID, user.Email)
+
+	return c.JSON(response)
+}
+
+// ResetPassword sets a new password with a reset token and signs the user out
+// of every session.
+func ResetPassword(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Permintaan tidak valid"}})
+	}
+	if len(req.Password) < 4 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Invalid password, Password should be more than 4 characters"}})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	defer tx.Rollback()
+
+	var resetID, staffID int
+	err = tx.QueryRow(`
+	SELECT id, staff_id FROM password_resets
+	WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+	FOR UPDATE`, utils.HashToken(req.Token)).Scan(&resetID, &staffID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Tautan reset tidak valid atau sudah kedaluwarsa"}})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	user := db.User{Password: req.Password}
+	if err := user.HashPassword(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Gagal mengenkripsi kata sandi"}})
+	}
+
+	if _, err := tx.Exec("UPDATE staffs SET password = $1, updated_at = NOW() WHERE id = $2", user.Password, staffID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE id = $1", resetID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if err := db.RevokeStaffSessions(tx, staffID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Kata sandi berhasil diatur ulang, silakan masuk kembali"})
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// CreatePayment settles every unpaid line of an order code in one payment,
+// marks them paid and closes the customer session. Cash is only taken
+// during an open shift and goes into that shift's drawer; other methods are
+// tied to the shift when one is open.
+func CreatePayment(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		OrderCode string `json:"order_code"`
+		Method    string `json:"method"`
+		Tendered  int    `json:"tendered"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	req.OrderCode = strings.TrimSpace(req.OrderCode)
+	if req.OrderCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kode pesanan wajib diisi"})
+	}
+	if !containsString(db.PaymentMethods, req.Method) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Metode pembayaran harus " + strings.Join(db.PaymentMethods, ", ")})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	shiftID, err := lockOpenShift(tx, identity.UserID, identity.OutletID, false)
+	if err == errNoOpenShift && req.Method != db.PaymentCash {
+		err = nil
+	}
+	if err == errNoOpenShift {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Buka shift terlebih dahulu untuk menerima pembayaran tunai"})
+	}
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	// Lock the unpaid lines so they can't be paid twice
+	rows, err := tx.Query(`
+	SELECT o.id, o.amount * o.unit_price
+	FROM orders o
+	WHERE o.order_code = $1 AND o.outlet_id = $2 AND o.status_id <> $3 AND o.cancelled_at IS NULL
+	FOR UPDATE OF o`, req.OrderCode, identity.OutletID, db.StatusPaid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	var lineIDs []int64
+	amount := 0
+	for rows.Next() {
+		var id int64
+		var total int
+		if err := rows.Scan(&id, &total); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		lineIDs = append(lineIDs, id)
+		amount += total
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(lineIDs) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tidak ada tagihan yang belum dibayar untuk kode pesanan ini"})
+	}
+
+	payment := db.Payment{OutletID: identity.OutletID, OrderCode: req.OrderCode, Method: req.Method, Amount: amount, Tendered: amount, ShiftID: shiftID, StaffID: identity.UserID}
+	if req.Method == db.PaymentCash && req.Tendered != 0 {
+		change, ok := cashChange(amount, req.Tendered)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Uang yang diterima kurang dari total tagihan", "amount": amount})
+		}
+		payment.Tendered = req.Tendered
+		payment.Change = change
+	}
+
+	err = tx.QueryRow(db.CreatePaymentQuery, payment.OutletID, payment.OrderCode, payment.Method, payment.Amount,
+		payment.Tendered, payment.Change, payment.ShiftID, payment.StaffID).Scan(&payment.ID, &payment.CreatedAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := tx.Exec("UPDATE orders SET payment_id = $1 WHERE id = ANY($2)", payment.ID, pq.Array(lineIDs)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := tx.Exec(db.UpdateOrderStatusByCodeQuery, db.StatusPaid, req.OrderCode, identity.OutletID, identity.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := tx.Exec("UPDATE customers SET active = false, end_date = NOW(), closed_reason = $2 WHERE order_code = $1 AND outlet_id = $3 AND active = true", req.OrderCode, db.SessionClosedPaid, identity.OutletID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "payment": payment})
+}
+
+// cashChange is the change given back when tendered is handed over for a
+// bill of amount; ok is false when tendered falls short
+func cashChange(amount, tendered int) (change int, ok bool) {
+	return tendered - amount, tendered >= amount
+}
+
+// paymentsReport is an outlet's payments and refunds over a range of days
+type paymentsReport struct {
+	Total    int                `json:"total"`
+	Refunded int                `json:"refunded"`
+	Methods  []db.MethodTotal   `json:"by_method"`
+	Days     []db.DailyPayments `json:"days"`
+}
+
+// add counts payments, or refunds, of one method on one day
+func (r *paymentsReport) add(day string, total db.MethodTotal) {
+	i := sort.Search(len(r.Days), func(i int) bool { return r.Days[i].Date >= day })
+	if i == len(r.Days) || r.Days[i].Date != day {
+		r.Days = append(r.Days, db.DailyPayments{})
+		copy(r.Days[i+1:], r.Days[i:])
+		r.Days[i] = db.DailyPayments{Date: day, Methods: []db.MethodTotal{}}
+	}
+	d := &r.Days[i]
+	d.Total += total.Amount
+	d.Refunded += total.Refunded
+	d.Methods = addMethodTotal(d.Methods, total)
+
+	r.Methods = addMethodTotal(r.Methods, total)
+	r.Total += total.Amount
+	r.Refunded += total.Refunded
+}
+
+func addMethodTotal(totals []db.MethodTotal, total db.MethodTotal) []db.MethodTotal {
+	for i := range totals {
+		if totals[i].Method == total.Method {
+			totals[i].Count += total.Count
+			totals[i].Amount += total.Amount
+			totals[i].Refunded += total.Refunded
+			return totals
+		}
+	}
+	return append(totals, total)
+}
+
+// GetPaymentsReport sums the current outlet's payments and refunds over
+// ?date= or ?from=&to= per method and per day. Refunds count on the day they
+// were given. ?format= exports it as a file.
+func GetPaymentsReport(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+	from, to, err := reportRange(c, dbConn, outletID)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	rows, err := dbConn.Query(`
+	WITH entries AS (
+		SELECT p.created_at, p.method, p.amount, 0 AS refunded
+		FROM payments p
+		WHERE p.outlet_id = $1
+		UNION ALL
+		SELECT r.created_at, p.method, 0, r.amount
+		FROM refunds r
+		JOIN payments p ON p.id = r.payment_id
+		WHERE r.outlet_id = $1
+	)
+	SELECT ((e.created_at AT TIME ZONE current_setting('TimeZone')) AT TIME ZONE s.timezone)::date::text AS day,
+	       e.method, COUNT(*) FILTER (WHERE e.amount > 0), SUM(e.amount), SUM(e.refunded)
+	FROM entries e
+	JOIN settings s ON s.outlet_id = $1
+	WHERE ((e.created_at AT TIME ZONE current_setting('TimeZone')) AT TIME ZONE s.timezone)::date BETWEEN $2::date AND $3::date
+	GROUP BY 1, 2
+	ORDER BY 1, 2`, outletID, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	report := paymentsReport{Methods: []db.MethodTotal{}, Days: []db.DailyPayments{}}
+	for _, method := range db.PaymentMethods {
+		report.Methods = append(report.Methods, db.MethodTotal{Method: method})
+	}
+	for rows.Next() {
+		var day string
+		var total db.MethodTotal
+		if err := rows.Scan(&day, &total.Method, &total.Count, &total.Amount, &total.Refunded); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		report.add(day, total)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		return sendExport(c, format, "laporan-pembayaran-"+from+"-"+to, "Laporan Pembayaran "+periodLabel(from, to), report.export)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"outlet_id": outletID,
+		"from":      from,
+		"to":        to,
+		"total":     report.Total,
+		"refunded":  report.Refunded,
+		"net":       report.Total - report.Refunded,
+		"by_method": report.Methods,
+		"days":      report.Days,
+	})
+}
+
+func (r *paymentsReport) export(w export.Writer) error {
+	columns := []string{"Metode", "Transaksi", "Diterima", "Dikembalikan", "Bersih"}
+	if err := w.Section("Per metode", columns); err != nil {
+		return err
+	}
+	for _, m := range r.Methods {
+		if err := w.Row(m.Method, m.Count, m.Amount, m.Refunded, m.Amount-m.Refunded); err != nil {
+			return err
+		}
+	}
+	if err := w.Row("Total", "", r.Total, r.Refunded, r.Total-r.Refunded); err != nil {
+		return err
+	}
+
+	if err := w.Section("Per hari", append([]string{"Tanggal"}, columns...)); err != nil {
+		return err
+	}
+	for _, d := range r.Days {
+		for _, m := range d.Methods {
+			if err := w.Row(d.Date, m.Method, m.Count, m.Amount, m.Refunded, m.Amount-m.Refunded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"warmindo-api/db"
+)
+
+func TestCashChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     int
+		tendered   int
+		wantChange int
+		wantOK     bool
+	}{
+		{"exact money", 37000, 37000, 0, true},
+		{"change given", 37000, 50000, 13000, true},
+		{"short by one", 37000, 36999, -1, false},
+		{"nothing owed", 0, 10000, 10000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, ok := cashChange(tt.amount, tt.tendered)
+			if ok != tt.wantOK || (ok && change != tt.wantChange) {
+				t.Errorf("cashChange(%d, %d) = %d, %v; want %d, %v", tt.amount, tt.tendered, change, ok, tt.wantChange, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPaymentsReportAdd(t *testing.T) {
+	type entry struct {
+		day   string
+		total db.MethodTotal
+	}
+	entries := []entry{
+		{"2026-10-19", db.MethodTotal{Method: db.PaymentCash, Count: 2, Amount: 50000}},
+		{"2026-10-18", db.MethodTotal{Method: db.PaymentCash, Count: 1, Amount: 20000}},
+		{"2026-10-19", db.MethodTotal{Method: db.PaymentQRIS, Count: 1, Amount: 30000}},
+		{"2026-10-19", db.MethodTotal{Method: db.PaymentCash, Refunded: 5000}},
+	}
+
+	var report paymentsReport
+	for _, e := range entries {
+		report.add(e.day, e.total)
+	}
+
+	if report.Total != 100000 || report.Refunded != 5000 {
+		t.Errorf("total = %d, refunded = %d; want 100000, 5000", report.Total, report.Refunded)
+	}
+	wantMethods := []db.MethodTotal{
+		{Method: db.PaymentCash, Count: 3, Amount: 70000, Refunded: 5000},
+		{Method: db.PaymentQRIS, Count: 1, Amount: 30000},
+	}
+	if !reflect.DeepEqual(report.Methods, wantMethods) {
+		t.Errorf("by method = %+v, want %+v", report.Methods, wantMethods)
+	}
+
+	wantDays := []db.DailyPayments{
+		{Date: "2026-10-18", Total: 20000, Methods: []db.MethodTotal{{Method: db.PaymentCash, Count: 1, Amount: 20000}}},
+		{Date: "2026-10-19", Total: 80000, Refunded: 5000, Methods: []db.MethodTotal{
+			{Method: db.PaymentCash, Count: 2, Amount: 50000, Refunded: 5000},
+			{Method: db.PaymentQRIS, Count: 1, Amount: 30000},
+		}},
+	}
+	if !reflect.DeepEqual(report.Days, wantDays) {
+		t.Errorf("days = %+v, want %+v", report.Days, wantDays)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"database/sql"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetupProfileRoutes sets up the routes a signed-in staff member uses to manage their own account
+func SetupProfileRoutes(app *fiber.App, dbConn *sql.DB) {
+	// Auth is attached per route: a group middleware on "/api/me" would also
+	// match "/api/menus" since fiber mounts it by plain prefix.
+	authenticated := middleware.AuthMiddleware(dbConn)
+
+	meAPI := app.Group("/api/me")
+	meAPI.Get("/", authenticated, func(c *fiber.Ctx) error {
+		return GetProfile(c, dbConn)
+	})
+	meAPI.Put("/", authenticated, func(c *fiber.Ctx) error {
+		return UpdateProfile(c, dbConn)
+	})
+	meAPI.Put("/password", authenticated, func(c *fiber.Ctx) error {
+		return ChangePassword(c, dbConn)
+	})
+}
+
+// GetProfile returns the account of the current user
+func GetProfile(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	user, err := db.GetUserByID(dbConn, identity.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pengguna tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	user.Password = ""
+
+	var roleName string
+	if err := dbConn.QueryRow("SELECT name FROM roles WHERE id = $1", user.RoleID).Scan(&roleName); err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "user": user, "role_name": roleName, "permissions": identity.Permissions})
+}
+
+// UpdateProfile lets the current user edit their own contact details. Fields
+// left out keep their value; phone can be cleared by sending it empty. The
+// role and password cannot be changed here.
+func UpdateProfile(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	var req struct {
+		Email    string  `json:"email"`
+		Name     string  `json:"name"`
+		Username string  `json:"username"`
+		Phone    *string `json:"phone"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	user, err := db.GetUserByID(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+
+	if req.Email != "" {
+		user.Email = req.Email
+	}
+	if req.Name != "" {
+		user.Name = req.Name
+	}
+	if req.Username != "" {
+		user.Username = req.Username
+	}
+	if req.Phone != nil {
+		user.Phone = *req.Phone
+	}
+
+	// ValidateUser also checks the password, which is the stored hash here
+	validationErrors := utils.ValidateUser(*user)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": validationErrors})
+	}
+
+	_, err = dbConn.Exec("UPDATE staffs SET email = $1, name = $2, username = $3, phone = $4, updated_at = NOW() WHERE id = $5",
+		user.Email, user.Name, user.Username, user.Phone, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal memperbarui profil"})
+	}
+
+	user.Password = ""
+	return c.JSON(fiber.Map{"success": true, "message": "Profil berhasil diperbarui", "user": user})
+}
+
+// ChangePassword replaces the current user's password after checking the old
+// one, and signs out every other session.
+func ChangePassword(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if len(req.NewPassword) < 4 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": []string{"Invalid password, Password should be more than 4 characters"}})
+	}
+
+	user, err := db.GetUserByID(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+
+	if !utils.ComparePassword(user.Password, req.OldPassword) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Kata sandi lama salah"})
+	}
+
+	user.Password = req.NewPassword
+	if err := user.HashPassword(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal mengenkripsi kata sandi"})
+	}
+
+	if _, err := dbConn.Exec("UPDATE staffs SET password = $1, updated_at = NOW() WHERE id = $2", user.Password, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal memperbarui kata sandi"})
+	}
+
+	if err := db.RevokeOtherStaffSessions(dbConn, user.ID, identity.SessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal mencabut sesi lain"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Kata sandi berhasil diperbarui"})
+}
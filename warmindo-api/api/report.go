@@ -0,0 +1,233 @@
+package api
+
+import (
+	"database/sql"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxReportDays is the longest range a report covers in one request
+const MaxReportDays = 366
+
+// SetupReportRoutes sets up the admin reporting endpoints
+func SetupReportRoutes(app *fiber.App, dbConn *sql.DB) {
+	canRead := middleware.RequirePermission(dbConn, db.PermissionReportsRead)
+
+	reportAPI := app.Group("/api/reports")
+	reportAPI.Get("/sales", canRead, func(c *fiber.Ctx) error {
+		return GetSalesReport(c, dbConn)
+	})
+	reportAPI.Get("/menus", canRead, func(c *fiber.Ctx) error {
+		return GetMenuAnalytics(c, dbConn)
+	})
+	reportAPI.Get("/kitchen", canRead, func(c *fiber.Ctx) error {
+		return GetKitchenReport(c, dbConn)
+	})
+	reportAPI.Get("/payments", canRead, func(c *fiber.Ctx) error {
+		return GetPaymentsReport(c, dbConn)
+	})
+	reportAPI.Get("/voids", canRead, func(c *fiber.Ctx) error {
+		return GetVoidsReport(c, dbConn)
+	})
+}
+
+// reportRange reads ?date= or ?from=&to= (YYYY-MM-DD, inclusive) in the
+// outlet's time zone. Without either the report covers today.
+func reportRange(c *fiber.Ctx, dbConn *sql.DB, outletID int) (string, string, error) {
+	var timezone string
+	if err := dbConn.QueryRow("SELECT timezone FROM settings WHERE outlet_id = $1", outletID).Scan(&timezone); err != nil {
+		return "", "", err
+	}
+	today := time.Now().In(utils.StoreLocation(timezone)).Format("2006-01-02")
+
+	from, to := c.Query("from"), c.Query("to")
+	if date := c.Query("date"); date != "" {
+		from, to = date, date
+	}
+	if from == "" {
+		from = today
+	}
+	if to == "" {
+		to = from
+	}
+
+	start, err1 := time.Parse("2006-01-02", from)
+	end, err2 := time.Parse("2006-01-02", to)
+	if err1 != nil || err2 != nil {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "Tanggal harus berformat YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "Tanggal akhir tidak boleh sebelum tanggal awal")
+	}
+	if end.Sub(start) >= MaxReportDays*24*time.Hour {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "Rentang laporan maksimal 366 hari")
+	}
+	return from, to, nil
+}
+
+// salesReport is the sales report of an outlet over a range of days
+type salesReport struct {
+	Summary    db.SalesFigures         `json:"summary"`
+	Days       []db.DailySales         `json:"days"`
+	Categories []db.CategorySales      `json:"by_category"`
+	Payments   []db.PaymentStatusSales `json:"by_payment_status"`
+}
+
+// GetSalesReport sums up the current outlet's sales for a day or a range of
+// days: totals, a line per day, and breakdowns by category and by whether the
+// lines have been paid. ?format= exports it as a file.
+func GetSalesReport(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+	from, to, err := reportRange(c, dbConn, outletID)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	report, err := loadSalesReport(dbConn, outletID, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		return sendExport(c, format, "laporan-penjualan-"+from+"-"+to, "Laporan Penjualan "+periodLabel(from, to), report.export)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":           true,
+		"outlet_id":         outletID,
+		"from":              from,
+		"to":                to,
+		"summary":           report.Summary,
+		"days":              report.Days,
+		"by_category":       report.Categories,
+		"by_payment_status": report.Payments,
+	})
+}
+
+func loadSalesReport(dbConn *sql.DB, outletID int, from, to string) (*salesReport, error) {
+	args := []interface{}{outletID, from, to, db.StatusPaid}
+	report := salesReport{Days: []db.DailySales{}, Categories: []db.CategorySales{}, Payments: []db.PaymentStatusSales{}}
+
+	// One pass gives the days and, as the grouping set without a day, the
+	// totals, where an order code spanning midnight is counted once
+	rows, err := dbConn.Query(db.SalesLinesQuery+`
+	SELECT day::text, `+db.SalesFiguresSQL+`
+	FROM lines
+	WHERE day BETWEEN $2::date AND $3::date
+	GROUP BY GROUPING SETS ((day), ())
+	ORDER BY day NULLS FIRST`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day sql.NullString
+		var f db.SalesFigures
+		if err := rows.Scan(&day, &f.GrossSales, &f.OrderCodes, &f.ItemsSold, &f.AverageTicket); err != nil {
+			return nil, err
+		}
+		if !day.Valid {
+			report.Summary = f
+			continue
+		}
+		report.Days = append(report.Days, db.DailySales{Date: day.String, SalesFigures: f})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	categoryRows, err := dbConn.Query(db.SalesLinesQuery+`
+	SELECT category_id, category_name, `+db.SalesFiguresSQL+`
+	FROM lines
+	WHERE day BETWEEN $2::date AND $3::date
+	GROUP BY category_id, category_name
+	ORDER BY 3 DESC, category_name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer categoryRows.Close()
+
+	for categoryRows.Next() {
+		var s db.CategorySales
+		if err := categoryRows.Scan(&s.CategoryID, &s.CategoryName, &s.GrossSales, &s.OrderCodes, &s.ItemsSold, &s.AverageTicket); err != nil {
+			return nil, err
+		}
+		report.Categories = append(report.Categories, s)
+	}
+	if err := categoryRows.Err(); err != nil {
+		return nil, err
+	}
+
+	paymentRows, err := dbConn.Query(db.SalesLinesQuery+`
+	SELECT CASE WHEN paid THEN '`+db.PaymentPaid+`' ELSE '`+db.PaymentUnpaid+`' END, `+db.SalesFiguresSQL+`
+	FROM lines
+	WHERE day BETWEEN $2::date AND $3::date
+	GROUP BY paid
+	ORDER BY paid DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer paymentRows.Close()
+
+	for paymentRows.Next() {
+		var s db.PaymentStatusSales
+		if err := paymentRows.Scan(&s.PaymentStatus, &s.GrossSales, &s.OrderCodes, &s.ItemsSold, &s.AverageTicket); err != nil {
+			return nil, err
+		}
+		report.Payments = append(report.Payments, s)
+	}
+	return &report, paymentRows.Err()
+}
+
+var salesFigureColumns = []string{"Penjualan kotor", "Kode pesanan", "Item terjual", "Rata-rata transaksi"}
+
+func salesFigureCells(f db.SalesFigures) []interface{} {
+	return []interface{}{f.GrossSales, f.OrderCodes, f.ItemsSold, f.AverageTicket}
+}
+
+func (r *salesReport) export(w export.Writer) error {
+	if err := w.Section("Ringkasan", salesFigureColumns); err != nil {
+		return err
+	}
+	if err := w.Row(salesFigureCells(r.Summary)...); err != nil {
+		return err
+	}
+
+	if err := w.Section("Per hari", append([]string{"Tanggal"}, salesFigureColumns...)); err != nil {
+		return err
+	}
+	for _, d := range r.Days {
+		if err := w.Row(append([]interface{}{d.Date}, salesFigureCells(d.SalesFigures)...)...); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Section("Per kategori", append([]string{"Kategori"}, salesFigureColumns...)); err != nil {
+		return err
+	}
+	for _, cat := range r.Categories {
+		if err := w.Row(append([]interface{}{cat.CategoryName}, salesFigureCells(cat.SalesFigures)...)...); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Section("Per status pembayaran", append([]string{"Status pembayaran"}, salesFigureColumns...)); err != nil {
+		return err
+	}
+	for _, p := range r.Payments {
+		if err := w.Row(append([]interface{}{p.PaymentStatus}, salesFigureCells(p.SalesFigures)...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
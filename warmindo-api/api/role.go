@@ -2,20 +2,50 @@ package api
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
 	"warmindo-api/db"
+	"warmindo-api/middleware"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 )
 
 func SetupRoleRoutes(app *fiber.App, dbConn *sql.DB) {
+	canManage := middleware.RequirePermission(dbConn, db.PermissionRolesManage)
+
 	roleAPI := app.Group("/api/roles")
-	roleAPI.Get("/", func(c *fiber.Ctx) error {
+	roleAPI.Get("/", middleware.RequirePermission(dbConn, db.PermissionRolesRead, db.PermissionUsersWrite, db.PermissionRolesManage), func(c *fiber.Ctx) error {
 		return GetRoles(c, dbConn)
 	})
+	roleAPI.Get("/:id", canManage, func(c *fiber.Ctx) error {
+		return GetRoleByID(c, dbConn)
+	})
+	roleAPI.Post("/", canManage, func(c *fiber.Ctx) error {
+		return CreateRole(c, dbConn)
+	})
+	roleAPI.Put("/:id", canManage, func(c *fiber.Ctx) error {
+		return UpdateRole(c, dbConn)
+	})
+	roleAPI.Put("/:id/permissions", canManage, func(c *fiber.Ctx) error {
+		return SetRolePermissions(c, dbConn)
+	})
+	roleAPI.Delete("/:id", canManage, func(c *fiber.Ctx) error {
+		return DeleteRole(c, dbConn)
+	})
+
+	app.Get("/api/permissions", canManage, func(c *fiber.Ctx) error {
+		return GetPermissions(c, dbConn)
+	})
+}
+
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
 }
 
 func GetRoles(c *fiber.Ctx, dbConn *sql.DB) error {
-	rows, err := dbConn.Query("SELECT id, name, created_at, updated_at FROM roles")
+	rows, err := dbConn.Query("SELECT id, name, require_2fa, created_at, updated_at FROM roles ORDER BY id")
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -24,11 +54,245 @@ func GetRoles(c *fiber.Ctx, dbConn *sql.DB) error {
 	var roles []db.Role
 	for rows.Next() {
 		var role db.Role
-		if err := rows.Scan(&role.ID, &role.Name, &role.CreatedAt, &role.UpdatedAt); err != nil {
+		if err := rows.Scan(&role.ID, &role.Name, &role.Require2FA, &role.CreatedAt, &role.UpdatedAt); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 		roles = append(roles, role)
 	}
 
+	for i := range roles {
+		roles[i].Permissions, err = db.GetRolePermissions(dbConn, roles[i].ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	return c.JSON(fiber.Map{"success": true, "roles": roles})
 }
+
+// GetRoleByID retrieves a role together with its permissions
+func GetRoleByID(c *fiber.Ctx, dbConn *sql.DB) error {
+	var role db.Role
+	err := dbConn.QueryRow(db.GetRoleByIDQuery, c.Params("id")).Scan(&role.ID, &role.Name, &role.Require2FA, &role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Peran tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	role.Permissions, err = db.GetRolePermissions(dbConn, role.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "role": role})
+}
+
+// GetPermissions lists every permission that can be assigned to a role
+func GetPermissions(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query("SELECT id, code, COALESCE(description, '') FROM permissions ORDER BY code")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var permissions []db.Permission
+	for rows.Next() {
+		var permission db.Permission
+		if err := rows.Scan(&permission.ID, &permission.Code, &permission.Description); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "permissions": permissions})
+}
+
+// CreateRole creates a role, optionally with an initial set of permissions
+func CreateRole(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nama peran wajib diisi"})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var roleID int
+	if err := tx.QueryRow(db.CreateRoleQuery, req.Name).Scan(&roleID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := replaceRolePermissions(tx, roleID, req.Permissions); err != nil {
+		return respondError(c, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "id": roleID})
+}
+
+// UpdateRole renames a role
+func UpdateRole(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nama peran wajib diisi"})
+	}
+
+	res, err := dbConn.Exec(db.UpdateRoleQuery, req.Name, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Peran tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// SetRolePermissions replaces the full permission set of a role
+func SetRolePermissions(c *fiber.Ctx, dbConn *sql.DB) error {
+	roleID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID peran tidak valid"})
+	}
+
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM roles WHERE id = $1)", roleID).Scan(&exists); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Peran tidak ditemukan"})
+	}
+
+	if !containsString(req.Permissions, db.PermissionRolesManage) {
+		if err := ensureOtherRoleManager(tx, roleID); err != nil {
+			return respondError(c, err)
+		}
+	}
+
+	if err := replaceRolePermissions(tx, roleID, req.Permissions); err != nil {
+		return respondError(c, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// DeleteRole deletes a role that no staff member uses
+func DeleteRole(c *fiber.Ctx, dbConn *sql.DB) error {
+	roleID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID peran tidak valid"})
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var staffCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM staffs WHERE role_id = $1", roleID).Scan(&staffCount); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if staffCount > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Peran masih digunakan oleh staf", "staff_count": staffCount})
+	}
+
+	if err := ensureOtherRoleManager(tx, roleID); err != nil {
+		return respondError(c, err)
+	}
+
+	res, err := tx.Exec(db.DeleteRoleQuery, roleID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Peran masih digunakan oleh staf"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Peran tidak ditemukan"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// ensureOtherRoleManager fails when roleID is the only role left that holds
+// roles:manage, so nobody can lock themselves out of role management. The
+// table lock serialises concurrent permission changes.
+func ensureOtherRoleManager(tx *sql.Tx, roleID int) error {
+	if _, err := tx.Exec("LOCK TABLE role_permissions IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	var holds bool
+	var others int
+	err := tx.QueryRow(`
+	SELECT COALESCE(BOOL_OR(rp.role_id = $1), false), COUNT(*) FILTER (WHERE rp.role_id <> $1)
+	FROM role_permissions rp
+	JOIN permissions p ON p.id = rp.permission_id
+	WHERE p.code = $2`, roleID, db.PermissionRolesManage).Scan(&holds, &others)
+	if err != nil {
+		return err
+	}
+
+	if holds && others == 0 {
+		return fiber.NewError(fiber.StatusConflict, "Tidak dapat menghapus peran terakhir yang dapat mengelola peran")
+	}
+	return nil
+}
+
+// replaceRolePermissions swaps the permissions of a role for the given codes
+func replaceRolePermissions(tx *sql.Tx, roleID int, codes []string) error {
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = $1", roleID); err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+
+	res, err := tx.Exec(`
+	INSERT INTO role_permissions (role_id, permission_id)
+	SELECT $1, id FROM permissions WHERE code = ANY($2)`, roleID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	if inserted, _ := res.RowsAffected(); int(inserted) != len(uniqueStrings(codes)) {
+		return fiber.NewError(fiber.StatusBadRequest, "Izin tidak dikenal")
+	}
+	return nil
+}
@@ -4,13 +4,23 @@ package api
 
 import (
 	"database/sql"
+	"warmindo-api/notify"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(app *fiber.App, dbConn *sql.DB) {
+func SetupRoutes(app *fiber.App, dbConn *sql.DB, notifier notify.Notifier) {
 	// Set up user routes
-	SetupUserRoutes(app, dbConn)
+	SetupUserRoutes(app, dbConn, notifier)
+
+	// Set up current user routes
+	SetupProfileRoutes(app, dbConn)
+
+	// Set up POS terminal routes
+	SetupTerminalRoutes(app, dbConn)
+
+	// Set up two-factor authentication routes
+	SetupTwoFactorRoutes(app, dbConn)
 
 	// Set up menu routes
 	SetupMenuRoutes(app, dbConn)
@@ -24,11 +34,38 @@ func SetupRoutes(app *fiber.App, dbConn *sql.DB) {
 	// Set up role routes
 	SetupRoleRoutes(app, dbConn)
 
+	// Set up outlet routes
+	SetupOutletRoutes(app, dbConn)
+
 	// Set up status routes
 	SetupStatusRoutes(app, dbConn)
 
 	SetupSettingsRoutes(app, dbConn)
 
+	// Set up opening hours and store status routes
+	SetupStoreRoutes(app, dbConn)
+
+	// Set up reporting routes
+	SetupReportRoutes(app, dbConn)
+
+	// Set up cashier shift and payment routes
+	SetupShiftRoutes(app, dbConn)
+
+	// Set up geofence routes
+	SetupGeofenceRoutes(app, dbConn)
+
+	// Set up table QR code routes (before the table routes so /qr isn't taken as an :id)
+	SetupTableQRRoutes(app, dbConn)
+
+	// Set up table management routes
+	SetupTableRoutes(app, dbConn)
+
+	// Set up customer session management routes
+	SetupSessionRoutes(app, dbConn)
+
 	// Set up customer routes
 	SetupCustomerRoutes(app, dbConn)
+
+	// Set up trash listing and restore routes
+	SetupTrashRoutes(app, dbConn)
 }
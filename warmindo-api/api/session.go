@@ -0,0 +1,230 @@
+package api
+
+import (
+	"database/sql"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetupSessionRoutes sets up the staff endpoints that manage customer sessions
+func SetupSessionRoutes(app *fiber.App, dbConn *sql.DB) {
+	canRead := middleware.RequirePermission(dbConn, db.PermissionOrdersRead)
+	canUpdate := middleware.RequirePermission(dbConn, db.PermissionOrdersUpdate)
+
+	sessionAPI := app.Group("/api/sessions")
+	sessionAPI.Get("/", canRead, func(c *fiber.Ctx) error {
+		return GetSessions(c, dbConn)
+	})
+	sessionAPI.Post("/", canUpdate, func(c *fiber.Ctx) error {
+		return OpenSession(c, dbConn)
+	})
+	sessionAPI.Post("/:order_code/close", canUpdate, func(c *fiber.Ctx) error {
+		return CloseSession(c, dbConn)
+	})
+	sessionAPI.Post("/:order_code/reopen", canUpdate, func(c *fiber.Ctx) error {
+		return ReopenSession(c, dbConn)
+	})
+	sessionAPI.Delete("/:order_code", middleware.RequirePermission(dbConn, db.PermissionOrdersDelete), func(c *fiber.Ctx) error {
+		return DeleteSession(c, dbConn)
+	})
+}
+
+// GetSessions lists the current outlet's customer sessions. ?status= is
+// active (default), closed or all; ?table= narrows the list to one table.
+func GetSessions(c *fiber.Ctx, dbConn *sql.DB) error {
+	status := c.Query("status", "active")
+	if status != "active" && status != "closed" && status != "all" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status harus active, closed atau all"})
+	}
+
+	rows, err := dbConn.Query(`
+	SELECT cu.order_code, cu.table_number, COALESCE(t.label, ''), cu.active,
+	       cu.start_date::text, cu.end_date::text,
+	       COALESCE(cu.closed_reason, ''), COALESCE(st.name, ''), COALESCE(cu.merged_into, ''),
+	       COUNT(o.id),
+	       COALESCE(SUM(o.amount * o.unit_price) FILTER (WHERE o.status_id <> $1 AND o.cancelled_at IS NULL), 0),
+	       MAX(o.order_date)::text,
+	       CASE WHEN cu.active AND s.session_idle_minutes > 0 AND COUNT(o.id) = 0
+	            THEN (COALESCE(cu.reopened_at, cu.start_date) + make_interval(mins => s.session_idle_minutes))::text
+	       END
+	FROM customers cu
+	JOIN settings s ON s.outlet_id = cu.outlet_id
+	LEFT JOIN tables t ON t.outlet_id = cu.outlet_id AND t.number = cu.table_number
+	LEFT JOIN staffs st ON st.id = cu.closed_by
+	LEFT JOIN orders o ON o.order_code = cu.order_code
+	WHERE cu.outlet_id = $4 AND cu.deleted_at IS NULL
+	  AND ($2 = 'all' OR cu.active = ($2 = 'active'))
+	  AND ($3 = 0 OR cu.table_number = $3)
+	GROUP BY cu.id, t.label, st.name, s.session_idle_minutes
+	ORDER BY cu.start_date DESC
+	LIMIT 200`, db.StatusPaid, status, c.QueryInt("table", 0), middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	sessions := []db.CustomerSession{}
+	for rows.Next() {
+		var s db.CustomerSession
+		if err := rows.Scan(&s.OrderCode, &s.TableNumber, &s.TableLabel, &s.Active, &s.StartDate, &s.EndDate,
+			&s.ClosedReason, &s.ClosedBy, &s.MergedInto, &s.OrderLines, &s.OutstandingTotal, &s.LastOrderAt, &s.IdleClosesAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		sessions = append(sessions, s)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "sessions": sessions})
+}
+
+// OpenSession lets staff open a session on one of their outlet's tables for a
+// diner whose phone can't share its location. There is no geofence check;
+// opened_by records who vouched for the diner.
+func OpenSession(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		TableNumber int `json:"table_number"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.TableNumber < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "table_number wajib diisi"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	table, err := db.GetTableByNumber(dbConn, identity.OutletID, req.TableNumber)
+	if err == sql.ErrNoRows || (err == nil && !table.Active) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Meja tidak ditemukan atau tidak aktif"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	orderCode, accessToken, err := createCustomerSession(dbConn, identity.OutletID, req.TableNumber, identity.UserID)
+	if err == errTableOccupied {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Meja sudah memiliki kode pesanan aktif"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success":      true,
+		"order_code":   orderCode,
+		"access_token": accessToken,
+		"table_number": table.Number,
+		"table_label":  table.Label,
+	})
+}
+
+// CloseSession force-closes an open session and frees its table. Unpaid
+// orders stay as they are; their total is returned so the cashier can follow up.
+func CloseSession(c *fiber.Ctx, dbConn *sql.DB) error {
+	orderCode := c.Params("order_code")
+	identity := middleware.CurrentIdentity(c)
+
+	var tableNumber int
+	err := dbConn.QueryRow(`
+	UPDATE customers
+	SET active = false, end_date = NOW(), closed_reason = $1, closed_by = $2
+	WHERE order_code = $3 AND outlet_id = $4 AND active = true
+	RETURNING table_number`, db.SessionClosedManual, identity.UserID, orderCode, identity.OutletID).Scan(&tableNumber)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sesi aktif tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var outstanding int
+	err = dbConn.QueryRow(`
+	SELECT COALESCE(SUM(o.amount * o.unit_price), 0)
+	FROM orders o
+	WHERE o.order_code = $1 AND o.status_id <> $2 AND o.cancelled_at IS NULL`, orderCode, db.StatusPaid).Scan(&outstanding)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "order_code": orderCode, "table_number": tableNumber, "outstanding_total": outstanding})
+}
+
+// ReopenSession reopens a closed session on its table, provided the table is
+// still active and nobody else has sat down there. Merged sessions stay closed;
+// their orders live under the target's order code.
+func ReopenSession(c *fiber.Ctx, dbConn *sql.DB) error {
+	orderCode := c.Params("order_code")
+	outletID := middleware.CurrentIdentity(c).OutletID
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var tableNumber int
+	var active bool
+	var mergedInto string
+	err = tx.QueryRow("SELECT table_number, active, COALESCE(merged_into, '') FROM customers WHERE order_code = $1 AND outlet_id = $2 AND deleted_at IS NULL FOR UPDATE", orderCode, outletID).
+		Scan(&tableNumber, &active, &mergedInto)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sesi tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if active {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Sesi masih aktif"})
+	}
+	if mergedInto != "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Sesi sudah digabung ke " + mergedInto})
+	}
+
+	if err := lockFreeTable(tx, outletID, tableNumber); err != nil {
+		return respondError(c, err)
+	}
+
+	_, err = tx.Exec(`
+	UPDATE customers
+	SET active = true, end_date = NULL, closed_reason = NULL, closed_by = NULL, reopened_at = NOW()
+	WHERE order_code = $1`, orderCode)
+	if err != nil {
+		return tableSessionError(c, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return tableSessionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "order_code": orderCode, "table_number": tableNumber})
+}
+
+// DeleteSession moves a closed session to the trash. Only sessions without
+// order lines, or whose lines were all cancelled, can go: the rest are part
+// of the outlet's sales.
+func DeleteSession(c *fiber.Ctx, dbConn *sql.DB) error {
+	orderCode := c.Params("order_code")
+	identity := middleware.CurrentIdentity(c)
+
+	var active, hasOrders bool
+	err := dbConn.QueryRow(`
+	SELECT cu.active, EXISTS (SELECT 1 FROM orders o WHERE o.order_code = cu.order_code AND o.cancelled_at IS NULL)
+	FROM customers cu
+	WHERE cu.order_code = $1 AND cu.outlet_id = $2 AND cu.deleted_at IS NULL`, orderCode, identity.OutletID).Scan(&active, &hasOrders)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sesi tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if active {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Sesi masih aktif"})
+	}
+	if hasOrders {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Sesi masih memiliki pesanan"})
+	}
+
+	_, err = dbConn.Exec("UPDATE customers SET deleted_at = NOW(), deleted_by = $3 WHERE order_code = $1 AND outlet_id = $2 AND deleted_at IS NULL", orderCode, identity.OutletID, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
@@ -11,33 +11,47 @@ import (
 
 // SetupSettingsRoutes sets up the routes for settings with authentication middleware
 func SetupSettingsRoutes(app *fiber.App, dbConn *sql.DB) {
-	settingsAPI := app.Group("/api/settings", middleware.AuthMiddleware(1))
-	settingsAPI.Get("/", func(c *fiber.Ctx) error {
+	settingsAPI := app.Group("/api/settings")
+	settingsAPI.Get("/", middleware.RequirePermission(dbConn, db.PermissionSettingsRead), func(c *fiber.Ctx) error {
 		return GetSettings(c, dbConn)
 	})
-	settingsAPI.Put("/", func(c *fiber.Ctx) error {
+	settingsAPI.Put("/", middleware.RequirePermission(dbConn, db.PermissionSettingsWrite), func(c *fiber.Ctx) error {
 		return CreateOrUpdateSettings(c, dbConn) // Updated to use PUT method for editing
 	})
 }
 
-// CreateOrUpdateSettings handles updating settings with a fixed id of 1
+// CreateOrUpdateSettings handles updating the current outlet's settings
 func CreateOrUpdateSettings(c *fiber.Ctx, dbConn *sql.DB) error {
-	var settings db.Settings
+	var settings struct {
+		db.Settings
+		// Left untouched when an older client doesn't send it
+		SessionIdleMinutes    *int `json:"session_idle_minutes"`
+		VoidApprovalThreshold *int `json:"void_approval_threshold"`
+	}
 	if err := c.BodyParser(&settings); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
+	if settings.SessionIdleMinutes != nil && *settings.SessionIdleMinutes < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "session_idle_minutes tidak boleh negatif"})
+	}
+	if settings.VoidApprovalThreshold != nil && *settings.VoidApprovalThreshold < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "void_approval_threshold tidak boleh negatif"})
+	}
 
-	// Update settings with id = 1
+	// Every outlet has exactly one settings row, made with the outlet
 	query := `
 		UPDATE settings
 		SET total_table = $1,
 			latitude = $2,
 			longitude = $3,
-			radius = $4
-		WHERE id = 1;
+			radius = $4,
+			session_idle_minutes = COALESCE($5, session_idle_minutes),
+			void_approval_threshold = COALESCE($6, void_approval_threshold)
+		WHERE outlet_id = $7;
 	`
 
-	res, err := dbConn.Exec(query, settings.TotalTable, settings.Latitude, settings.Longitude, settings.Radius)
+	res, err := dbConn.Exec(query, settings.TotalTable, settings.Latitude, settings.Longitude, settings.Radius, settings.SessionIdleMinutes,
+		settings.VoidApprovalThreshold, middleware.CurrentIdentity(c).OutletID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -48,17 +62,19 @@ func CreateOrUpdateSettings(c *fiber.Ctx, dbConn *sql.DB) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	if rowsAffected == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Settings with id 1 not found"})
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Settings not found"})
 	}
 
 	return c.JSON(fiber.Map{"success": true})
 }
 
-// GetSettings handles retrieving settings
+// GetSettings handles retrieving the current outlet's settings
 func GetSettings(c *fiber.Ctx, dbConn *sql.DB) error {
 	var settings db.Settings
 
-	err := dbConn.QueryRow("SELECT total_table, latitude, longitude, radius FROM settings WHERE id = 1").Scan(&settings.TotalTable, &settings.Latitude, &settings.Longitude, &settings.Radius)
+	err := dbConn.QueryRow("SELECT outlet_id, total_table, latitude, longitude, radius, session_idle_minutes, void_approval_threshold FROM settings WHERE outlet_id = $1",
+		middleware.CurrentIdentity(c).OutletID).
+		Scan(&settings.OutletID, &settings.TotalTable, &settings.Latitude, &settings.Longitude, &settings.Radius, &settings.SessionIdleMinutes, &settings.VoidApprovalThreshold)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Optionally handle the case where no settings are found
@@ -0,0 +1,441 @@
+package api
+
+import (
+	"database/sql"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// SetupShiftRoutes sets up cashier shifts and the cash drawer. A shift
+// belongs to the staff member of the token and, for PIN logins, to the
+// terminal it was opened on.
+func SetupShiftRoutes(app *fiber.App, dbConn *sql.DB) {
+	canOperate := middleware.RequirePermission(dbConn, db.PermissionShiftsOperate)
+
+	shiftAPI := app.Group("/api/shifts")
+	shiftAPI.Get("/", middleware.RequirePermission(dbConn, db.PermissionReportsRead), func(c *fiber.Ctx) error {
+		return GetShifts(c, dbConn)
+	})
+	shiftAPI.Post("/", canOperate, func(c *fiber.Ctx) error {
+		return OpenShift(c, dbConn)
+	})
+	shiftAPI.Get("/current", canOperate, func(c *fiber.Ctx) error {
+		return GetCurrentShift(c, dbConn)
+	})
+	shiftAPI.Post("/current/cash-movements", canOperate, func(c *fiber.Ctx) error {
+		return CreateCashMovement(c, dbConn)
+	})
+	shiftAPI.Post("/current/close", canOperate, func(c *fiber.Ctx) error {
+		return CloseShift(c, dbConn)
+	})
+	shiftAPI.Get("/:id", canOperate, func(c *fiber.Ctx) error {
+		return GetShift(c, dbConn)
+	})
+
+	paymentAPI := app.Group("/api/payments")
+	paymentAPI.Post("/", canOperate, func(c *fiber.Ctx) error {
+		return CreatePayment(c, dbConn)
+	})
+	paymentAPI.Get("/:id", canOperate, func(c *fiber.Ctx) error {
+		return GetPayment(c, dbConn)
+	})
+	paymentAPI.Post("/:id/refunds", canOperate, func(c *fiber.Ctx) error {
+		return CreateRefund(c, dbConn)
+	})
+}
+
+// queryer is a *sql.DB or *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// errNoOpenShift is returned when the staff member has no open shift at the
+// current outlet
+var errNoOpenShift = fiber.NewError(fiber.StatusNotFound, "Tidak ada shift yang sedang dibuka")
+
+// lockOpenShift returns the id of the staff member's open shift at the
+// outlet, locked so it can't be closed before tx ends. exclusive is for
+// closing it.
+func lockOpenShift(tx *sql.Tx, staffID, outletID int, exclusive bool) (int, error) {
+	lock := "FOR SHARE"
+	if exclusive {
+		lock = "FOR UPDATE"
+	}
+	var shiftID int
+	err := tx.QueryRow("SELECT id FROM shifts WHERE staff_id = $1 AND outlet_id = $2 AND closed_at IS NULL "+lock, staffID, outletID).Scan(&shiftID)
+	if err == sql.ErrNoRows {
+		return 0, errNoOpenShift
+	}
+	return shiftID, err
+}
+
+// summarizeShift reconciles a shift's drawer from its payments, refunds and
+// cash movements
+func summarizeShift(q queryer, shift db.Shift) (db.ShiftSummary, error) {
+	summary := db.ShiftSummary{OpeningCash: shift.OpeningCash, Payments: []db.MethodTotal{}}
+
+	rows, err := q.Query("SELECT method, COUNT(*), SUM(amount) FROM payments WHERE shift_id = $1 GROUP BY method ORDER BY method", shift.ID)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var total db.MethodTotal
+		if err := rows.Scan(&total.Method, &total.Count, &total.Amount); err != nil {
+			return summary, err
+		}
+		if total.Method == db.PaymentCash {
+			summary.CashSales = total.Amount
+		}
+		summary.Payments = append(summary.Payments, total)
+	}
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	// Refunds given during the shift, whenever the payment was taken
+	refundRows, err := q.Query(`
+	SELECT p.method, SUM(r.amount)
+	FROM refunds r
+	JOIN payments p ON p.id = r.payment_id
+	WHERE r.shift_id = $1
+	GROUP BY p.method
+	ORDER BY p.method`, shift.ID)
+	if err != nil {
+		return summary, err
+	}
+	defer refundRows.Close()
+	for refundRows.Next() {
+		var method string
+		var refunded int
+		if err := refundRows.Scan(&method, &refunded); err != nil {
+			return summary, err
+		}
+		if method == db.PaymentCash {
+			summary.CashRefunds = refunded
+		}
+		found := false
+		for i := range summary.Payments {
+			if summary.Payments[i].Method == method {
+				summary.Payments[i].Refunded = refunded
+				found = true
+			}
+		}
+		if !found {
+			summary.Payments = append(summary.Payments, db.MethodTotal{Method: method, Refunded: refunded})
+		}
+	}
+	if err := refundRows.Err(); err != nil {
+		return summary, err
+	}
+
+	err = q.QueryRow(`
+	SELECT COALESCE(SUM(amount) FILTER (WHERE type = $2), 0), COALESCE(SUM(amount) FILTER (WHERE type = $3), 0)
+	FROM cash_movements WHERE shift_id = $1`, shift.ID, db.CashPayIn, db.CashPayOut).Scan(&summary.PayIns, &summary.PayOuts)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.ExpectedCash = expectedCash(summary)
+	if shift.CountedCash != nil {
+		difference := *shift.CountedCash - summary.ExpectedCash
+		summary.CountedCash = shift.CountedCash
+		summary.Difference = &difference
+		summary.Result = drawerResult(difference)
+	}
+	return summary, nil
+}
+
+// expectedCash is the cash a drawer should hold at the end of a shift
+func expectedCash(s db.ShiftSummary) int {
+	return s.OpeningCash + s.CashSales - s.CashRefunds + s.PayIns - s.PayOuts
+}
+
+// drawerResult tells whether the counted drawer was over or short
+func drawerResult(difference int) string {
+	switch {
+	case difference > 0:
+		return db.DrawerOver
+	case difference < 0:
+		return db.DrawerShort
+	default:
+		return db.DrawerEven
+	}
+}
+
+// shiftReport answers with a shift, its reconciliation and its cash movements
+func shiftReport(c *fiber.Ctx, dbConn *sql.DB, shift db.Shift, status int) error {
+	summary, err := summarizeShift(dbConn, shift)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := dbConn.Query("SELECT id, shift_id, type, amount, reason, staff_id, created_at::text FROM cash_movements WHERE shift_id = $1 ORDER BY created_at, id", shift.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	movements := []db.CashMovement{}
+	for rows.Next() {
+		var m db.CashMovement
+		if err := rows.Scan(&m.ID, &m.ShiftID, &m.Type, &m.Amount, &m.Reason, &m.StaffID, &m.CreatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"success": true, "shift": shift, "summary": summary, "cash_movements": movements})
+}
+
+// OpenShift starts a shift for the current staff member with the cash
+// counted into the drawer. A staff member, and a terminal, can only have
+// one shift open at a time.
+func OpenShift(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		OpeningCash *int   `json:"opening_cash"`
+		Note        string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if req.OpeningCash == nil || *req.OpeningCash < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kas awal wajib diisi dan tidak boleh negatif"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	var terminalID int
+	if err := dbConn.QueryRow("SELECT COALESCE(terminal_id, 0) FROM auth_sessions WHERE id = $1", identity.SessionID).Scan(&terminalID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var shiftID int
+	err := dbConn.QueryRow(`
+	INSERT INTO shifts (outlet_id, staff_id, terminal_id, opening_cash, open_note)
+	VALUES ($1, $2, NULLIF($3, 0), $4, $5)
+	RETURNING id`, identity.OutletID, identity.UserID, terminalID, *req.OpeningCash, strings.TrimSpace(req.Note)).Scan(&shiftID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Masih ada shift yang terbuka untuk staf atau terminal ini"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	shift, err := db.ScanShift(dbConn.QueryRow(db.ShiftColumnsQuery+" WHERE sh.id = $1", shiftID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return shiftReport(c, dbConn, shift, fiber.StatusCreated)
+}
+
+// GetCurrentShift shows the current staff member's open shift with the cash
+// the drawer should hold so far
+func GetCurrentShift(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+	shift, err := db.ScanShift(dbConn.QueryRow(db.ShiftColumnsQuery+" WHERE sh.staff_id = $1 AND sh.outlet_id = $2 AND sh.closed_at IS NULL", identity.UserID, identity.OutletID))
+	if err == sql.ErrNoRows {
+		return respondError(c, errNoOpenShift)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return shiftReport(c, dbConn, shift, fiber.StatusOK)
+}
+
+// GetShift shows a shift of the current outlet. Staff see their own shifts;
+// seeing others' takes the reports permission.
+func GetShift(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID shift tidak valid"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	shift, err := db.ScanShift(dbConn.QueryRow(db.ShiftColumnsQuery+" WHERE sh.id = $1 AND sh.outlet_id = $2", id, identity.OutletID))
+	if err == sql.ErrNoRows || (err == nil && shift.StaffID != identity.UserID && !identity.HasPermission(db.PermissionReportsRead)) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Shift tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return shiftReport(c, dbConn, shift, fiber.StatusOK)
+}
+
+// CreateCashMovement records cash put into (pay_in) or taken out of
+// (pay_out) the drawer during the current staff member's open shift
+func CreateCashMovement(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Type   string `json:"type"`
+		Amount int    `json:"amount"`
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	errors := []string{}
+	if req.Type != db.CashPayIn && req.Type != db.CashPayOut {
+		errors = append(errors, "Jenis harus pay_in atau pay_out")
+	}
+	if req.Amount <= 0 {
+		errors = append(errors, "Jumlah harus lebih dari 0")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		errors = append(errors, "Alasan wajib diisi")
+	}
+	if len(errors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	shiftID, err := lockOpenShift(tx, identity.UserID, identity.OutletID, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	movement := db.CashMovement{ShiftID: shiftID, Type: req.Type, Amount: req.Amount, Reason: req.Reason, StaffID: identity.UserID}
+	err = tx.QueryRow("INSERT INTO cash_movements (shift_id, type, amount, reason, staff_id) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at::text",
+		shiftID, req.Type, req.Amount, req.Reason, identity.UserID).Scan(&movement.ID, &movement.CreatedAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "cash_movement": movement})
+}
+
+// CloseShift closes the current staff member's open shift with the cash
+// counted in the drawer, and reports how far over or short it is
+func CloseShift(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		CountedCash *int   `json:"counted_cash"`
+		Note        string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if req.CountedCash == nil || *req.CountedCash < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kas yang dihitung wajib diisi dan tidak boleh negatif"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	// The exclusive lock waits for payments and movements still being
+	// recorded on the shift
+	shiftID, err := lockOpenShift(tx, identity.UserID, identity.OutletID, true)
+	if err != nil {
+		return respondError(c, err)
+	}
+	shift, err := db.ScanShift(tx.QueryRow(db.ShiftColumnsQuery+" WHERE sh.id = $1", shiftID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	summary, err := summarizeShift(tx, shift)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	_, err = tx.Exec(`
+	UPDATE shifts
+	SET counted_cash = $1, expected_cash = $2, difference = $1 - $2, close_note = $3, closed_at = NOW(), closed_by = $4
+	WHERE id = $5`, *req.CountedCash, summary.ExpectedCash, strings.TrimSpace(req.Note), identity.UserID, shiftID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	shift, err = db.ScanShift(dbConn.QueryRow(db.ShiftColumnsQuery+" WHERE sh.id = $1", shiftID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return shiftReport(c, dbConn, shift, fiber.StatusOK)
+}
+
+// GetShifts lists the current outlet's shifts opened on ?date= or
+// ?from=&to=, with their over/short results. ?staff_id= narrows it to one
+// staff member and ?format= exports it as a file.
+func GetShifts(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+	from, to, err := reportRange(c, dbConn, outletID)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	rows, err := dbConn.Query(db.ShiftColumnsQuery+`
+	JOIN settings s ON s.outlet_id = sh.outlet_id
+	WHERE sh.outlet_id = $1
+	  AND ((sh.opened_at AT TIME ZONE current_setting('TimeZone')) AT TIME ZONE s.timezone)::date BETWEEN $2::date AND $3::date
+	  AND ($4 = 0 OR sh.staff_id = $4)
+	ORDER BY sh.opened_at`, outletID, from, to, c.QueryInt("staff_id", 0))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	shifts := []fiber.Map{}
+	exported := []db.Shift{}
+	for rows.Next() {
+		shift, err := db.ScanShift(rows)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		result := ""
+		if shift.Difference != nil {
+			result = drawerResult(*shift.Difference)
+		}
+		shifts = append(shifts, fiber.Map{"shift": shift, "result": result})
+		exported = append(exported, shift)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		return sendExport(c, format, "shift-kasir-"+from+"-"+to, "Shift Kasir "+periodLabel(from, to), func(w export.Writer) error {
+			if err := w.Section("Shift", []string{"ID", "Staf", "Terminal", "Dibuka", "Ditutup", "Kas awal", "Kas seharusnya", "Kas dihitung", "Selisih", "Hasil"}); err != nil {
+				return err
+			}
+			for _, shift := range exported {
+				result := ""
+				if shift.Difference != nil {
+					result = drawerResult(*shift.Difference)
+				}
+				if err := w.Row(shift.ID, shift.StaffName, shift.TerminalName, shift.OpenedAt, shift.ClosedAt,
+					shift.OpeningCash, shift.ExpectedCash, shift.CountedCash, shift.Difference, result); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "outlet_id": outletID, "from": from, "to": to, "shifts": shifts})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"warmindo-api/db"
+)
+
+func TestDrawerReconciliation(t *testing.T) {
+	tests := []struct {
+		name         string
+		summary      db.ShiftSummary
+		counted      int
+		wantExpected int
+		wantResult   string
+	}{
+		{
+			name:         "quiet shift",
+			summary:      db.ShiftSummary{OpeningCash: 200000},
+			counted:      200000,
+			wantExpected: 200000, wantResult: db.DrawerEven,
+		},
+		{
+			name:         "sales, refunds and movements",
+			summary:      db.ShiftSummary{OpeningCash: 200000, CashSales: 450000, CashRefunds: 15000, PayIns: 50000, PayOuts: 80000},
+			counted:      605000,
+			wantExpected: 605000, wantResult: db.DrawerEven,
+		},
+		{
+			name:         "short",
+			summary:      db.ShiftSummary{OpeningCash: 100000, CashSales: 64000},
+			counted:      160000,
+			wantExpected: 164000, wantResult: db.DrawerShort,
+		},
+		{
+			name:         "over",
+			summary:      db.ShiftSummary{OpeningCash: 100000, CashSales: 64000, PayOuts: 20000},
+			counted:      145000,
+			wantExpected: 144000, wantResult: db.DrawerOver,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := expectedCash(tt.summary)
+			if expected != tt.wantExpected {
+				t.Errorf("expectedCash = %d, want %d", expected, tt.wantExpected)
+			}
+			if got := drawerResult(tt.counted - expected); got != tt.wantResult {
+				t.Errorf("drawerResult = %q, want %q", got, tt.wantResult)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package api
 
 import (
 	"database/sql"
-	"fmt"
+	"log"
 	"warmindo-api/db"
 	"warmindo-api/middleware"
+	"warmindo-api/notify"
 	"warmindo-api/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -17,21 +18,30 @@ type Claims struct {
 }
 
 // SetupUserRoutes sets up the routes for user management
-func SetupUserRoutes(app *fiber.App, dbConn *sql.DB) {
-	userAPI := app.Group("/api/users", middleware.AuthMiddleware(1))
-	userAPI.Get("/", func(c *fiber.Ctx) error {
+func SetupUserRoutes(app *fiber.App, dbConn *sql.DB, notifier notify.Notifier) {
+	canRead := middleware.RequirePermission(dbConn, db.PermissionUsersRead)
+	canWrite := middleware.RequirePermission(dbConn, db.PermissionUsersWrite)
+
+	userAPI := app.Group("/api/users")
+	userAPI.Get("/", canRead, func(c *fiber.Ctx) error {
 		return GetUsers(c, dbConn)
 	})
-	userAPI.Get("/:id", func(c *fiber.Ctx) error {
+	userAPI.Get("/locked", canRead, func(c *fiber.Ctx) error {
+		return GetLockedUsers(c, dbConn)
+	})
+	userAPI.Post("/:id/unlock", canWrite, func(c *fiber.Ctx) error {
+		return UnlockUser(c, dbConn)
+	})
+	userAPI.Get("/:id", canRead, func(c *fiber.Ctx) error {
 		return GetUserByID(c, dbConn)
 	})
-	userAPI.Post("/", func(c *fiber.Ctx) error {
+	userAPI.Post("/", canWrite, func(c *fiber.Ctx) error {
 		return CreateUser(c, dbConn)
 	})
-	userAPI.Put("/:id", func(c *fiber.Ctx) error {
+	userAPI.Put("/:id", canWrite, func(c *fiber.Ctx) error {
 		return UpdateUser(c, dbConn)
 	})
-	userAPI.Delete("/:id", func(c *fiber.Ctx) error {
+	userAPI.Delete("/:id", canWrite, func(c *fiber.Ctx) error {
 		return DeleteUser(c, dbConn)
 	})
 
@@ -39,13 +49,30 @@ func SetupUserRoutes(app *fiber.App, dbConn *sql.DB) {
 	authAPI.Post("/login", func(c *fiber.Ctx) error {
 		return Login(c, dbConn)
 	})
+	authAPI.Post("/refresh", func(c *fiber.Ctx) error {
+		return RefreshToken(c, dbConn)
+	})
+	authAPI.Post("/logout", middleware.AuthMiddleware(dbConn), func(c *fiber.Ctx) error {
+		return Logout(c, dbConn)
+	})
+	authAPI.Post("/logout-all", middleware.AuthMiddleware(dbConn), func(c *fiber.Ctx) error {
+		return LogoutAll(c, dbConn)
+	})
+
+	authAPI.Post("/forgot-password", func(c *fiber.Ctx) error {
+		return ForgotPassword(c, dbConn, notifier)
+	})
+	authAPI.Post("/reset-password", func(c *fiber.Ctx) error {
+		return ResetPassword(c, dbConn)
+	})
 }
 
-// CreateUser handles creating a new user
+// CreateUser handles creating a new user, who starts out working at the
+// current outlet
 func CreateUser(c *fiber.Ctx, dbConn *sql.DB) error {
 	var user db.User
 	if err := c.BodyParser(&user); err != nil {
-		fmt.Print(err)
+		log.Printf("create user: invalid request body: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
 	}
 
@@ -60,18 +87,34 @@ func CreateUser(c *fiber.Ctx, dbConn *sql.DB) error {
 	}
 	user.Password = hashedPassword
 
-	_, err = dbConn.Exec("INSERT INTO staffs (email, password, name, username, role_id, phone, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())",
-		user.Email, user.Password, user.Name, user.Username, user.RoleID, user.Phone)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("INSERT INTO staffs (email, password, name, username, role_id, phone, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW()) RETURNING id",
+		user.Email, user.Password, user.Name, user.Username, user.RoleID, user.Phone).Scan(&user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal memasukkan pengguna ke dalam database"})
 	}
+	if _, err := tx.Exec("INSERT INTO staff_outlets (staff_id, outlet_id) VALUES ($1, $2)", user.ID, middleware.CurrentIdentity(c).OutletID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return c.JSON(fiber.Map{"success": true, "message": "Pengguna berhasil dibuat"})
 }
 
-// GetUsers retrieves all users
+// GetUsers retrieves the users working at the current outlet
 func GetUsers(c *fiber.Ctx, dbConn *sql.DB) error {
-	rows, err := dbConn.Query("SELECT id, email, name, username, role_id, phone, created_at, updated_at FROM staffs ORDER BY updated_at desc")
+	rows, err := dbConn.Query(`
+	SELECT st.id, st.email, st.name, st.username, st.role_id, st.phone, st.created_at, st.updated_at
+	FROM staffs st JOIN staff_outlets so ON so.staff_id = st.id
+	WHERE so.outlet_id = $1 AND st.deleted_at IS NULL
+	ORDER BY st.updated_at desc`, middleware.CurrentIdentity(c).OutletID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -91,10 +134,16 @@ func GetUsers(c *fiber.Ctx, dbConn *sql.DB) error {
 
 // GetUserByID retrieves a single user by ID
 func GetUserByID(c *fiber.Ctx, dbConn *sql.DB) error {
-	id := c.Params("id")
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pengguna tidak valid"})
+	}
+	if err := requireOutletStaff(c, dbConn, id); err != nil {
+		return respondError(c, err)
+	}
 	var user db.User
 
-	err := dbConn.QueryRow("SELECT id, email, name, username, role_id, phone, created_at, updated_at FROM staffs WHERE id = $1", id).Scan(&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID, &user.Phone, &user.CreatedAt, &user.UpdatedAt)
+	err = dbConn.QueryRow("SELECT id, email, name, username, role_id, phone, created_at, updated_at FROM staffs WHERE id = $1", id).Scan(&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID, &user.Phone, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Pengguna tidak ditemukan"})
 	}
@@ -104,18 +153,36 @@ func GetUserByID(c *fiber.Ctx, dbConn *sql.DB) error {
 
 // UpdateUser handles updating user details
 func UpdateUser(c *fiber.Ctx, dbConn *sql.DB) error {
-	id := c.Params("id")
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pengguna tidak valid"})
+	}
+	if err := requireOutletStaff(c, dbConn, id); err != nil {
+		return respondError(c, err)
+	}
 	var user db.User
 	if err := c.BodyParser(&user); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
 	}
 
-	if err := user.HashPassword(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal mengenkripsi kata sandi"})
+	if user.Password == "" {
+		// Leave the stored password untouched when none is sent
+		_, err = dbConn.Exec("UPDATE staffs SET email = $1, name = $2, username = $3, role_id = $4, phone = $5, updated_at = NOW() WHERE id = $6",
+			user.Email, user.Name, user.Username, user.RoleID, user.Phone, id)
+	} else {
+		if len(user.Password) < 4 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": []string{"Invalid password, Password should be more than 4 characters"}})
+		}
+		if err := user.HashPassword(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal mengenkripsi kata sandi"})
+		}
+		_, err = dbConn.Exec("UPDATE staffs SET email = $1, password = $2, name = $3, username = $4, role_id = $5, phone = $6, updated_at = NOW() WHERE id = $7",
+			user.Email, user.Password, user.Name, user.Username, user.RoleID, user.Phone, id)
+		if err == nil {
+			// A password set by an admin signs the user out everywhere
+			_, err = dbConn.Exec(db.RevokeStaffSessionQuery, id)
+		}
 	}
-
-	_, err := dbConn.Exec("UPDATE staffs SET email = $1, password = $2, name = $3, username = $4, role_id = $5, phone = $6, updated_at = NOW() WHERE id = $7",
-		user.Email, user.Password, user.Name, user.Username, user.RoleID, user.Phone, id)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal memperbarui pengguna di dalam database"})
 	}
@@ -123,11 +190,36 @@ func UpdateUser(c *fiber.Ctx, dbConn *sql.DB) error {
 	return c.JSON(fiber.Map{"success": true, "message": "Pengguna berhasil diperbarui"})
 }
 
-// DeleteUser handles deleting a user by ID
+// DeleteUser moves a user to the trash and signs them out everywhere
 func DeleteUser(c *fiber.Ctx, dbConn *sql.DB) error {
-	id := c.Params("id")
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pengguna tidak valid"})
+	}
+	if err := requireOutletStaff(c, dbConn, id); err != nil {
+		return respondError(c, err)
+	}
 
-	_, err := dbConn.Exec("DELETE FROM staffs WHERE id = $1", id)
+	// The row stays for the shifts, payments and voids that point at it and
+	// goes to the trash. Revoking the sessions invalidates any access token
+	// still held by the deleted user.
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE staffs SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL", id, middleware.CurrentIdentity(c).UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal menghapus pengguna dari database"})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pengguna tidak ditemukan"})
+	}
+	_, err = tx.Exec(db.RevokeStaffSessionQuery, id)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal menghapus pengguna dari database"})
 	}
@@ -135,7 +227,7 @@ func DeleteUser(c *fiber.Ctx, dbConn *sql.DB) error {
 	return c.JSON(fiber.Map{"success": true, "message": "Pengguna berhasil dihapus"})
 }
 
-// Login handles user login and token generation
+// Login handles user login by email or username and token generation
 func Login(c *fiber.Ctx, dbConn *sql.DB) error {
 	loginUser := &db.Login{}
 
@@ -143,23 +235,100 @@ func Login(c *fiber.Ctx, dbConn *sql.DB) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Permintaan tidak valid"}})
 	}
 
-	user, err := db.GetUserByEmail(dbConn, loginUser.Email)
+	ip := c.IP()
+	if wait, err := checkIPThrottle(dbConn, ip); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	identifier := loginUser.LoginIdentifier()
+
+	user, err := db.GetUserByLogin(dbConn, identifier)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Email belum terdaftar"}})
+			if wait, err := checkIdentifierThrottle(dbConn, identifier); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+			} else if wait > 0 {
+				return tooManyAttempts(c, wait)
+			}
+			compareDummyPassword(loginUser.Password)
+			if err := recordLoginAttempt(dbConn, identifier, ip, 0, false); err != nil {
+				log.Printf("login: failed to record attempt for unknown identifier from %s: %v", ip, err)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{invalidCredentialsMessage}})
 		}
-		fmt.Print(err)
+		log.Printf("login: failed to look up identifier: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	if wait, err := checkAccountThrottle(dbConn, user.ID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
 	}
 
 	if !utils.ComparePassword(user.Password, loginUser.Password) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Kredensial salah"}})
+		if err := recordLoginAttempt(dbConn, identifier, ip, user.ID, false); err != nil {
+			log.Printf("login: failed to record attempt for staff %d from %s: %v", user.ID, ip, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{invalidCredentialsMessage}})
 	}
 
-	tokenValue, err := middleware.GenerateJWT(fmt.Sprintf("%d", user.ID), user.RoleID)
+	// With 2FA enabled the password only earns a challenge; the attempt is
+	// recorded once the second step succeeds or fails.
+	twoFactor, err := getTwoFactorState(dbConn, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if twoFactor.Enabled {
+		return twoFactorChallenge(c, user)
+	}
+
+	if err := recordLoginAttempt(dbConn, identifier, ip, user.ID, true); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	return completeLogin(c, dbConn, user, loginUser.OutletID)
+}
+
+// completeLogin issues tokens for an authenticated user working in the
+// requested outlet (their first one when 0) and writes the login response
+func completeLogin(c *fiber.Ctx, dbConn *sql.DB, user *db.User, outletID int) error {
+	outlet, err := db.GetStaffOutlet(dbConn, user.ID, outletID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "errors": []string{"Pengguna tidak ditempatkan di outlet ini"}})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	outlets, err := db.GetStaffOutlets(dbConn, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	tokens, err := issueTokens(c, dbConn, user, outlet.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan dalam menghasilkan token"}})
 	}
 
-	return c.JSON(fiber.Map{"success": true, "user": user, "token": tokenValue})
+	permissions, err := db.GetRolePermissions(dbConn, user.RoleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	var enrollmentRequired bool
+	err = dbConn.QueryRow("SELECT r.require_2fa AND NOT st.totp_enabled FROM staffs st JOIN roles r ON r.id = st.role_id WHERE st.id = $1", user.ID).Scan(&enrollmentRequired)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	user.Password = ""
+	tokens["success"] = true
+	tokens["user"] = user
+	tokens["permissions"] = permissions
+	tokens["two_factor_enrollment_required"] = enrollmentRequired
+	tokens["outlet"] = outlet
+	tokens["outlets"] = outlets
+	return c.JSON(tokens)
 }
@@ -8,6 +8,7 @@ import (
 )
 
 func SetupStatusRoutes(app *fiber.App, dbConn *sql.DB) {
+	// Public: diners see status names on their order page
 	statusAPI := app.Group("/api/statuses")
 	statusAPI.Get("/", func(c *fiber.Ctx) error {
 		return GetStatuses(c, dbConn)
@@ -15,7 +16,7 @@ func SetupStatusRoutes(app *fiber.App, dbConn *sql.DB) {
 }
 
 func GetStatuses(c *fiber.Ctx, dbConn *sql.DB) error {
-	rows, err := dbConn.Query("SELECT id, name, created_at, updated_at FROM statuses")
+	rows, err := dbConn.Query("SELECT id, COALESCE(code, ''), name, created_at, updated_at FROM statuses ORDER BY id")
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -24,7 +25,7 @@ func GetStatuses(c *fiber.Ctx, dbConn *sql.DB) error {
 	var statuses []db.Status
 	for rows.Next() {
 		var status db.Status
-		if err := rows.Scan(&status.ID, &status.Name, &status.CreatedAt, &status.UpdatedAt); err != nil {
+		if err := rows.Scan(&status.ID, &status.Code, &status.Name, &status.CreatedAt, &status.UpdatedAt); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 		statuses = append(statuses, status)
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetupStoreRoutes sets up opening hours, holiday closures, the manual close
+// switch and the public open/closed status
+func SetupStoreRoutes(app *fiber.App, dbConn *sql.DB) {
+	canRead := middleware.RequirePermission(dbConn, db.PermissionSettingsRead)
+	canWrite := middleware.RequirePermission(dbConn, db.PermissionSettingsWrite)
+
+	app.Get("/api/store/status", customerRateLimit(CustomerCheckLimit, CustomerLimitWindow), func(c *fiber.Ctx) error {
+		return GetStoreStatus(c, dbConn)
+	})
+
+	storeAPI := app.Group("/api/settings")
+	storeAPI.Get("/hours", canRead, func(c *fiber.Ctx) error {
+		return GetStoreHours(c, dbConn)
+	})
+	storeAPI.Put("/hours", canWrite, func(c *fiber.Ctx) error {
+		return UpdateStoreHours(c, dbConn)
+	})
+	storeAPI.Put("/store-mode", canWrite, func(c *fiber.Ctx) error {
+		return SetStoreMode(c, dbConn)
+	})
+	storeAPI.Post("/closures", canWrite, func(c *fiber.Ctx) error {
+		return CreateStoreClosure(c, dbConn)
+	})
+	storeAPI.Delete("/closures/:id", canWrite, func(c *fiber.Ctx) error {
+		return DeleteStoreClosure(c, dbConn)
+	})
+}
+
+// storeStatus is whether an outlet takes orders right now
+func storeStatus(dbConn *sql.DB, outletID int) (*db.StoreStatus, error) {
+	schedule, err := db.GetStoreSchedule(dbConn, outletID)
+	if err != nil {
+		return nil, err
+	}
+	status := utils.StoreStatusAt(*schedule, time.Now())
+	return &status, nil
+}
+
+// GetStoreStatus tells diners whether an outlet is open. The outlet is the
+// one of ?table_token= when the QR token is sent, else ?outlet_id=.
+func GetStoreStatus(c *fiber.Ctx, dbConn *sql.DB) error {
+	outletID := requestOutlet(c)
+	if token := c.Query("table_token"); token != "" {
+		tableID, err := utils.VerifyTableToken(token)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": false, "error": "QR meja tidak valid, silakan pindai ulang"})
+		}
+		table, err := db.GetTableByID(dbConn, tableID)
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": false, "error": "Meja tidak ditemukan"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Kesalahan database"})
+		}
+		outletID = table.OutletID
+	}
+
+	status, err := storeStatus(dbConn, outletID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": false, "error": "Outlet tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": false, "error": "Kesalahan database"})
+	}
+
+	return c.JSON(fiber.Map{"status": true, "outlet_id": outletID, "store": status})
+}
+
+// GetStoreHours returns the current outlet's schedule and its status now
+func GetStoreHours(c *fiber.Ctx, dbConn *sql.DB) error {
+	schedule, err := db.GetStoreSchedule(dbConn, middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "schedule": schedule, "store": utils.StoreStatusAt(*schedule, time.Now())})
+}
+
+// UpdateStoreHours replaces the current outlet's weekly opening hours. An
+// empty list means open around the clock. The time zone is kept when not sent.
+func UpdateStoreHours(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Timezone string            `json:"timezone"`
+		Hours    []db.OpeningHours `json:"hours"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	errs := []string{}
+	req.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			errs = append(errs, "Zona waktu tidak dikenal")
+		}
+	}
+	for _, h := range req.Hours {
+		if h.Weekday < 0 || h.Weekday > 6 {
+			errs = append(errs, "weekday harus 0 (Minggu) sampai 6 (Sabtu)")
+			break
+		}
+		if _, err := utils.ParseClock(h.OpenTime); err != nil {
+			errs = append(errs, "open_time harus berformat HH:MM")
+			break
+		}
+		if _, err := utils.ParseClock(h.CloseTime); err != nil {
+			errs = append(errs, "close_time harus berformat HH:MM")
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	outletID := middleware.CurrentIdentity(c).OutletID
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	if req.Timezone != "" {
+		if _, err := tx.Exec("UPDATE settings SET timezone = $1 WHERE outlet_id = $2", req.Timezone, outletID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM opening_hours WHERE outlet_id = $1", outletID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, h := range req.Hours {
+		_, err := tx.Exec("INSERT INTO opening_hours (outlet_id, weekday, open_time, close_time) VALUES ($1, $2, $3, $4)",
+			outletID, h.Weekday, h.OpenTime, h.CloseTime)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// SetStoreMode flips the manual switch that closes the current outlet right
+// away, regardless of its opening hours, until it is switched back
+func SetStoreMode(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Closed  bool   `json:"closed"`
+		Message string `json:"message"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if !req.Closed {
+		req.Message = ""
+	}
+
+	outletID := middleware.CurrentIdentity(c).OutletID
+	_, err := dbConn.Exec("UPDATE settings SET manual_closed = $1, closed_message = $2 WHERE outlet_id = $3",
+		req.Closed, strings.TrimSpace(req.Message), outletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	status, err := storeStatus(dbConn, outletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "store": status})
+}
+
+// CreateStoreClosure closes the current outlet for whole days
+func CreateStoreClosure(c *fiber.Ctx, dbConn *sql.DB) error {
+	var closure db.StoreClosure
+	if err := c.BodyParser(&closure); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if closure.EndDate == "" {
+		closure.EndDate = closure.StartDate
+	}
+	start, err1 := time.Parse("2006-01-02", closure.StartDate)
+	end, err2 := time.Parse("2006-01-02", closure.EndDate)
+	if err1 != nil || err2 != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tanggal harus berformat YYYY-MM-DD"})
+	}
+	if end.Before(start) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tanggal selesai tidak boleh sebelum tanggal mulai"})
+	}
+	closure.Reason = strings.TrimSpace(closure.Reason)
+
+	identity := middleware.CurrentIdentity(c)
+	err := dbConn.QueryRow(`
+	INSERT INTO store_closures (outlet_id, start_date, end_date, reason, created_by)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at::text`,
+		identity.OutletID, closure.StartDate, closure.EndDate, closure.Reason, identity.UserID).Scan(&closure.ID, &closure.CreatedAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "closure": closure})
+}
+
+// DeleteStoreClosure removes a closure of the current outlet
+func DeleteStoreClosure(c *fiber.Ctx, dbConn *sql.DB) error {
+	res, err := dbConn.Exec("DELETE FROM store_closures WHERE id = $1 AND outlet_id = $2", c.Params("id"), middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Penutupan tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"database/sql"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// SetupTableRoutes sets up table management, the live floor view and moving
+// sessions between tables
+func SetupTableRoutes(app *fiber.App, dbConn *sql.DB) {
+	canRead := middleware.RequirePermission(dbConn, db.PermissionOrdersRead, db.PermissionTablesManage)
+	canManage := middleware.RequirePermission(dbConn, db.PermissionTablesManage)
+	canMove := middleware.RequirePermission(dbConn, db.PermissionOrdersUpdate, db.PermissionTablesManage)
+
+	tableAPI := app.Group("/api/tables")
+	tableAPI.Get("/", canRead, func(c *fiber.Ctx) error {
+		return GetTables(c, dbConn)
+	})
+	tableAPI.Get("/floor", canRead, func(c *fiber.Ctx) error {
+		return GetFloorView(c, dbConn)
+	})
+	tableAPI.Get("/history", canRead, func(c *fiber.Ctx) error {
+		return GetTableSessionHistory(c, dbConn)
+	})
+	tableAPI.Post("/transfer", canMove, func(c *fiber.Ctx) error {
+		return TransferTable(c, dbConn)
+	})
+	tableAPI.Post("/merge", canMove, func(c *fiber.Ctx) error {
+		return MergeTables(c, dbConn)
+	})
+	tableAPI.Get("/:id", canRead, func(c *fiber.Ctx) error {
+		return GetTableByID(c, dbConn)
+	})
+	tableAPI.Post("/", canManage, func(c *fiber.Ctx) error {
+		return CreateTable(c, dbConn)
+	})
+	tableAPI.Put("/:id", canManage, func(c *fiber.Ctx) error {
+		return UpdateTable(c, dbConn)
+	})
+	tableAPI.Delete("/:id", canManage, func(c *fiber.Ctx) error {
+		return DeleteTable(c, dbConn)
+	})
+}
+
+func validateTable(table *db.Table) []string {
+	errs := []string{}
+	table.Label = strings.TrimSpace(table.Label)
+	table.Area = strings.ToLower(strings.TrimSpace(table.Area))
+
+	if table.Number < 1 {
+		errs = append(errs, "Nomor meja harus lebih dari 0")
+	}
+	if table.Label == "" {
+		errs = append(errs, "Label meja wajib diisi")
+	}
+	if !db.IsTableArea(table.Area) {
+		errs = append(errs, "Area harus salah satu dari: "+strings.Join(db.TableAreas, ", "))
+	}
+	if table.Capacity < 1 {
+		errs = append(errs, "Kapasitas harus lebih dari 0")
+	}
+	return errs
+}
+
+// GetTables lists the current outlet's tables, optionally filtered by ?area= and ?active=
+func GetTables(c *fiber.Ctx, dbConn *sql.DB) error {
+	query := "SELECT id, outlet_id, number, label, area, capacity, active, created_at, updated_at FROM tables WHERE outlet_id = $1 AND ($2 = '' OR area = $2)"
+	args := []interface{}{middleware.CurrentIdentity(c).OutletID, c.Query("area")}
+	if active := c.Query("active"); active != "" {
+		query += " AND active = $3"
+		args = append(args, active == "true")
+	}
+	query += " ORDER BY number"
+
+	rows, err := dbConn.Query(query, args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	tables := []db.Table{}
+	for rows.Next() {
+		var table db.Table
+		if err := rows.Scan(&table.ID, &table.OutletID, &table.Number, &table.Label, &table.Area, &table.Capacity, &table.Active, &table.CreatedAt, &table.UpdatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		tables = append(tables, table)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "tables": tables, "areas": db.TableAreas})
+}
+
+// GetTableByID retrieves a single table
+func GetTableByID(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID meja tidak valid"})
+	}
+
+	table, err := db.GetTableByID(dbConn, id)
+	if err == nil && table.OutletID != middleware.CurrentIdentity(c).OutletID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Meja tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "table": table})
+}
+
+// CreateTable adds a table to the current outlet
+func CreateTable(c *fiber.Ctx, dbConn *sql.DB) error {
+	table := db.Table{Area: "indoor", Capacity: 4, Active: true}
+	if err := c.BodyParser(&table); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if errs := validateTable(&table); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	table.OutletID = middleware.CurrentIdentity(c).OutletID
+	err := dbConn.QueryRow("INSERT INTO tables (outlet_id, number, label, area, capacity, active) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		table.OutletID, table.Number, table.Label, table.Area, table.Capacity, table.Active).Scan(&table.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Nomor meja sudah digunakan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "table": table})
+}
+
+// UpdateTable edits a table. Its number can't change while a session is open on it.
+func UpdateTable(c *fiber.Ctx, dbConn *sql.DB) error {
+	outletID := middleware.CurrentIdentity(c).OutletID
+	var current db.Table
+	err := dbConn.QueryRow("SELECT id, number FROM tables WHERE id = $1 AND outlet_id = $2", c.Params("id"), outletID).Scan(&current.ID, &current.Number)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Meja tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var table db.Table
+	if err := c.BodyParser(&table); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	if errs := validateTable(&table); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+	}
+
+	if table.Number != current.Number || !table.Active {
+		busy, err := tableHasActiveSession(dbConn, outletID, current.Number)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if busy {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Meja masih memiliki sesi aktif"})
+		}
+	}
+
+	_, err = dbConn.Exec("UPDATE tables SET number = $1, label = $2, area = $3, capacity = $4, active = $5, updated_at = NOW() WHERE id = $6",
+		table.Number, table.Label, table.Area, table.Capacity, table.Active, current.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Nomor meja sudah digunakan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// DeleteTable removes a table without an open session
+func DeleteTable(c *fiber.Ctx, dbConn *sql.DB) error {
+	outletID := middleware.CurrentIdentity(c).OutletID
+	var number int
+	err := dbConn.QueryRow("SELECT number FROM tables WHERE id = $1 AND outlet_id = $2", c.Params("id"), outletID).Scan(&number)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Meja tidak ditemukan"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	busy, err := tableHasActiveSession(dbConn, outletID, number)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if busy {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Meja masih memiliki sesi aktif"})
+	}
+
+	if _, err := dbConn.Exec("DELETE FROM tables WHERE id = $1 AND outlet_id = $2", c.Params("id"), outletID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func tableHasActiveSession(dbConn *sql.DB, outletID, number int) (bool, error) {
+	var busy bool
+	err := dbConn.QueryRow("SELECT EXISTS (SELECT 1 FROM customers WHERE outlet_id = $1 AND table_number = $2 AND active = true)", outletID, number).Scan(&busy)
+	return busy, err
+}
+
+// GetFloorView shows every table of the current outlet with its open session,
+// if any, and what the session still owes
+func GetFloorView(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query(`
+	SELECT t.id, t.outlet_id, t.number, t.label, t.area, t.capacity, t.active,
+	       cu.order_code, cu.start_date,
+	       COUNT(o.id) AS order_lines,
+	       COALESCE(SUM(o.amount * o.unit_price) FILTER (WHERE o.status_id <> $1 AND o.cancelled_at IS NULL), 0) AS outstanding_total
+	FROM tables t
+	LEFT JOIN customers cu ON cu.outlet_id = t.outlet_id AND cu.table_number = t.number AND cu.active = true
+	LEFT JOIN orders o ON o.order_code = cu.order_code
+	WHERE t.outlet_id = $2
+	GROUP BY t.id, cu.order_code, cu.start_date
+	ORDER BY t.area, t.number`, db.StatusPaid, middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	floor := []fiber.Map{}
+	occupied := 0
+	var outstandingSum int
+	for rows.Next() {
+		var table db.Table
+		var orderCode sql.NullString
+		var startDate sql.NullTime
+		var orderLines, outstanding int
+		if err := rows.Scan(&table.ID, &table.OutletID, &table.Number, &table.Label, &table.Area, &table.Capacity, &table.Active,
+			&orderCode, &startDate, &orderLines, &outstanding); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		entry := fiber.Map{"table": table, "occupied": orderCode.Valid}
+		if orderCode.Valid {
+			occupied++
+			outstandingSum += outstanding
+			entry["session"] = fiber.Map{
+				"order_code":        orderCode.String,
+				"start_date":        startDate.Time,
+				"order_lines":       orderLines,
+				"outstanding_total": outstanding,
+			}
+		}
+		floor = append(floor, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"tables":  floor,
+		"summary": fiber.Map{
+			"total_tables":      len(floor),
+			"occupied_tables":   occupied,
+			"outstanding_total": outstandingSum,
+		},
+	})
+}
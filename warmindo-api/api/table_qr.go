@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// SetupTableQRRoutes sets up the admin endpoints that print signed table QR codes
+func SetupTableQRRoutes(app *fiber.App, dbConn *sql.DB) {
+	canManage := middleware.RequirePermission(dbConn, db.PermissionTablesManage)
+
+	qrAPI := app.Group("/api/tables/qr")
+	qrAPI.Get("/", canManage, func(c *fiber.Ctx) error {
+		return GetTableQRSheet(c, dbConn)
+	})
+	qrAPI.Get("/:number", canManage, func(c *fiber.Ctx) error {
+		return GetTableQRCode(c, dbConn)
+	})
+	qrAPI.Get("/:number/token", canManage, func(c *fiber.Ctx) error {
+		return GetTableToken(c, dbConn)
+	})
+}
+
+// tableQRURL is the address encoded in a table's QR code
+func tableQRURL(token string) string {
+	base := os.Getenv("TABLE_QR_URL")
+	if base == "" {
+		base = os.Getenv("CLIENT_URL")
+	}
+	return strings.TrimRight(base, "/") + "/?table_token=" + url.QueryEscape(token)
+}
+
+// parseTableNumber reads the :number parameter and looks the table up in
+// the current outlet
+func parseTableNumber(c *fiber.Ctx, dbConn *sql.DB) (*db.Table, error) {
+	number, err := strconv.Atoi(c.Params("number"))
+	if err != nil || number < 1 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Nomor meja tidak valid")
+	}
+
+	table, err := db.GetTableByNumber(dbConn, middleware.CurrentIdentity(c).OutletID, number)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Meja tidak ditemukan")
+		}
+		return nil, err
+	}
+	return table, nil
+}
+
+// GetTableToken returns the signed token and URL of one table
+func GetTableToken(c *fiber.Ctx, dbConn *sql.DB) error {
+	table, err := parseTableNumber(c, dbConn)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	token := utils.SignTableToken(table.ID)
+	return c.JSON(fiber.Map{"success": true, "table_number": table.Number, "token": token, "url": tableQRURL(token)})
+}
+
+// GetTableQRCode renders the QR code of one table as PNG (default) or SVG
+func GetTableQRCode(c *fiber.Ctx, dbConn *sql.DB) error {
+	table, err := parseTableNumber(c, dbConn)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	size := c.QueryInt("size", 512)
+	if size < 128 || size > 2048 {
+		size = 512
+	}
+
+	qr, err := qrcode.New(tableQRURL(utils.SignTableToken(table.ID)), qrcode.Medium)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filename := fmt.Sprintf("meja-%d", table.Number)
+	switch c.Query("format", "png") {
+	case "svg":
+		c.Set(fiber.HeaderContentType, "image/svg+xml")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s.svg"`, filename))
+		return c.SendString(qrSVG(qr, size))
+	case "png":
+		png, err := qr.PNG(size)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Set(fiber.HeaderContentType, "image/png")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s.png"`, filename))
+		return c.Send(png)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Format harus png atau svg"})
+	}
+}
+
+// qrSVG draws the QR bitmap as SVG, one rect per run of dark modules
+func qrSVG(qr *qrcode.QRCode, size int) string {
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, modules, modules)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="1" fill="#000"/>`, start, y, x-start)
+		}
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// GetTableQRSheet renders a printable A4 PDF with the QR code of every active
+// table in the current outlet
+func GetTableQRSheet(c *fiber.Ctx, dbConn *sql.DB) error {
+	rows, err := dbConn.Query("SELECT id, number, label FROM tables WHERE outlet_id = $1 AND active = true ORDER BY number",
+		middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	tables := []db.Table{}
+	for rows.Next() {
+		var table db.Table
+		if err := rows.Scan(&table.ID, &table.Number, &table.Label); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		tables = append(tables, table)
+	}
+
+	pdf, err := tableQRSheet(tables)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="qr-meja.pdf"`)
+	return c.Send(pdf)
+}
+
+// tableQRSheet lays out the tables' QR codes three across and four down per A4 page
+func tableQRSheet(tables []db.Table) ([]byte, error) {
+	const (
+		columns  = 3
+		rows     = 4
+		cellW    = 63.0
+		cellH    = 68.0
+		qrSize   = 50.0
+		marginX  = 10.5
+		marginY  = 12.0
+		perPage  = columns * rows
+		fontName = "Helvetica"
+	)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(false, 0)
+
+	for i, table := range tables {
+		if i%perPage == 0 {
+			pdf.AddPage()
+		}
+		col := (i % perPage) % columns
+		row := (i % perPage) / columns
+		x := marginX + float64(col)*cellW
+		y := marginY + float64(row)*cellH
+
+		png, err := qrcode.Encode(tableQRURL(utils.SignTableToken(table.ID)), qrcode.Medium, 512)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("table-%d", table.ID)
+		pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.Rect(x+1, y+1, cellW-2, cellH-2, "D")
+		pdf.ImageOptions(name, x+(cellW-qrSize)/2, y+3, qrSize, qrSize, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+		pdf.SetFont(fontName, "B", 14)
+		pdf.SetXY(x, y+qrSize+4)
+		pdf.CellFormat(cellW, 6, table.Label, "", 0, "C", false, 0, "")
+		pdf.SetFont(fontName, "", 8)
+		pdf.SetXY(x, y+qrSize+10)
+		pdf.CellFormat(cellW, 4, "Pindai untuk memesan", "", 0, "C", false, 0, "")
+	}
+	if len(tables) == 0 {
+		pdf.AddPage()
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// TransferTable moves an open session and all of its orders to a free table
+func TransferTable(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		OrderCode string `json:"order_code"`
+		ToTable   int    `json:"to_table"`
+		Note      string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.OrderCode == "" || req.ToTable < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "order_code dan to_table wajib diisi"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var fromTable int
+	err = tx.QueryRow("SELECT table_number FROM customers WHERE order_code = $1 AND outlet_id = $2 AND active = true FOR UPDATE",
+		req.OrderCode, identity.OutletID).Scan(&fromTable)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sesi aktif tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if fromTable == req.ToTable {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Meja tujuan sama dengan meja asal"})
+	}
+
+	if err := lockFreeTable(tx, identity.OutletID, req.ToTable); err != nil {
+		return respondError(c, err)
+	}
+
+	if _, err := tx.Exec("UPDATE customers SET table_number = $1 WHERE order_code = $2 AND active = true", req.ToTable, req.OrderCode); err != nil {
+		return tableSessionError(c, err)
+	}
+	if _, err := tx.Exec("UPDATE orders SET table_number = $1, updated_at = NOW() WHERE order_code = $2", strconv.Itoa(req.ToTable), req.OrderCode); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	_, err = tx.Exec(db.CreateTableSessionEventQuery, db.TableEventTransfer, req.OrderCode, fromTable, req.ToTable, "", identity.UserID, strings.TrimSpace(req.Note), identity.OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return tableSessionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "order_code": req.OrderCode, "from_table": fromTable, "to_table": req.ToTable})
+}
+
+// MergeTables folds one open session into another. The source session's
+// orders take the target's order code and table, pending lines joining the
+// target's pending line for the same menu and price, and the source session
+// is closed with merged_into pointing at the target.
+func MergeTables(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		SourceOrderCode string `json:"source_order_code"`
+		TargetOrderCode string `json:"target_order_code"`
+		Note            string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.SourceOrderCode == "" || req.TargetOrderCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "source_order_code dan target_order_code wajib diisi"})
+	}
+	if req.SourceOrderCode == req.TargetOrderCode {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Sesi asal dan tujuan tidak boleh sama"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	// Lock both sessions in a fixed order so two opposite merges can't
+	// deadlock. Sessions of other outlets are simply not found.
+	rows, err := tx.Query("SELECT order_code, table_number FROM customers WHERE order_code IN ($1, $2) AND outlet_id = $3 AND active = true ORDER BY order_code FOR UPDATE",
+		req.SourceOrderCode, req.TargetOrderCode, identity.OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	tables := map[string]int{}
+	for rows.Next() {
+		var code string
+		var number int
+		if err := rows.Scan(&code, &number); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		tables[code] = number
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sourceTable, ok := tables[req.SourceOrderCode]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sesi asal tidak aktif atau tidak ditemukan"})
+	}
+	targetTable, ok := tables[req.TargetOrderCode]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sesi tujuan tidak aktif atau tidak ditemukan"})
+	}
+
+	// Pending lines of a menu the target already has pending at the same
+	// price are added to the target's line, so the bill keeps one line per
+	// menu to accumulate into. Lines with voids recorded against them keep their own row.
+	res, err := tx.Exec(`
+	WITH source AS (
+		SELECT menu_id, unit_price, SUM(amount) AS amount, array_agg(id) AS ids
+		FROM orders o
+		WHERE order_code = $2 AND status_id = $3
+		  AND NOT EXISTS (SELECT 1 FROM order_voids v WHERE v.order_id = o.id)
+		GROUP BY menu_id, unit_price
+	), folded AS (
+		UPDATE orders t SET amount = t.amount + source.amount, updated_at = NOW()
+		FROM source
+		WHERE t.id = (SELECT MIN(id) FROM orders WHERE order_code = $1 AND menu_id = source.menu_id AND unit_price = source.unit_price AND status_id = $3)
+		RETURNING source.ids
+	)
+	DELETE FROM orders WHERE id IN (SELECT unnest(ids) FROM folded)`, req.TargetOrderCode, req.SourceOrderCode, db.StatusPending)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	folded, _ := res.RowsAffected()
+
+	res, err = tx.Exec("UPDATE orders SET order_code = $1, table_number = $2, updated_at = NOW() WHERE order_code = $3",
+		req.TargetOrderCode, strconv.Itoa(targetTable), req.SourceOrderCode)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	moved, _ := res.RowsAffected()
+
+	_, err = tx.Exec("UPDATE customers SET active = false, end_date = NOW(), merged_into = $1, closed_reason = $3 WHERE order_code = $2 AND active = true",
+		req.TargetOrderCode, req.SourceOrderCode, db.SessionClosedMerged)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	_, err = tx.Exec(db.CreateTableSessionEventQuery, db.TableEventMerge, req.SourceOrderCode, sourceTable, targetTable, req.TargetOrderCode, identity.UserID, strings.TrimSpace(req.Note), identity.OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":           true,
+		"order_code":        req.TargetOrderCode,
+		"table_number":      targetTable,
+		"merged_order_code": req.SourceOrderCode,
+		"freed_table":       sourceTable,
+		"moved_orders":      moved,
+		"folded_orders":     folded,
+	})
+}
+
+// GetTableSessionHistory lists the current outlet's transfers and merges, optionally filtered by
+// ?order_code= (as source or target) and ?table= (as origin or destination)
+func GetTableSessionHistory(c *fiber.Ctx, dbConn *sql.DB) error {
+	table := c.QueryInt("table", 0)
+	rows, err := dbConn.Query(`
+	SELECT e.id, e.event, e.order_code, e.from_table, e.to_table, COALESCE(e.target_order_code, ''),
+	       COALESCE(e.staff_id, 0), COALESCE(st.name, ''), e.note, e.created_at
+	FROM table_session_events e
+	LEFT JOIN staffs st ON st.id = e.staff_id
+	WHERE e.outlet_id = $3
+	  AND ($1 = '' OR e.order_code = $1 OR e.target_order_code = $1)
+	  AND ($2 = 0 OR e.from_table = $2 OR e.to_table = $2)
+	ORDER BY e.created_at DESC, e.id DESC
+	LIMIT 200`, c.Query("order_code"), table, middleware.CurrentIdentity(c).OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	events := []db.TableSessionEvent{}
+	for rows.Next() {
+		var e db.TableSessionEvent
+		if err := rows.Scan(&e.ID, &e.Event, &e.OrderCode, &e.FromTable, &e.ToTable, &e.TargetOrderCode,
+			&e.StaffID, &e.StaffName, &e.Note, &e.CreatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		events = append(events, e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "events": events})
+}
+
+// lockFreeTable locks the target table's row and checks it is active and has
+// no open session. Locking the row serializes concurrent moves onto it.
+func lockFreeTable(tx *sql.Tx, outletID, number int) error {
+	var active bool
+	err := tx.QueryRow("SELECT active FROM tables WHERE outlet_id = $1 AND number = $2 FOR UPDATE", outletID, number).Scan(&active)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Meja tujuan tidak ditemukan")
+	}
+	if err != nil {
+		return err
+	}
+	if !active {
+		return fiber.NewError(fiber.StatusConflict, "Meja tujuan tidak aktif")
+	}
+
+	var busy bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM customers WHERE outlet_id = $1 AND table_number = $2 AND active = true)", outletID, number).Scan(&busy); err != nil {
+		return err
+	}
+	if busy {
+		return fiber.NewError(fiber.StatusConflict, "Meja tujuan masih memiliki sesi aktif")
+	}
+	return nil
+}
+
+// tableSessionError reports a race lost to the one-open-session-per-table
+// index as a conflict
+func tableSessionError(c *fiber.Ctx, err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Meja tujuan masih memiliki sesi aktif"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PINTokenTTL is the lifetime of a token issued by a PIN login. It covers a
+// shift; there is no refresh token, the cashier enters their PIN again.
+const PINTokenTTL = 8 * time.Hour
+
+// SetupTerminalRoutes sets up POS terminal registration and PIN login
+func SetupTerminalRoutes(app *fiber.App, dbConn *sql.DB) {
+	canManage := middleware.RequirePermission(dbConn, db.PermissionTerminalsManage)
+
+	terminalAPI := app.Group("/api/terminals")
+	terminalAPI.Get("/", canManage, func(c *fiber.Ctx) error {
+		return GetTerminals(c, dbConn)
+	})
+	terminalAPI.Post("/", canManage, func(c *fiber.Ctx) error {
+		return CreateTerminal(c, dbConn)
+	})
+	terminalAPI.Put("/:id", canManage, func(c *fiber.Ctx) error {
+		return UpdateTerminal(c, dbConn)
+	})
+
+	app.Post("/api/auth/pin-login", func(c *fiber.Ctx) error {
+		return PINLogin(c, dbConn)
+	})
+	app.Put("/api/me/pin", middleware.AuthMiddleware(dbConn), func(c *fiber.Ctx) error {
+		return SetOwnPIN(c, dbConn)
+	})
+	app.Put("/api/users/:id/pin", middleware.RequirePermission(dbConn, db.PermissionUsersWrite), func(c *fiber.Ctx) error {
+		return SetUserPIN(c, dbConn)
+	})
+}
+
+// GetTerminals lists the POS terminals registered at the current outlet
+func GetTerminals(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+	rows, err := dbConn.Query("SELECT id, outlet_id, name, active, COALESCE(last_seen_at::text, ''), created_at, updated_at FROM terminals WHERE outlet_id = $1 ORDER BY id", identity.OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	terminals := []db.Terminal{}
+	for rows.Next() {
+		var terminal db.Terminal
+		if err := rows.Scan(&terminal.ID, &terminal.OutletID, &terminal.Name, &terminal.Active, &terminal.LastSeenAt, &terminal.CreatedAt, &terminal.UpdatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		terminals = append(terminals, terminal)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "terminals": terminals})
+}
+
+// CreateTerminal registers a POS device at the current outlet. The device key is only returned here;
+// the terminal stores it and sends it with every PIN login.
+func CreateTerminal(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nama terminal wajib diisi"})
+	}
+
+	deviceKey, err := utils.GenerateToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	var id int
+	err = dbConn.QueryRow("INSERT INTO terminals (outlet_id, name, device_key_hash) VALUES ($1, $2, $3) RETURNING id",
+		identity.OutletID, strings.TrimSpace(req.Name), utils.HashToken(deviceKey)).Scan(&id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "id": id, "device_key": deviceKey})
+}
+
+// UpdateTerminal renames or (de)activates a terminal. Deactivating it ends
+// every PIN session opened on it.
+func UpdateTerminal(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Name   string `json:"name"`
+		Active *bool  `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	res, err := dbConn.Exec(`
+	UPDATE terminals
+	SET name = COALESCE(NULLIF($1, ''), name),
+	    active = COALESCE($2, active),
+	    updated_at = NOW()
+	WHERE id = $3 AND outlet_id = $4`, strings.TrimSpace(req.Name), req.Active, c.Params("id"), identity.OutletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Terminal tidak ditemukan"})
+	}
+
+	if req.Active != nil && !*req.Active {
+		if _, err := dbConn.Exec("UPDATE auth_sessions SET revoked_at = NOW() WHERE terminal_id = $1 AND revoked_at IS NULL", c.Params("id")); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// PINLogin signs a staff member in on a registered POS terminal with their
+// username and PIN. The token is limited to db.POSPermissions.
+func PINLogin(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		DeviceKey string `json:"device_key"`
+		Username  string `json:"username"`
+		PIN       string `json:"pin"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Permintaan tidak valid"}})
+	}
+	if req.DeviceKey == "" {
+		req.DeviceKey = c.Get("X-Terminal-Key")
+	}
+
+	var terminalID, outletID int
+	err := dbConn.QueryRow("SELECT id, outlet_id FROM terminals WHERE device_key_hash = $1 AND active = true", utils.HashToken(req.DeviceKey)).Scan(&terminalID, &outletID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "errors": []string{"Terminal tidak terdaftar"}})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	// PINs are short, so they get the same throttling as passwords
+	ip := c.IP()
+	if wait, err := checkIPThrottle(dbConn, ip); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	identifier := "pin:" + req.Username
+	user, err := db.GetUserPIN(dbConn, strings.TrimSpace(req.Username))
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if err == sql.ErrNoRows || user.Password == "" {
+		if wait, err := checkIdentifierThrottle(dbConn, identifier); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+		} else if wait > 0 {
+			return tooManyAttempts(c, wait)
+		}
+		compareDummyPassword(req.PIN)
+		if err := recordLoginAttempt(dbConn, identifier, ip, 0, false); err != nil {
+			log.Printf("pin login: failed to record attempt for unknown username on terminal %d: %v", terminalID, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Username atau PIN salah"}})
+	}
+
+	if wait, err := checkAccountThrottle(dbConn, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	if !utils.ComparePassword(user.Password, req.PIN) {
+		if err := recordLoginAttempt(dbConn, identifier, ip, user.ID, false); err != nil {
+			log.Printf("pin login: failed to record attempt for staff %d on terminal %d: %v", user.ID, terminalID, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Username atau PIN salah"}})
+	}
+	if err := recordLoginAttempt(dbConn, identifier, ip, user.ID, true); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	// The terminal decides the outlet; the cashier must work there
+	if assigned, err := db.StaffInOutlet(dbConn, user.ID, outletID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	} else if !assigned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "errors": []string{"Pengguna tidak ditempatkan di outlet terminal ini"}})
+	}
+
+	sessionID, err := db.CreateAuthSession(dbConn, user.ID, truncate(c.Get(fiber.HeaderUserAgent), 255), ip, terminalID, outletID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+	if _, err := dbConn.Exec("UPDATE terminals SET last_seen_at = NOW() WHERE id = $1", terminalID); err != nil {
+		log.Printf("pin login: failed to update last_seen_at of terminal %d: %v", terminalID, err)
+	}
+
+	token, err := middleware.GenerateScopedJWT(strconv.Itoa(user.ID), user.RoleID, sessionID, outletID, middleware.ScopePOS, PINTokenTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan dalam menghasilkan token"}})
+	}
+
+	user.Password = ""
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"user":       user,
+		"token":      token,
+		"expires_in": int(PINTokenTTL.Seconds()),
+		"scope":      middleware.ScopePOS,
+		"outlet_id":  outletID,
+	})
+}
+
+// SetOwnPIN sets the current user's POS PIN after confirming their password
+func SetOwnPIN(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	var req struct {
+		Password string `json:"password"`
+		PIN      string `json:"pin"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	user, err := db.GetUserByID(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if !utils.ComparePassword(user.Password, req.Password) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Kata sandi salah"})
+	}
+
+	if err := savePIN(dbConn, user.ID, req.PIN); err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "PIN berhasil disimpan"})
+}
+
+// SetUserPIN lets an admin set or reset the POS PIN of a staff member of
+// their outlet
+func SetUserPIN(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pengguna tidak valid"})
+	}
+	if err := requireOutletStaff(c, dbConn, id); err != nil {
+		return respondError(c, err)
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	if err := savePIN(dbConn, id, req.PIN); err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "PIN berhasil disimpan"})
+}
+
+func savePIN(dbConn *sql.DB, staffID int, pin string) error {
+	if !utils.ValidatePIN(pin) {
+		return fiber.NewError(fiber.StatusBadRequest, "PIN harus terdiri dari 4 sampai 6 angka")
+	}
+
+	pinHash, err := utils.GetHash(pin)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Gagal mengenkripsi PIN")
+	}
+
+	res, err := dbConn.Exec("UPDATE staffs SET pin_hash = $1, updated_at = NOW() WHERE id = $2", pinHash, staffID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Pengguna tidak ditemukan")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetupTrashRoutes sets up listing and restoring soft-deleted records.
+// Trashed records are purged for good by jobs.StartTrashPurge once they
+// are older than db.TrashRetentionDays, except for kept ones like order
+// lines.
+func SetupTrashRoutes(app *fiber.App, dbConn *sql.DB) {
+	canManage := middleware.RequirePermission(dbConn, db.PermissionTrashManage)
+
+	trashAPI := app.Group("/api/trash")
+	trashAPI.Get("/", canManage, func(c *fiber.Ctx) error {
+		return GetTrash(c, dbConn)
+	})
+	trashAPI.Post("/:type/:id/restore", canManage, func(c *fiber.Ctx) error {
+		return RestoreTrash(c, dbConn)
+	})
+}
+
+// trashTable looks up the trash type named by ?type= or the :type param
+func trashTable(trashType string) (db.TrashTable, error) {
+	table, ok := db.GetTrashTable(trashType)
+	if !ok {
+		return table, fiber.NewError(fiber.StatusBadRequest, "type harus staff, categories, menus, orders atau sessions")
+	}
+	return table, nil
+}
+
+// trashWhere scopes a trash query to the current outlet when the table
+// belongs to one, numbering its own parameters after the outlet's $1
+func trashWhere(table db.TrashTable, outletID int, args ...interface{}) (string, []interface{}) {
+	if table.OutletScope == "" {
+		return "x.deleted_at IS NOT NULL", args
+	}
+	return "x.deleted_at IS NOT NULL AND " + table.OutletScope, append([]interface{}{outletID}, args...)
+}
+
+// GetTrash lists the soft-deleted records of one ?type=, newest first
+func GetTrash(c *fiber.Ctx, dbConn *sql.DB) error {
+	trashType := c.Query("type", db.TrashOrders)
+	table, err := trashTable(trashType)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	where, args := trashWhere(table, middleware.CurrentIdentity(c).OutletID)
+	purgeAt := "NULL::text"
+	if !table.Kept {
+		args = append(args, db.TrashRetentionDays())
+		purgeAt = "(x.deleted_at + make_interval(days => $" + strconv.Itoa(len(args)) + "))::text"
+	}
+	rows, err := dbConn.Query(`
+	SELECT x.id, `+table.Label+`, x.deleted_at::text, COALESCE(x.deleted_by, 0), COALESCE(d.name, ''), `+purgeAt+`
+	FROM `+table.Table+` x
+	LEFT JOIN staffs d ON d.id = x.deleted_by
+	WHERE `+where+`
+	ORDER BY x.deleted_at DESC`, args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	items := []db.TrashItem{}
+	for rows.Next() {
+		var item db.TrashItem
+		if err := rows.Scan(&item.ID, &item.Label, &item.DeletedAt, &item.DeletedBy, &item.DeletedByName, &item.PurgeAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "type": trashType, "retention_days": db.TrashRetentionDays(), "items": items})
+}
+
+// RestoreTrash takes a record out of the trash. Staff get their outlet
+// assignments back but must log in again; sessions and orders come back
+// closed and cancelled as they were. A menu can't be restored into a
+// category that is itself in the trash.
+func RestoreTrash(c *fiber.Ctx, dbConn *sql.DB) error {
+	trashType := c.Params("type")
+	table, err := trashTable(trashType)
+	if err != nil {
+		return respondError(c, err)
+	}
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID tidak valid"})
+	}
+
+	if trashType == db.TrashMenus {
+		var categoryDeleted bool
+		err := dbConn.QueryRow("SELECT c.deleted_at IS NOT NULL FROM menus m JOIN categories c ON c.id = m.category_id WHERE m.id = $1", id).Scan(&categoryDeleted)
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if categoryDeleted {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Kategori menu ini ada di tempat sampah, pulihkan kategorinya terlebih dahulu"})
+		}
+	}
+
+	set := "deleted_at = NULL, deleted_by = NULL"
+	if trashType == db.TrashMenus {
+		set += ", deleted = false"
+	}
+	where, args := trashWhere(table, middleware.CurrentIdentity(c).OutletID, id)
+	result, err := dbConn.Exec(`UPDATE `+table.Table+` x SET `+set+` WHERE x.id = $`+strconv.Itoa(len(args))+` AND `+where, args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Data tidak ditemukan di tempat sampah"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
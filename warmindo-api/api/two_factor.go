@@ -0,0 +1,368 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// TwoFactorIssuer is the account label shown in authenticator apps
+	TwoFactorIssuer = "Warmindo"
+	// RecoveryCodeCount is how many one-time recovery codes are issued on enrollment
+	RecoveryCodeCount = 10
+)
+
+// SetupTwoFactorRoutes sets up TOTP enrollment for the current user, the
+// second login step and the per-role 2FA policy
+func SetupTwoFactorRoutes(app *fiber.App, dbConn *sql.DB) {
+	// AuthMiddleware only: these must stay reachable while enrollment is required
+	authenticated := middleware.AuthMiddleware(dbConn)
+
+	twoFactorAPI := app.Group("/api/me/2fa")
+	twoFactorAPI.Post("/setup", authenticated, func(c *fiber.Ctx) error {
+		return SetupTwoFactor(c, dbConn)
+	})
+	twoFactorAPI.Post("/enable", authenticated, func(c *fiber.Ctx) error {
+		return EnableTwoFactor(c, dbConn)
+	})
+	twoFactorAPI.Post("/disable", authenticated, func(c *fiber.Ctx) error {
+		return DisableTwoFactor(c, dbConn)
+	})
+	twoFactorAPI.Post("/recovery-codes", authenticated, func(c *fiber.Ctx) error {
+		return RegenerateRecoveryCodes(c, dbConn)
+	})
+
+	app.Post("/api/auth/login/2fa", func(c *fiber.Ctx) error {
+		return VerifyTwoFactorLogin(c, dbConn)
+	})
+	app.Put("/api/roles/:id/2fa-policy", middleware.RequirePermission(dbConn, db.PermissionRolesManage), func(c *fiber.Ctx) error {
+		return SetRoleTwoFactorPolicy(c, dbConn)
+	})
+}
+
+type twoFactorState struct {
+	Secret   sql.NullString
+	Enabled  bool
+	LastStep sql.NullInt64
+}
+
+func getTwoFactorState(dbConn *sql.DB, staffID int) (*twoFactorState, error) {
+	var state twoFactorState
+	err := dbConn.QueryRow("SELECT totp_secret, totp_enabled, totp_last_step FROM staffs WHERE id = $1", staffID).
+		Scan(&state.Secret, &state.Enabled, &state.LastStep)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// checkTOTP validates a code and records its time step so the same code can't
+// be replayed within its validity window
+func checkTOTP(dbConn *sql.DB, staffID int, state *twoFactorState, code string) (bool, error) {
+	if !state.Secret.Valid {
+		return false, nil
+	}
+
+	step, ok := utils.ValidateTOTP(state.Secret.String, code, time.Now())
+	if !ok || (state.LastStep.Valid && step <= state.LastStep.Int64) {
+		return false, nil
+	}
+
+	_, err := dbConn.Exec("UPDATE staffs SET totp_last_step = $1 WHERE id = $2", step, staffID)
+	return err == nil, err
+}
+
+// useRecoveryCode consumes one of the staff member's unused recovery codes
+func useRecoveryCode(dbConn *sql.DB, staffID int, code string) (bool, error) {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	res, err := dbConn.Exec("UPDATE recovery_codes SET used_at = NOW() WHERE staff_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		staffID, utils.HashToken(code))
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// replaceRecoveryCodes discards existing recovery codes and returns a fresh set
+func replaceRecoveryCodes(dbConn *sql.DB, staffID int) ([]string, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE staff_id = $1", staffID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw, err := utils.GenerateToken(5)
+		if err != nil {
+			return nil, err
+		}
+		raw = strings.ToUpper(raw)
+		if _, err := tx.Exec("INSERT INTO recovery_codes (staff_id, code_hash) VALUES ($1, $2)", staffID, utils.HashToken(raw)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+
+	return codes, tx.Commit()
+}
+
+// SetupTwoFactor generates a new TOTP secret for the current user. It only
+// takes effect once confirmed with EnableTwoFactor.
+func SetupTwoFactor(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	user, err := db.GetUserByID(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	state, err := getTwoFactorState(dbConn, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if state.Enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Autentikasi dua faktor sudah aktif"})
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := dbConn.Exec("UPDATE staffs SET totp_secret = $1, totp_last_step = NULL WHERE id = $2", secret, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":          true,
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(TwoFactorIssuer, user.Email, secret),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app
+// and returns the recovery codes, which are only shown once
+func EnableTwoFactor(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	state, err := getTwoFactorState(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if state.Enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Autentikasi dua faktor sudah aktif"})
+	}
+	if !state.Secret.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Jalankan setup terlebih dahulu"})
+	}
+
+	valid, err := checkTOTP(dbConn, identity.UserID, state, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kode tidak valid"})
+	}
+
+	if _, err := dbConn.Exec("UPDATE staffs SET totp_enabled = true, updated_at = NOW() WHERE id = $1", identity.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+
+	codes, err := replaceRecoveryCodes(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal membuat kode pemulihan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "recovery_codes": codes})
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current
+// code. It is refused when the user's role requires 2FA.
+func DisableTwoFactor(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	var required bool
+	if err := dbConn.QueryRow("SELECT require_2fa FROM roles WHERE id = $1", identity.RoleID).Scan(&required); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if required {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Peran Anda mewajibkan autentikasi dua faktor"})
+	}
+
+	user, err := db.GetUserByID(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if !utils.ComparePassword(user.Password, req.Password) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Kata sandi salah"})
+	}
+
+	state, err := getTwoFactorState(dbConn, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if valid, err := checkTOTP(dbConn, user.ID, state, req.Code); err != nil || !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kode tidak valid"})
+	}
+
+	if _, err := dbConn.Exec("UPDATE staffs SET totp_enabled = false, totp_secret = NULL, totp_last_step = NULL, updated_at = NOW() WHERE id = $1", user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if _, err := dbConn.Exec("DELETE FROM recovery_codes WHERE staff_id = $1", user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Autentikasi dua faktor dinonaktifkan"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current code
+func RegenerateRecoveryCodes(c *fiber.Ctx, dbConn *sql.DB) error {
+	identity := middleware.CurrentIdentity(c)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	state, err := getTwoFactorState(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kesalahan database"})
+	}
+	if !state.Enabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Autentikasi dua faktor belum aktif"})
+	}
+	if valid, err := checkTOTP(dbConn, identity.UserID, state, req.Code); err != nil || !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Kode tidak valid"})
+	}
+
+	codes, err := replaceRecoveryCodes(dbConn, identity.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal membuat kode pemulihan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "recovery_codes": codes})
+}
+
+// twoFactorChallenge answers the password step of a login for a user with 2FA enabled
+func twoFactorChallenge(c *fiber.Ctx, user *db.User) error {
+	challenge, err := middleware.GenerateChallengeJWT(fmt.Sprint(user.ID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan dalam menghasilkan token"}})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":             true,
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+		"expires_in":          int(middleware.TwoFactorChallengeTTL.Seconds()),
+	})
+}
+
+// VerifyTwoFactorLogin completes a login with the challenge token from the
+// password step and either a TOTP code or a recovery code
+func VerifyTwoFactorLogin(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		OutletID       int    `json:"outlet_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "errors": []string{"Permintaan tidak valid"}})
+	}
+
+	staffID, err := middleware.ParseChallengeJWT(req.ChallengeToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Sesi masuk telah berakhir, silakan ulangi"}})
+	}
+
+	ip := c.IP()
+	if wait, err := checkAccountThrottle(dbConn, staffID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	user, err := db.GetUserByID(dbConn, staffID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Sesi masuk telah berakhir, silakan ulangi"}})
+	}
+	state, err := getTwoFactorState(dbConn, staffID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	var valid bool
+	if req.RecoveryCode != "" {
+		valid, err = useRecoveryCode(dbConn, staffID, req.RecoveryCode)
+	} else {
+		valid, err = checkTOTP(dbConn, staffID, state, req.Code)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	identifier := "2fa:" + user.Email
+	if !valid {
+		if err := recordLoginAttempt(dbConn, identifier, ip, staffID, false); err != nil {
+			log.Printf("two-factor login: failed to record attempt for staff %d from %s: %v", staffID, ip, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"success": false, "errors": []string{"Kode tidak valid"}})
+	}
+	if err := recordLoginAttempt(dbConn, identifier, ip, staffID, true); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "errors": []string{"Kesalahan database"}})
+	}
+
+	return completeLogin(c, dbConn, user, req.OutletID)
+}
+
+// SetRoleTwoFactorPolicy makes 2FA mandatory (or optional) for every staff
+// member with the role. Members who haven't enrolled are restricted to the
+// enrollment endpoints until they do.
+func SetRoleTwoFactorPolicy(c *fiber.Ctx, dbConn *sql.DB) error {
+	var req struct {
+		Require2FA bool `json:"require_2fa"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+
+	res, err := dbConn.Exec("UPDATE roles SET require_2fa = $1, updated_at = NOW() WHERE id = $2", req.Require2FA, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Peran tidak ditemukan"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
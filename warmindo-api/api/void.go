@@ -0,0 +1,478 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"warmindo-api/db"
+	"warmindo-api/export"
+	"warmindo-api/middleware"
+	"warmindo-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// voidApproval is a manager's username and PIN, entered on the device of the
+// staff member asking for the void or refund
+type voidApproval struct {
+	Username string `json:"username"`
+	PIN      string `json:"pin"`
+}
+
+// approvalRequiredError asks for a manager's approval of a void or refund
+// above the outlet's threshold
+type approvalRequiredError struct {
+	threshold int
+}
+
+func (e *approvalRequiredError) Error() string {
+	return fmt.Sprintf("Pembatalan atau pengembalian di atas %d memerlukan persetujuan manajer", e.threshold)
+}
+
+// voidError answers like respondError, flagging requests that need a
+// manager's approval so the client can ask for one
+func voidError(c *fiber.Ctx, err error) error {
+	if e, ok := err.(*approvalRequiredError); ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": e.Error(), "approval_required": true, "threshold": e.threshold})
+	}
+	if e, ok := err.(*throttledError); ok {
+		retryAfter := int(math.Ceil(e.wait.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, fmt.Sprint(retryAfter))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": e.Error(), "retry_after": retryAfter})
+	}
+	return respondError(c, err)
+}
+
+// throttledError holds off manager PIN checks after too many failures
+type throttledError struct {
+	wait time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return "Terlalu banyak percobaan PIN, coba lagi nanti"
+}
+
+// approveVoid decides whether a void or refund may go ahead. value is
+// everything voided off the line or refunded from the payment so far, this
+// request included, so that splitting one up doesn't keep each part under
+// the threshold. Up to the outlet's threshold it may. Above it the staff member needs the
+// approval permission, or a manager who has it enters their PIN; PIN checks
+// are throttled like PIN logins. It returns the approving staff member, or 0
+// when no approval was needed.
+func approveVoid(c *fiber.Ctx, dbConn *sql.DB, value int, approval *voidApproval) (int, error) {
+	identity := middleware.CurrentIdentity(c)
+	var threshold int
+	if err := dbConn.QueryRow("SELECT void_approval_threshold FROM settings WHERE outlet_id = $1", identity.OutletID).Scan(&threshold); err != nil {
+		return 0, err
+	}
+	if value <= threshold {
+		return 0, nil
+	}
+	if identity.HasPermission(db.PermissionOrdersApproveVoid) {
+		return identity.UserID, nil
+	}
+	if approval == nil || strings.TrimSpace(approval.Username) == "" || approval.PIN == "" {
+		return 0, &approvalRequiredError{threshold}
+	}
+
+	ip := c.IP()
+	if wait, err := checkIPThrottle(dbConn, ip); err != nil {
+		return 0, err
+	} else if wait > 0 {
+		return 0, &throttledError{wait}
+	}
+
+	identifier := "approval:" + approval.Username
+	manager, err := db.GetUserPIN(dbConn, strings.TrimSpace(approval.Username))
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == sql.ErrNoRows || manager.Password == "" {
+		compareDummyPassword(approval.PIN)
+		if err := recordLoginAttempt(dbConn, identifier, ip, 0, false); err != nil {
+			return 0, err
+		}
+		return 0, fiber.NewError(fiber.StatusForbidden, "Username atau PIN manajer salah")
+	}
+
+	if wait, err := checkAccountThrottle(dbConn, manager.ID); err != nil {
+		return 0, err
+	} else if wait > 0 {
+		return 0, &throttledError{wait}
+	}
+	if !utils.ComparePassword(manager.Password, approval.PIN) {
+		if err := recordLoginAttempt(dbConn, identifier, ip, manager.ID, false); err != nil {
+			return 0, err
+		}
+		return 0, fiber.NewError(fiber.StatusForbidden, "Username atau PIN manajer salah")
+	}
+	if err := recordLoginAttempt(dbConn, identifier, ip, manager.ID, true); err != nil {
+		return 0, err
+	}
+
+	assigned, err := db.StaffInOutlet(dbConn, manager.ID, identity.OutletID)
+	if err != nil {
+		return 0, err
+	}
+	permissions, err := db.GetRolePermissions(dbConn, manager.RoleID)
+	if err != nil {
+		return 0, err
+	}
+	if !assigned || !containsString(permissions, db.PermissionOrdersApproveVoid) {
+		return 0, fiber.NewError(fiber.StatusForbidden, "Staf ini tidak berwenang menyetujui pembatalan")
+	}
+	return manager.ID, nil
+}
+
+// voidRequest takes quantity off an order line with the reason why
+type voidRequest struct {
+	Quantity int           `json:"quantity"`
+	Reason   string        `json:"reason"`
+	Approval *voidApproval `json:"approval"`
+}
+
+// VoidOrder takes part of an order line's quantity off. Voiding the whole
+// remaining quantity, or leaving quantity out, cancels the line.
+func VoidOrder(c *fiber.Ctx, dbConn *sql.DB) error {
+	return voidOrderLine(c, dbConn, false)
+}
+
+// CancelOrder cancels an order line. The line is kept, with the cancelled
+// status, for reporting.
+func CancelOrder(c *fiber.Ctx, dbConn *sql.DB) error {
+	return voidOrderLine(c, dbConn, true)
+}
+
+// voidQuantity is how many of a line's ordered units a void takes: the
+// requested ones, or all of them when cancelling or when requested is 0.
+// cancelled tells whether that leaves nothing of the line; ok is false when
+// more are requested than were ordered.
+func voidQuantity(ordered, requested int, cancel bool) (quantity int, cancelled, ok bool) {
+	quantity = requested
+	if cancel || quantity == 0 {
+		quantity = ordered
+	}
+	return quantity, quantity == ordered, quantity <= ordered
+}
+
+// voidTotal is what voiding quantity units sold at unitPrice is worth, the
+// amount refunded when the line was paid. approvalValue adds what was voided
+// off the line before and is what the approval threshold is checked against.
+func voidTotal(quantity, unitPrice, voided int) (total, approvalValue int) {
+	total = quantity * unitPrice
+	return total, voided + total
+}
+
+func voidOrderLine(c *fiber.Ctx, dbConn *sql.DB, cancel bool) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pesanan tidak valid"})
+	}
+	var req voidRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Alasan pembatalan wajib diisi"})
+	}
+	if req.Quantity < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Jumlah tidak boleh negatif"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	void := db.OrderVoid{OrderID: id, Reason: req.Reason, StaffID: identity.UserID}
+	var amount, paymentID int
+	var cancelled bool
+	err = tx.QueryRow(`
+	SELECT o.order_code, o.menu_id, m.name, o.amount, o.unit_price, COALESCE(o.payment_id, 0), o.cancelled_at IS NOT NULL
+	FROM orders o
+	JOIN menus m ON m.id = o.menu_id
+	WHERE o.id = $1 AND o.outlet_id = $2
+	FOR UPDATE OF o`, id, identity.OutletID).Scan(&void.OrderCode, &void.MenuID, &void.MenuName, &amount, &void.UnitPrice, &paymentID, &cancelled)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pesanan tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if cancelled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Pesanan sudah dibatalkan"})
+	}
+
+	var ok bool
+	void.Quantity, void.Cancelled, ok = voidQuantity(amount, req.Quantity, cancel)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Jumlah yang dibatalkan melebihi jumlah pesanan"})
+	}
+
+	var voided, approvalValue int
+	if err := tx.QueryRow("SELECT COALESCE(SUM(quantity * unit_price), 0) FROM order_voids WHERE order_id = $1", id).Scan(&voided); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	void.Total, approvalValue = voidTotal(void.Quantity, void.UnitPrice, voided)
+	void.ApprovedBy, err = approveVoid(c, dbConn, approvalValue, req.Approval)
+	if err != nil {
+		return voidError(c, err)
+	}
+
+	err = tx.QueryRow(db.CreateOrderVoidQuery, id, identity.OutletID, void.Quantity, void.UnitPrice, void.Cancelled, void.Reason, void.StaffID, void.ApprovedBy).
+		Scan(&void.ID, &void.CreatedAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if void.Cancelled {
+		_, err = tx.Exec(db.CancelOrderQuery, db.StatusCancelled, id, identity.OutletID, identity.UserID)
+	} else {
+		_, err = tx.Exec("UPDATE orders SET amount = amount - $1, updated_at = NOW() WHERE id = $2", void.Quantity, id)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// A line that was already paid for is voided all the same; the money goes
+	// back through a refund on its payment
+	response := fiber.Map{"success": true, "void": void}
+	if paymentID != 0 {
+		response["payment_id"] = paymentID
+		response["refund_due"] = void.Total
+	}
+	return c.JSON(response)
+}
+
+// GetPayment shows a payment of the current outlet with its refunds
+func GetPayment(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pembayaran tidak valid"})
+	}
+
+	var payment db.Payment
+	err = dbConn.QueryRow(`
+	SELECT id, outlet_id, order_code, method, amount, tendered, change, COALESCE(shift_id, 0), staff_id, created_at::text
+	FROM payments WHERE id = $1 AND outlet_id = $2`, id, middleware.CurrentIdentity(c).OutletID).
+		Scan(&payment.ID, &payment.OutletID, &payment.OrderCode, &payment.Method, &payment.Amount, &payment.Tendered,
+			&payment.Change, &payment.ShiftID, &payment.StaffID, &payment.CreatedAt)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pembayaran tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := dbConn.Query(`
+	SELECT id, payment_id, outlet_id, amount, reason, COALESCE(shift_id, 0), staff_id, COALESCE(approved_by, 0), created_at::text
+	FROM refunds WHERE payment_id = $1 ORDER BY created_at, id`, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	refunds := []db.Refund{}
+	refunded := 0
+	for rows.Next() {
+		refund := db.Refund{OrderCode: payment.OrderCode, Method: payment.Method}
+		if err := rows.Scan(&refund.ID, &refund.PaymentID, &refund.OutletID, &refund.Amount, &refund.Reason,
+			&refund.ShiftID, &refund.StaffID, &refund.ApprovedBy, &refund.CreatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		refunds = append(refunds, refund)
+		refunded += refund.Amount
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "payment": payment, "refunds": refunds, "refundable": payment.Amount - refunded})
+}
+
+// refundAmount is what a refund asking for requested gives back of what is
+// still refundable, all of it when requested is 0; ok is false when that is
+// more than is left
+func refundAmount(requested, refundable int) (amount int, ok bool) {
+	amount = requested
+	if amount == 0 {
+		amount = refundable
+	}
+	return amount, amount > 0 && amount <= refundable
+}
+
+// CreateRefund gives back part (amount) or the rest of a payment by the
+// payment's method, with the reason why. Cash comes out of the drawer, so it
+// takes an open shift. Refunds above the outlet's threshold need a
+// manager's approval like voids.
+func CreateRefund(c *fiber.Ctx, dbConn *sql.DB) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID pembayaran tidak valid"})
+	}
+	var req struct {
+		Amount   int           `json:"amount"`
+		Reason   string        `json:"reason"`
+		Approval *voidApproval `json:"approval"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Alasan pengembalian wajib diisi"})
+	}
+	if req.Amount < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Jumlah tidak boleh negatif"})
+	}
+
+	identity := middleware.CurrentIdentity(c)
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	// Locking the payment keeps concurrent refunds from going over it
+	refund := db.Refund{PaymentID: id, OutletID: identity.OutletID, Reason: req.Reason, StaffID: identity.UserID}
+	var paid int
+	err = tx.QueryRow("SELECT order_code, method, amount FROM payments WHERE id = $1 AND outlet_id = $2 FOR UPDATE", id, identity.OutletID).
+		Scan(&refund.OrderCode, &refund.Method, &paid)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pembayaran tidak ditemukan"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	var refunded int
+	if err := tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = $1", id).Scan(&refunded); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	refundable := paid - refunded
+	if refundable <= 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Pembayaran sudah dikembalikan seluruhnya"})
+	}
+	var ok bool
+	if refund.Amount, ok = refundAmount(req.Amount, refundable); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Jumlah pengembalian melebihi sisa pembayaran", "refundable": refundable})
+	}
+
+	refund.ShiftID, err = lockOpenShift(tx, identity.UserID, identity.OutletID, false)
+	if err == errNoOpenShift && refund.Method != db.PaymentCash {
+		err = nil
+	}
+	if err == errNoOpenShift {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Buka shift terlebih dahulu untuk mengembalikan uang tunai"})
+	}
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	refund.ApprovedBy, err = approveVoid(c, dbConn, refunded+refund.Amount, req.Approval)
+	if err != nil {
+		return voidError(c, err)
+	}
+
+	err = tx.QueryRow(db.CreateRefundQuery, refund.PaymentID, refund.OutletID, refund.Amount, refund.Reason, refund.ShiftID, refund.StaffID, refund.ApprovedBy).
+		Scan(&refund.ID, &refund.CreatedAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "refund": refund, "refundable": refundable - refund.Amount})
+}
+
+// voidsReport is an outlet's voids and cancellations over a range of days
+type voidsReport struct {
+	Totals db.VoidTotals  `json:"totals"`
+	Voids  []db.OrderVoid `json:"voids"`
+}
+
+// GetVoidsReport lists the current outlet's voids and cancellations made on
+// ?date= or ?from=&to=, with who made and who approved them. ?format=
+// exports it as a file.
+func GetVoidsReport(c *fiber.Ctx, dbConn *sql.DB) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	outletID := middleware.CurrentIdentity(c).OutletID
+	from, to, err := reportRange(c, dbConn, outletID)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	rows, err := dbConn.Query(`
+	SELECT v.id, v.order_id, o.order_code, o.menu_id, m.name, v.quantity, v.unit_price, v.quantity * v.unit_price,
+	       v.cancelled, v.reason, v.staff_id, st.name, COALESCE(v.approved_by, 0), COALESCE(ap.name, ''), v.created_at::text
+	FROM order_voids v
+	JOIN orders o ON o.id = v.order_id
+	JOIN menus m ON m.id = o.menu_id
+	JOIN staffs st ON st.id = v.staff_id
+	LEFT JOIN staffs ap ON ap.id = v.approved_by
+	JOIN settings s ON s.outlet_id = v.outlet_id
+	WHERE v.outlet_id = $1
+	  AND ((v.created_at AT TIME ZONE current_setting('TimeZone')) AT TIME ZONE s.timezone)::date BETWEEN $2::date AND $3::date
+	ORDER BY v.created_at, v.id`, outletID, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	report := voidsReport{Voids: []db.OrderVoid{}}
+	for rows.Next() {
+		var v db.OrderVoid
+		if err := rows.Scan(&v.ID, &v.OrderID, &v.OrderCode, &v.MenuID, &v.MenuName, &v.Quantity, &v.UnitPrice, &v.Total,
+			&v.Cancelled, &v.Reason, &v.StaffID, &v.StaffName, &v.ApprovedBy, &v.ApproverName, &v.CreatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		report.Voids = append(report.Voids, v)
+		report.Totals.Count++
+		report.Totals.Quantity += v.Quantity
+		report.Totals.Total += v.Total
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		return sendExport(c, format, "laporan-pembatalan-"+from+"-"+to, "Laporan Pembatalan "+periodLabel(from, to), report.export)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"outlet_id": outletID,
+		"from":      from,
+		"to":        to,
+		"totals":    report.Totals,
+		"voids":     report.Voids,
+	})
+}
+
+func (r *voidsReport) export(w export.Writer) error {
+	if err := w.Section("Pembatalan", []string{"Waktu", "Kode pesanan", "Menu", "Jumlah", "Harga", "Total", "Jenis", "Alasan", "Staf", "Disetujui oleh"}); err != nil {
+		return err
+	}
+	for _, v := range r.Voids {
+		kind := "Sebagian"
+		if v.Cancelled {
+			kind = "Batal"
+		}
+		if err := w.Row(v.CreatedAt, v.OrderCode, v.MenuName, v.Quantity, v.UnitPrice, v.Total, kind, v.Reason, v.StaffName, v.ApproverName); err != nil {
+			return err
+		}
+	}
+	return w.Row("Total", "", "", r.Totals.Quantity, "", r.Totals.Total)
+}
@@ -0,0 +1,79 @@
+package api
+
+import "testing"
+
+func TestVoidQuantity(t *testing.T) {
+	tests := []struct {
+		name          string
+		ordered       int
+		requested     int
+		cancel        bool
+		wantQuantity  int
+		wantCancelled bool
+		wantOK        bool
+	}{
+		{"part of the line", 5, 2, false, 2, false, true},
+		{"all of it by count", 5, 5, false, 5, true, true},
+		{"all of it by default", 5, 0, false, 5, true, true},
+		{"cancel ignores the count", 5, 2, true, 5, true, true},
+		{"more than ordered", 5, 6, false, 6, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quantity, cancelled, ok := voidQuantity(tt.ordered, tt.requested, tt.cancel)
+			if ok != tt.wantOK {
+				t.Fatalf("voidQuantity ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (quantity != tt.wantQuantity || cancelled != tt.wantCancelled) {
+				t.Errorf("voidQuantity = %d, cancelled %v; want %d, cancelled %v", quantity, cancelled, tt.wantQuantity, tt.wantCancelled)
+			}
+		})
+	}
+}
+
+func TestVoidTotal(t *testing.T) {
+	tests := []struct {
+		name         string
+		quantity     int
+		unitPrice    int
+		voided       int
+		wantTotal    int
+		wantApproval int
+	}{
+		{"first void", 1, 12000, 0, 12000, 12000},
+		{"after earlier voids", 2, 12000, 36000, 24000, 60000},
+		{"free item", 2, 0, 12000, 0, 12000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, approval := voidTotal(tt.quantity, tt.unitPrice, tt.voided)
+			if total != tt.wantTotal || approval != tt.wantApproval {
+				t.Errorf("voidTotal(%d, %d, %d) = %d, %d; want %d, %d", tt.quantity, tt.unitPrice, tt.voided, total, approval, tt.wantTotal, tt.wantApproval)
+			}
+		})
+	}
+}
+
+func TestRefundAmount(t *testing.T) {
+	tests := []struct {
+		name       string
+		requested  int
+		refundable int
+		want       int
+		wantOK     bool
+	}{
+		{"part of it", 10000, 37000, 10000, true},
+		{"exactly the rest", 37000, 37000, 37000, true},
+		{"the rest by default", 0, 27000, 27000, true},
+		{"more than is left", 30000, 27000, 30000, false},
+		{"nothing left", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := refundAmount(tt.requested, tt.refundable)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("refundAmount(%d, %d) = %d, %v; want %d, %v", tt.requested, tt.refundable, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
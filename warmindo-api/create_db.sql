@@ -1,81 +1,12 @@
 -- Create Database
 CREATE DATABASE warmindo;
 
--- Connect to the newly created database
-\c warmindo;
-
--- Create Tables
-CREATE TABLE roles (
-    id SERIAL PRIMARY KEY,
-    name VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE statuses (
-    id SERIAL PRIMARY KEY,
-    name VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE categories (
-    id SERIAL PRIMARY KEY,
-    name VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE staffs (
-    id SERIAL PRIMARY KEY,
-    email VARCHAR(255) NOT NULL UNIQUE,
-    password VARCHAR(255) NOT NULL,
-    name VARCHAR(255) NOT NULL,
-    username VARCHAR(255) NOT NULL UNIQUE,
-    role_id INTEGER NOT NULL REFERENCES roles(id),
-    phone VARCHAR(255),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE menus (
-    id SERIAL PRIMARY KEY,
-    name VARCHAR(255) NOT NULL,
-    image VARCHAR(255),
-    description TEXT,
-    deleted BOOLEAN,
-    price INTEGER NOT NULL,
-    category_id INTEGER NOT NULL REFERENCES categories(id),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE orders (
-    id SERIAL PRIMARY KEY,
-    order_code VARCHAR(255) NOT NULL,
-    amount INTEGER NOT NULL,
-    status_id INTEGER NOT NULL REFERENCES statuses(id),
-    order_date TIMESTAMP CURRENT_TIMESTAMP,
-    menu_id INTEGER NOT NULL REFERENCES menus(id),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE customers (
-    id SERIAL PRIMARY KEY,
-    order_code VARCHAR(255) NOT NULL,
-    name VARCHAR(255) NOT NULL,
-    table_number INTEGER NOT NULL,
-    start_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    end_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE settings (
-    id SERIAL PRIMARY KEY,
-    total_table INTEGER NOT NULL,
-    latitude DOUBLE PRECISION NOT NULL,
-    longitude DOUBLE PRECISION NOT NULL,
-    radius DOUBLE PRECISION NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+-- The schema is versioned in migrations/ and embedded in the binary. Apply it
+-- with `warmindo-api migrate up`; the server refuses to start while any
+-- migration is pending.
+--
+-- Databases created from the create_db.sql of earlier releases are upgraded
+-- the same way: 0001_initial creates the tables they are missing and fixes
+-- the columns that script got wrong, and the later migrations follow.
+-- `warmindo-api migrate baseline <version>` is only for a database whose
+-- schema was already brought up to that migration by hand.
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AuthSession struct {
+	ID         int    `json:"id"`
+	StaffID    int    `json:"staff_id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+const (
+	CreateAuthSessionQuery  = `INSERT INTO auth_sessions (staff_id, user_agent, ip_address, terminal_id, outlet_id) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	CreateRefreshTokenQuery = `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	GetActiveSessionQuery   = `SELECT st.role_id, (r.require_2fa AND NOT st.totp_enabled), s.outlet_id FROM auth_sessions s JOIN staffs st ON st.id = s.staff_id JOIN roles r ON r.id = st.role_id LEFT JOIN terminals t ON t.id = s.terminal_id JOIN outlets o ON o.id = s.outlet_id AND o.active JOIN staff_outlets so ON so.staff_id = s.staff_id AND so.outlet_id = s.outlet_id WHERE s.id = $1 AND s.staff_id = $2 AND s.revoked_at IS NULL AND st.deleted_at IS NULL AND (s.terminal_id IS NULL OR t.active)`
+	RevokeAuthSessionQuery  = `UPDATE auth_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	RevokeStaffSessionQuery = `UPDATE auth_sessions SET revoked_at = NOW() WHERE staff_id = $1 AND revoked_at IS NULL`
+	RevokeOtherSessionQuery = `UPDATE auth_sessions SET revoked_at = NOW() WHERE staff_id = $1 AND id <> $2 AND revoked_at IS NULL`
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// CreateAuthSession starts a login session for a staff member working in an
+// outlet. terminalID is set for PIN logins on a POS terminal and 0 otherwise.
+func CreateAuthSession(dbConn Execer, staffID int, userAgent, ipAddress string, terminalID, outletID int) (int, error) {
+	var sessionID int
+	err := dbConn.QueryRow(CreateAuthSessionQuery, staffID, userAgent, ipAddress, sql.NullInt64{Int64: int64(terminalID), Valid: terminalID != 0}, outletID).Scan(&sessionID)
+	return sessionID, err
+}
+
+// CreateRefreshToken stores the hash of a refresh token for a session
+func CreateRefreshToken(dbConn Execer, sessionID int, tokenHash string, expiresAt time.Time) error {
+	_, err := dbConn.Exec(CreateRefreshTokenQuery, sessionID, tokenHash, expiresAt)
+	return err
+}
+
+// ActiveSession is the current state of the staff member behind a session
+type ActiveSession struct {
+	RoleID int
+	// TwoFactorEnrollmentRequired is set when the role requires 2FA and the
+	// staff member hasn't enrolled yet
+	TwoFactorEnrollmentRequired bool
+	OutletID                    int
+}
+
+// GetActiveSession returns the current role of the staff member owning an
+// unrevoked session, or sql.ErrNoRows when the session was revoked, the staff
+// member deleted or removed from the session's outlet, the outlet closed or
+// the session's POS terminal deactivated.
+func GetActiveSession(dbConn *sql.DB, sessionID, staffID int) (*ActiveSession, error) {
+	var session ActiveSession
+	err := dbConn.QueryRow(GetActiveSessionQuery, sessionID, staffID).Scan(&session.RoleID, &session.TwoFactorEnrollmentRequired, &session.OutletID)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func RevokeAuthSession(dbConn Execer, sessionID int) error {
+	_, err := dbConn.Exec(RevokeAuthSessionQuery, sessionID)
+	return err
+}
+
+// RevokeOtherStaffSessions signs a staff member out everywhere except the given session
+func RevokeOtherStaffSessions(dbConn Execer, staffID, keepSessionID int) error {
+	_, err := dbConn.Exec(RevokeOtherSessionQuery, staffID, keepSessionID)
+	return err
+}
+
+// RevokeStaffSessions signs a staff member out everywhere
+func RevokeStaffSessions(dbConn Execer, staffID int) error {
+	_, err := dbConn.Exec(RevokeStaffSessionQuery, staffID)
+	return err
+}
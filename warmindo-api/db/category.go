@@ -3,6 +3,12 @@ package db
 type Category struct {
 	ID        int    `json:"id"`
 	Name      string `json:"name"`
+	Language  string `json:"language,omitempty"`
 	CreatedAt string `json:"created_at,omitempty"`
 	UpdatedAt string `json:"updated_at,omitempty"`
 }
+
+type CategoryTranslation struct {
+	Language string `json:"language"`
+	Name     string `json:"name"`
+}
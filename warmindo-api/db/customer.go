@@ -1,5 +1,13 @@
 package db
 
+// Why a customer session was closed
+const (
+	SessionClosedPaid   = "paid"
+	SessionClosedMerged = "merged"
+	SessionClosedManual = "manual"
+	SessionClosedIdle   = "idle"
+)
+
 type Customer struct {
 	ID          int    `json:"id"`
 	OrderCode   string `json:"order_code"`
@@ -8,3 +16,43 @@ type Customer struct {
 	StartDate   string `json:"start_date,omitempty"`
 	EndDate     string `json:"end_date,omitempty"`
 }
+
+// CustomerOrderCodeConstraint is the unique constraint on customers.order_code
+const CustomerOrderCodeConstraint = "customers_order_code_key"
+
+const (
+	// CustomerAccessQuery checks a customer access token against an order
+	// code. The token of a merged session keeps working for the target.
+	CustomerAccessQuery = `SELECT EXISTS (SELECT 1 FROM customers WHERE access_token_hash = $1 AND (order_code = $2 OR merged_into = $2))`
+
+	// CloseIdleSessionsQuery closes open sessions that have had no order for
+	// their outlet's settings.session_idle_minutes since they were opened or
+	// reopened
+	CloseIdleSessionsQuery = `
+	UPDATE customers cu
+	SET active = false, end_date = NOW(), closed_reason = 'idle'
+	FROM settings s
+	WHERE s.outlet_id = cu.outlet_id
+	  AND s.session_idle_minutes > 0
+	  AND cu.active = true
+	  AND COALESCE(cu.reopened_at, cu.start_date) < NOW() - make_interval(mins => s.session_idle_minutes)
+	  AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_code = cu.order_code)
+	RETURNING cu.order_code, cu.table_number`
+)
+
+// CustomerSession is a customer session as staff see it
+type CustomerSession struct {
+	OrderCode        string  `json:"order_code"`
+	TableNumber      int     `json:"table_number"`
+	TableLabel       string  `json:"table_label"`
+	Active           bool    `json:"active"`
+	StartDate        string  `json:"start_date"`
+	EndDate          *string `json:"end_date"`
+	ClosedReason     string  `json:"closed_reason,omitempty"`
+	ClosedBy         string  `json:"closed_by,omitempty"`
+	MergedInto       string  `json:"merged_into,omitempty"`
+	OrderLines       int     `json:"order_lines"`
+	OutstandingTotal int     `json:"outstanding_total"`
+	LastOrderAt      *string `json:"last_order_at"`
+	IdleClosesAt     *string `json:"idle_closes_at"`
+}
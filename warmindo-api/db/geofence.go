@@ -0,0 +1,49 @@
+package db
+
+// Geofence kinds
+const (
+	GeofenceCircle  = "circle"
+	GeofencePolygon = "polygon"
+)
+
+// Units a circle's radius can be given in
+const (
+	UnitMeters     = "m"
+	UnitKilometers = "km"
+)
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Geofence is an area diners must be in to open a session. A circle uses
+// Latitude, Longitude, Radius and RadiusUnit; a polygon uses Polygon.
+type Geofence struct {
+	ID         int        `json:"id"`
+	OutletID   int        `json:"outlet_id"`
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	Latitude   float64    `json:"latitude,omitempty"`
+	Longitude  float64    `json:"longitude,omitempty"`
+	Radius     float64    `json:"radius,omitempty"`
+	RadiusUnit string     `json:"radius_unit,omitempty"`
+	Polygon    []GeoPoint `json:"polygon,omitempty"`
+	Active     bool       `json:"active"`
+	CreatedAt  string     `json:"created_at,omitempty"`
+	UpdatedAt  string     `json:"updated_at,omitempty"`
+}
+
+// RadiusMeters is a circle's radius converted to metres
+func (g Geofence) RadiusMeters() float64 {
+	if g.RadiusUnit == UnitKilometers {
+		return g.Radius * 1000
+	}
+	return g.Radius
+}
+
+const (
+	GetGeofencesQuery = `SELECT id, outlet_id, name, kind, COALESCE(latitude, 0), COALESCE(longitude, 0), COALESCE(radius, 0), COALESCE(radius_unit, ''),
+	COALESCE(polygon::text, ''), active, created_at, updated_at FROM geofences`
+)
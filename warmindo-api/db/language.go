@@ -0,0 +1,17 @@
+package db
+
+// DefaultLanguage is the language stored directly on menus and categories.
+const DefaultLanguage = "id"
+
+// SupportedLanguages lists the languages menu content can be translated into,
+// with the default language first.
+var SupportedLanguages = []string{DefaultLanguage, "en"}
+
+func IsSupportedLanguage(lang string) bool {
+	for _, supported := range SupportedLanguages {
+		if supported == lang {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,13 @@ type Menu struct {
 	Description string `json:"description"`
 	Price       int    `json:"price"`
 	CategoryID  int    `json:"category_id"`
+	Language    string `json:"language,omitempty"`
 	CreatedAt   string `json:"created_at,omitempty"`
 	UpdatedAt   string `json:"updated_at,omitempty"`
 }
+
+type MenuTranslation struct {
+	Language    string `json:"language"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,98 @@
+package db
+
+import "database/sql"
+
+// DefaultOutletID is the outlet that existed before outlets were introduced.
+// Public endpoints that aren't told which outlet they serve fall back to it.
+const DefaultOutletID = 1
+
+type Outlet struct {
+	ID        int    `json:"id"`
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Phone     string `json:"phone"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// OutletMenu is a menu as sold at one outlet. Price is the outlet's override,
+// nil when the catalog price applies.
+type OutletMenu struct {
+	MenuID         int    `json:"menu_id"`
+	Name           string `json:"name"`
+	BasePrice      int    `json:"base_price"`
+	Price          *int   `json:"price"`
+	EffectivePrice int    `json:"effective_price"`
+	Available      bool   `json:"available"`
+}
+
+const (
+	GetOutletsQuery = `SELECT id, code, name, address, phone, active, created_at, updated_at FROM outlets`
+
+	// GetStaffOutletQuery returns the outlet if the staff member is assigned
+	// to it and it is active
+	GetStaffOutletQuery = `SELECT o.id, o.code, o.name, o.address, o.phone, o.active, o.created_at, o.updated_at
+	FROM outlets o JOIN staff_outlets so ON so.outlet_id = o.id
+	WHERE so.staff_id = $1 AND o.id = $2 AND o.active = true`
+
+	// GetDefaultStaffOutletQuery picks the first active outlet a staff member is assigned to
+	GetDefaultStaffOutletQuery = `SELECT o.id, o.code, o.name, o.address, o.phone, o.active, o.created_at, o.updated_at
+	FROM outlets o JOIN staff_outlets so ON so.outlet_id = o.id
+	WHERE so.staff_id = $1 AND o.active = true
+	ORDER BY o.id LIMIT 1`
+
+	GetStaffOutletsQuery = `SELECT o.id, o.code, o.name, o.address, o.phone, o.active, o.created_at, o.updated_at
+	FROM outlets o JOIN staff_outlets so ON so.outlet_id = o.id
+	WHERE so.staff_id = $1 AND o.active = true
+	ORDER BY o.id`
+
+	StaffInOutletQuery = `SELECT EXISTS (SELECT 1 FROM staff_outlets so JOIN staffs st ON st.id = so.staff_id WHERE so.staff_id = $1 AND so.outlet_id = $2 AND st.deleted_at IS NULL)`
+)
+
+func scanOutlet(row interface{ Scan(...interface{}) error }) (*Outlet, error) {
+	var outlet Outlet
+	err := row.Scan(&outlet.ID, &outlet.Code, &outlet.Name, &outlet.Address, &outlet.Phone, &outlet.Active, &outlet.CreatedAt, &outlet.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &outlet, nil
+}
+
+// GetStaffOutlet returns the outlet a staff member works in: outletID when
+// given, otherwise their first assigned outlet. sql.ErrNoRows means they
+// aren't assigned to it (or to any active outlet).
+func GetStaffOutlet(dbConn *sql.DB, staffID, outletID int) (*Outlet, error) {
+	if outletID == 0 {
+		return scanOutlet(dbConn.QueryRow(GetDefaultStaffOutletQuery, staffID))
+	}
+	return scanOutlet(dbConn.QueryRow(GetStaffOutletQuery, staffID, outletID))
+}
+
+// GetStaffOutlets lists the active outlets a staff member is assigned to
+func GetStaffOutlets(dbConn *sql.DB, staffID int) ([]Outlet, error) {
+	rows, err := dbConn.Query(GetStaffOutletsQuery, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outlets := []Outlet{}
+	for rows.Next() {
+		outlet, err := scanOutlet(rows)
+		if err != nil {
+			return nil, err
+		}
+		outlets = append(outlets, *outlet)
+	}
+	return outlets, rows.Err()
+}
+
+// StaffInOutlet reports whether a staff member is assigned to an outlet and
+// not in the trash
+func StaffInOutlet(dbConn *sql.DB, staffID, outletID int) (bool, error) {
+	var ok bool
+	err := dbConn.QueryRow(StaffInOutletQuery, staffID, outletID).Scan(&ok)
+	return ok, err
+}
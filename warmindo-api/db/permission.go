@@ -0,0 +1,74 @@
+package db
+
+import "database/sql"
+
+// Built-in roles seeded by create_db.sql.
+const (
+	RoleAdmin   = 1
+	RoleCashier = 2
+	RoleKitchen = 3
+)
+
+// Permission codes checked by middleware.RequirePermission.
+const (
+	PermissionMenusWrite         = "menus:write"
+	PermissionCategoriesWrite    = "categories:write"
+	PermissionOrdersRead         = "orders:read"
+	PermissionOrdersUpdate       = "orders:update"
+	PermissionOrdersUpdateStatus = "orders:update_status"
+	PermissionOrdersDelete       = "orders:delete"
+	PermissionUsersRead          = "users:read"
+	PermissionUsersWrite         = "users:write"
+	PermissionRolesRead          = "roles:read"
+	PermissionRolesManage        = "roles:manage"
+	PermissionSettingsRead       = "settings:read"
+	PermissionSettingsWrite      = "settings:write"
+	PermissionTerminalsManage    = "terminals:manage"
+	PermissionTablesManage       = "tables:manage"
+	PermissionOutletsManage      = "outlets:manage"
+	PermissionReportsRead        = "reports:read"
+	PermissionShiftsOperate      = "shifts:operate"
+	PermissionOrdersVoid         = "orders:void"
+	PermissionOrdersApproveVoid  = "orders:approve_void"
+	PermissionTrashManage        = "trash:manage"
+)
+
+// POSPermissions caps what a PIN login on a shared POS terminal can do,
+// whatever the staff member's role allows otherwise.
+var POSPermissions = []string{
+	PermissionOrdersRead,
+	PermissionOrdersUpdate,
+	PermissionOrdersUpdateStatus,
+	PermissionShiftsOperate,
+	PermissionOrdersVoid,
+}
+
+type Permission struct {
+	ID          int    `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+const (
+	GetRolePermissionsQuery = `SELECT p.code FROM permissions p JOIN role_permissions rp ON rp.permission_id = p.id WHERE rp.role_id = $1 ORDER BY p.code;`
+)
+
+// GetRolePermissions returns the permission codes granted to a role
+func GetRolePermissions(dbConn *sql.DB, roleID int) ([]string, error) {
+	rows, err := dbConn.Query(GetRolePermissionsQuery, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, code)
+	}
+
+	return permissions, rows.Err()
+}
@@ -13,15 +13,15 @@ const (
 	UpdateMenuQuery  = `UPDATE menus SET name = $1, image = $2, description = $3, price = $4, category_id = $5, updated_at = NOW() WHERE id = $6`
 	DeleteMenuQuery  = `DELETE FROM menus WHERE id = $1`
 
-	CreateOrderQuery  = `INSERT INTO orders (amount, table_number, status_id, order_date, menu_id) VALUES ($1, $2, $3, $4, $5)`
+	CreateOrderQuery  = `INSERT INTO orders (amount, table_number, status_id, order_date, menu_id, unit_price) VALUES ($1, $2, $3, $4, $5, $6)`
 	GetOrdersQuery    = `SELECT id, amount, table_number, status_id, order_date, menu_id, created_at, updated_at FROM orders`
 	GetOrderByIDQuery = `SELECT id, amount, table_number, status_id, order_date, menu_id, created_at, updated_at FROM orders WHERE id = $1`
 	UpdateOrderQuery  = `UPDATE orders SET amount = $1, table_number = $2, status_id = $3, order_date = $4, menu_id = $5, updated_at = NOW() WHERE id = $6`
 	DeleteOrderQuery  = `DELETE FROM orders WHERE id = $1`
 
-	CreateRoleQuery  = `INSERT INTO roles (name) VALUES ($1)`
+	CreateRoleQuery  = `INSERT INTO roles (name) VALUES ($1) RETURNING id`
 	GetRolesQuery    = `SELECT id, name, created_at, updated_at FROM roles`
-	GetRoleByIDQuery = `SELECT id, name, created_at, updated_at FROM roles WHERE id = $1`
+	GetRoleByIDQuery = `SELECT id, name, require_2fa, created_at, updated_at FROM roles WHERE id = $1`
 	UpdateRoleQuery  = `UPDATE roles SET name = $1, updated_at = NOW() WHERE id = $2`
 	DeleteRoleQuery  = `DELETE FROM roles WHERE id = $1`
 
@@ -0,0 +1,142 @@
+package db
+
+// SalesFigures are the totals of a set of order lines. Revenue is the
+// quantity times the price each line was sold at.
+type SalesFigures struct {
+	GrossSales    int     `json:"gross_sales"`
+	OrderCodes    int     `json:"order_codes"`
+	ItemsSold     int     `json:"items_sold"`
+	AverageTicket float64 `json:"average_ticket"`
+}
+
+type DailySales struct {
+	Date string `json:"date"`
+	SalesFigures
+}
+
+type CategorySales struct {
+	CategoryID   int    `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	SalesFigures
+}
+
+type PaymentStatusSales struct {
+	PaymentStatus string `json:"payment_status"`
+	SalesFigures
+}
+
+// Payment states of an order line in reports
+const (
+	PaymentPaid   = "paid"
+	PaymentUnpaid = "unpaid"
+)
+
+// LocalOrderDateSQL is orders.order_date in the outlet's time zone. The
+// column holds the database session's wall-clock time, so it is read in that
+// zone first. It needs the outlet's settings joined as s.
+const LocalOrderDateSQL = `((o.order_date AT TIME ZONE current_setting('TimeZone')) AT TIME ZONE s.timezone)`
+
+// SalesLinesQuery selects the order lines of outlet $1 dated between $2 and
+// $3, inclusive and in the outlet's time zone, for the sales report queries
+// to aggregate; $4 is the status that marks a line as paid, and cancelled
+// lines are left out. Only a loose bound is put on the raw order_date so the
+// planner can use an index, and the queries built on it filter the exact
+// local day.
+const SalesLinesQuery = `
+	WITH lines AS (
+		SELECT (` + LocalOrderDateSQL + `)::date AS day,
+		       ` + LocalOrderDateSQL + ` AS local_at,
+		       o.order_code, o.amount,
+		       o.amount * o.unit_price AS total,
+		       o.status_id = $4 AS paid,
+		       o.menu_id, m.name AS menu_name,
+		       m.category_id, c.name AS category_name
+		FROM orders o
+		JOIN settings s ON s.outlet_id = o.outlet_id
+		JOIN menus m ON m.id = o.menu_id
+		JOIN categories c ON c.id = m.category_id
+		WHERE o.outlet_id = $1
+		  AND o.cancelled_at IS NULL
+		  AND o.order_date >= $2::date - 1 AND o.order_date < $3::date + 2
+	)`
+
+// SalesFiguresSQL aggregates lines into the columns scanned by SalesFigures
+const SalesFiguresSQL = `COALESCE(SUM(total), 0), COUNT(DISTINCT order_code), COALESCE(SUM(amount), 0),
+	COALESCE(ROUND(SUM(total)::numeric / NULLIF(COUNT(DISTINCT order_code), 0), 2), 0)`
+
+// PeriodPerformance is how a menu or category sold over a period. Order
+// frequency is the number of order codes it appeared in.
+type PeriodPerformance struct {
+	Quantity       int `json:"quantity"`
+	Revenue        int `json:"revenue"`
+	OrderFrequency int `json:"order_frequency"`
+}
+
+// PerformanceChange is the change against the previous period in percent,
+// nil when the previous period had nothing to compare with
+type PerformanceChange struct {
+	QuantityPct       *float64 `json:"quantity_pct"`
+	RevenuePct        *float64 `json:"revenue_pct"`
+	OrderFrequencyPct *float64 `json:"order_frequency_pct"`
+}
+
+type MenuPerformance struct {
+	Rank         int    `json:"rank"`
+	MenuID       int    `json:"menu_id"`
+	MenuName     string `json:"menu_name"`
+	CategoryID   int    `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	PeriodPerformance
+	RevenueShare float64           `json:"revenue_share"`
+	Previous     PeriodPerformance `json:"previous"`
+	Change       PerformanceChange `json:"change"`
+}
+
+type CategoryPerformance struct {
+	Rank         int    `json:"rank"`
+	CategoryID   int    `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	PeriodPerformance
+	RevenueShare float64           `json:"revenue_share"`
+	Previous     PeriodPerformance `json:"previous"`
+	Change       PerformanceChange `json:"change"`
+}
+
+// SalesHeatmap spreads sales over the week, indexed [weekday][hour] with
+// weekday 0 = Sunday, in the outlet's time zone
+type SalesHeatmap struct {
+	Quantity   [7][24]int `json:"quantity"`
+	Revenue    [7][24]int `json:"revenue"`
+	OrderCodes [7][24]int `json:"order_codes"`
+}
+
+// StatusTiming is how long order lines took, in minutes from being placed,
+// to first reach a status
+type StatusTiming struct {
+	Status     string  `json:"status"`
+	Count      int     `json:"count"`
+	AvgMinutes float64 `json:"avg_minutes"`
+	P50Minutes float64 `json:"p50_minutes"`
+	P90Minutes float64 `json:"p90_minutes"`
+	P95Minutes float64 `json:"p95_minutes"`
+	MaxMinutes float64 `json:"max_minutes"`
+}
+
+type MenuKitchenTiming struct {
+	MenuID   int            `json:"menu_id"`
+	MenuName string         `json:"menu_name"`
+	Timings  []StatusTiming `json:"timings"`
+}
+
+// StaffKitchenTiming attributes a status to the staff member who set it
+type StaffKitchenTiming struct {
+	StaffID   int            `json:"staff_id"`
+	StaffName string         `json:"staff_name"`
+	Timings   []StatusTiming `json:"timings"`
+}
+
+// HourKitchenTiming groups lines by the hour they were placed in
+type HourKitchenTiming struct {
+	Hour    int            `json:"hour"`
+	Timings []StatusTiming `json:"timings"`
+}
@@ -1,8 +1,13 @@
 package db
 
 type Settings struct {
-	TotalTable int     `json:"total_table"`
-	Latitude   float64 `json:"latitude"`
-	Longitude  float64 `json:"longitude"`
-	Radius     float64 `json:"radius"`
+	OutletID           int     `json:"outlet_id"`
+	TotalTable         int     `json:"total_table"`
+	Latitude           float64 `json:"latitude"`
+	Longitude          float64 `json:"longitude"`
+	Radius             float64 `json:"radius"`
+	SessionIdleMinutes int     `json:"session_idle_minutes"`
+	// VoidApprovalThreshold is the value above which a void or refund needs
+	// a manager's approval
+	VoidApprovalThreshold int `json:"void_approval_threshold"`
 }
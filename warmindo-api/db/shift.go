@@ -0,0 +1,135 @@
+package db
+
+// Ways an order can be paid
+const (
+	PaymentCash     = "cash"
+	PaymentQRIS     = "qris"
+	PaymentTransfer = "transfer"
+	PaymentCard     = "card"
+)
+
+// PaymentMethods lists the accepted payment methods. Only cash goes into the
+// drawer.
+var PaymentMethods = []string{PaymentCash, PaymentQRIS, PaymentTransfer, PaymentCard}
+
+// Kinds of cash put into or taken out of the drawer outside of sales
+const (
+	CashPayIn  = "pay_in"
+	CashPayOut = "pay_out"
+)
+
+// Outcomes of counting the drawer at the end of a shift
+const (
+	DrawerEven  = "even"
+	DrawerOver  = "over"
+	DrawerShort = "short"
+)
+
+// Shift is a cashier's stint at the drawer, from counting the starting cash
+// to counting what is left. The counted, expected and difference amounts are
+// set when it is closed.
+type Shift struct {
+	ID           int    `json:"id"`
+	OutletID     int    `json:"outlet_id"`
+	StaffID      int    `json:"staff_id"`
+	StaffName    string `json:"staff_name"`
+	TerminalID   int    `json:"terminal_id,omitempty"`
+	TerminalName string `json:"terminal_name,omitempty"`
+	OpeningCash  int    `json:"opening_cash"`
+	CountedCash  *int   `json:"counted_cash"`
+	ExpectedCash *int   `json:"expected_cash"`
+	Difference   *int   `json:"difference"`
+	OpenNote     string `json:"open_note"`
+	CloseNote    string `json:"close_note"`
+	OpenedAt     string `json:"opened_at"`
+	ClosedAt     string `json:"closed_at,omitempty"`
+}
+
+// CashMovement is cash paid into or out of the drawer for something other
+// than a sale, like topping up change or buying supplies
+type CashMovement struct {
+	ID        int    `json:"id"`
+	ShiftID   int    `json:"shift_id"`
+	Type      string `json:"type"`
+	Amount    int    `json:"amount"`
+	Reason    string `json:"reason"`
+	StaffID   int    `json:"staff_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Payment settles the unpaid lines of an order code. Tendered and change are
+// only recorded for cash.
+type Payment struct {
+	ID        int    `json:"id"`
+	OutletID  int    `json:"outlet_id"`
+	OrderCode string `json:"order_code"`
+	Method    string `json:"method"`
+	Amount    int    `json:"amount"`
+	Tendered  int    `json:"tendered"`
+	Change    int    `json:"change"`
+	ShiftID   int    `json:"shift_id,omitempty"`
+	StaffID   int    `json:"staff_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// MethodTotal sums payments of one method, and the refunds given on them
+type MethodTotal struct {
+	Method   string `json:"method"`
+	Count    int    `json:"count"`
+	Amount   int    `json:"amount"`
+	Refunded int    `json:"refunded"`
+}
+
+// ShiftSummary is the drawer reconciliation of a shift. Expected cash is
+// the opening cash plus cash sales and pay-ins, minus cash refunds and
+// pay-outs.
+type ShiftSummary struct {
+	OpeningCash  int           `json:"opening_cash"`
+	CashSales    int           `json:"cash_sales"`
+	CashRefunds  int           `json:"cash_refunds"`
+	PayIns       int           `json:"pay_ins"`
+	PayOuts      int           `json:"pay_outs"`
+	ExpectedCash int           `json:"expected_cash"`
+	CountedCash  *int          `json:"counted_cash"`
+	Difference   *int          `json:"difference"`
+	Result       string        `json:"result,omitempty"`
+	Payments     []MethodTotal `json:"payments"`
+}
+
+// DailyPayments sums an outlet's payments and refunds per day and method
+type DailyPayments struct {
+	Date     string        `json:"date"`
+	Total    int           `json:"total"`
+	Refunded int           `json:"refunded"`
+	Methods  []MethodTotal `json:"methods"`
+}
+
+const (
+	// ShiftColumnsQuery selects a shift with its staff and terminal names;
+	// callers add the WHERE clause
+	ShiftColumnsQuery = `
+	SELECT sh.id, sh.outlet_id, sh.staff_id, st.name, COALESCE(sh.terminal_id, 0), COALESCE(t.name, ''),
+	       sh.opening_cash, sh.counted_cash, sh.expected_cash, sh.difference,
+	       sh.open_note, sh.close_note, sh.opened_at::text, COALESCE(sh.closed_at::text, '')
+	FROM shifts sh
+	JOIN staffs st ON st.id = sh.staff_id
+	LEFT JOIN terminals t ON t.id = sh.terminal_id`
+
+	CreatePaymentQuery = `INSERT INTO payments (outlet_id, order_code, method, amount, tendered, change, shift_id, staff_id)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8)
+	RETURNING id, created_at::text`
+)
+
+// Scanner is a *sql.Row or *sql.Rows
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanShift reads a row selected by ShiftColumnsQuery
+func ScanShift(row Scanner) (Shift, error) {
+	var shift Shift
+	err := row.Scan(&shift.ID, &shift.OutletID, &shift.StaffID, &shift.StaffName, &shift.TerminalID, &shift.TerminalName,
+		&shift.OpeningCash, &shift.CountedCash, &shift.ExpectedCash, &shift.Difference,
+		&shift.OpenNote, &shift.CloseNote, &shift.OpenedAt, &shift.ClosedAt)
+	return shift, err
+}
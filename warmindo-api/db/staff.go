@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -9,6 +10,23 @@ import (
 type Login struct {
 	Password string `json:"password,omitempty"`
 	Email    string `json:"email,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Identifier accepts either an email or a username
+	Identifier string `json:"identifier,omitempty"`
+	// OutletID picks the outlet to work in; 0 means the first assigned one
+	OutletID int `json:"outlet_id,omitempty"`
+}
+
+// LoginIdentifier returns whichever of identifier, email or username was sent
+func (login *Login) LoginIdentifier() string {
+	switch {
+	case login.Identifier != "":
+		return strings.TrimSpace(login.Identifier)
+	case login.Email != "":
+		return strings.TrimSpace(login.Email)
+	default:
+		return strings.TrimSpace(login.Username)
+	}
 }
 
 type User struct {
@@ -24,7 +42,10 @@ type User struct {
 }
 
 const (
-	GetUserByEmailQuery = `SELECT id, email, name, username, role_id, phone, password, created_at, updated_at FROM staffs WHERE email = $1;`
+	GetUserByEmailQuery  = `SELECT id, email, name, username, role_id, phone, password, created_at, updated_at FROM staffs WHERE email = $1 AND deleted_at IS NULL;`
+	GetUserByIDFullQuery = `SELECT id, email, name, username, role_id, phone, password, created_at, updated_at FROM staffs WHERE id = $1 AND deleted_at IS NULL;`
+	GetUserByLoginQuery  = `SELECT id, email, name, username, role_id, phone, password, created_at, updated_at FROM staffs WHERE (email = $1 OR username = $1) AND deleted_at IS NULL ORDER BY (email = $1) DESC LIMIT 1;`
+	GetUserPINQuery      = `SELECT id, email, name, username, role_id, phone, COALESCE(pin_hash, ''), created_at, updated_at FROM staffs WHERE username = $1 AND deleted_at IS NULL;`
 )
 
 func GetUserByEmail(dbConn *sql.DB, email string) (*User, error) {
@@ -38,6 +59,43 @@ func GetUserByEmail(dbConn *sql.DB, email string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByLogin finds a staff member by email or username, preferring an email match
+func GetUserByLogin(dbConn *sql.DB, identifier string) (*User, error) {
+	var user User
+	err := dbConn.QueryRow(GetUserByLoginQuery, identifier).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID, &user.Phone, &user.Password, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserPIN finds a staff member by username. The PIN hash is returned in
+// the Password field, empty when no PIN is set.
+func GetUserPIN(dbConn *sql.DB, username string) (*User, error) {
+	var user User
+	err := dbConn.QueryRow(GetUserPINQuery, username).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID, &user.Phone, &user.Password, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByID loads a staff member including the password hash
+func GetUserByID(dbConn *sql.DB, id int) (*User, error) {
+	var user User
+	err := dbConn.QueryRow(GetUserByIDFullQuery, id).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Username, &user.RoleID, &user.Phone, &user.Password, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (user *User) HashPassword() error {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
 	if err != nil {
@@ -1,8 +1,99 @@
 package db
 
+// Order statuses the API acts on
+const (
+	// StatusPending is a freshly placed order line
+	StatusPending = 1
+	// StatusCooking is a line the kitchen is working on
+	StatusCooking = 2
+	// StatusPaid settles the order and closes the customer session
+	StatusPaid = 3
+	// StatusServed is a line brought to the table
+	StatusServed = 4
+	// StatusCancelled is a voided line, kept for reporting but left out of
+	// revenue and bills. Cancelled lines also have orders.cancelled_at set,
+	// which is what queries filter on.
+	StatusCancelled = 5
+)
+
+// Status codes, stable where names may be renamed or translated
+const (
+	StatusCodePending   = "pending"
+	StatusCodeCooking   = "cooking"
+	StatusCodeServed    = "served"
+	StatusCodePaid      = "paid"
+	StatusCodeCancelled = "cancelled"
+)
+
+// KitchenStatusCodes are the statuses whose time since the order was placed
+// the kitchen report measures, in the order they are normally reached
+var KitchenStatusCodes = []string{StatusCodeCooking, StatusCodeServed, StatusCodePaid}
+
 type Status struct {
 	ID        int    `json:"id"`
+	Code      string `json:"code"`
 	Name      string `json:"name"`
 	CreatedAt string `json:"created_at,omitempty"`
 	UpdatedAt string `json:"updated_at,omitempty"`
 }
+
+// OrderStatusEvent is one status change of an order line
+type OrderStatusEvent struct {
+	ID         int    `json:"id"`
+	StatusID   int    `json:"status_id"`
+	StatusCode string `json:"status_code"`
+	StatusName string `json:"status_name"`
+	StaffID    int    `json:"staff_id,omitempty"`
+	StaffName  string `json:"staff_name,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+const (
+	// The status updates record an event for every line whose status really
+	// changed. $1 is the new status, $2 the line id or order code, $3 the
+	// outlet and $4 the staff member making the change. Cancelled lines
+	// stay cancelled and paid lines stay paid, so a settled line can't be
+	// put back on the bill.
+	UpdateOrderStatusByIDQuery = `
+	WITH changed AS (
+		UPDATE orders SET status_id = $1, updated_at = NOW()
+		WHERE id = $2 AND outlet_id = $3 AND status_id <> $1 AND cancelled_at IS NULL
+			AND payment_id IS NULL AND status_id <> 3
+		RETURNING id, outlet_id, status_id
+	)` + recordStatusChanges
+	UpdateOrderStatusByCodeQuery = `
+	WITH changed AS (
+		UPDATE orders SET status_id = $1, updated_at = NOW()
+		WHERE order_code = $2 AND outlet_id = $3 AND status_id <> $1 AND cancelled_at IS NULL
+			AND payment_id IS NULL AND status_id <> 3
+		RETURNING id, outlet_id, status_id
+	)` + recordStatusChanges
+	// The paid checks tell whether line $1, or every open line of order
+	// code $1, of outlet $2 is already settled. The code check is NULL when
+	// the code has no open lines.
+	OrderLinePaidQuery = `
+	SELECT payment_id IS NOT NULL OR status_id = 3 FROM orders
+	WHERE id = $1 AND outlet_id = $2 AND cancelled_at IS NULL`
+	OrderCodePaidQuery = `
+	SELECT bool_and(payment_id IS NOT NULL OR status_id = 3) FROM orders
+	WHERE order_code = $1 AND outlet_id = $2 AND cancelled_at IS NULL`
+	// CancelOrderQuery cancels line $2 of outlet $3 for staff member $4; $1
+	// is StatusCancelled
+	CancelOrderQuery = `
+	WITH changed AS (
+		UPDATE orders SET status_id = $1, cancelled_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND outlet_id = $3 AND cancelled_at IS NULL
+		RETURNING id, outlet_id, status_id
+	)` + recordStatusChanges
+	recordStatusChanges = `
+	INSERT INTO order_status_events (order_id, outlet_id, status_id, staff_id)
+	SELECT id, outlet_id, status_id, NULLIF($4, 0) FROM changed`
+
+	GetOrderStatusEventsQuery = `
+	SELECT e.id, e.status_id, COALESCE(st.code, ''), st.name, COALESCE(e.staff_id, 0), COALESCE(sf.name, ''), e.created_at::text
+	FROM order_status_events e
+	JOIN statuses st ON st.id = e.status_id
+	LEFT JOIN staffs sf ON sf.id = e.staff_id
+	WHERE e.order_id = $1
+	ORDER BY e.created_at, e.id`
+)
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Why a store is closed
+const (
+	StoreClosedManual  = "manual"
+	StoreClosedHoliday = "holiday"
+	StoreClosedHours   = "hours"
+)
+
+// DefaultStoreTimezone is the zone opening hours are read in when an outlet's
+// settings don't name a valid one
+const DefaultStoreTimezone = "Asia/Jakarta"
+
+// OpeningHours is one opening period on a weekday (0 = Sunday). A period whose
+// close_time isn't after its open_time runs past midnight into the next day.
+type OpeningHours struct {
+	Weekday   int    `json:"weekday"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+}
+
+// StoreClosure closes an outlet for whole days, e.g. on a public holiday
+type StoreClosure struct {
+	ID        int    `json:"id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// StoreSchedule is everything that decides whether an outlet takes orders
+type StoreSchedule struct {
+	Timezone      string         `json:"timezone"`
+	ManualClosed  bool           `json:"manual_closed"`
+	ClosedMessage string         `json:"closed_message"`
+	Hours         []OpeningHours `json:"hours"`
+	Closures      []StoreClosure `json:"closures"`
+}
+
+// StoreStatus is whether an outlet takes orders at a given moment. OpensAt is
+// nil while the store is open or closed by hand; ClosesAt is nil while it is
+// closed or open around the clock.
+type StoreStatus struct {
+	Open     bool       `json:"open"`
+	Reason   string     `json:"reason,omitempty"`
+	Message  string     `json:"message"`
+	OpensAt  *time.Time `json:"opens_at"`
+	ClosesAt *time.Time `json:"closes_at"`
+	Now      time.Time  `json:"now"`
+}
+
+const (
+	GetStoreModeQuery     = `SELECT timezone, manual_closed, closed_message FROM settings WHERE outlet_id = $1`
+	GetOpeningHoursQuery  = `SELECT weekday, to_char(open_time, 'HH24:MI'), to_char(close_time, 'HH24:MI') FROM opening_hours WHERE outlet_id = $1 ORDER BY weekday, open_time`
+	GetStoreClosuresQuery = `SELECT id, start_date::text, end_date::text, reason, created_at::text FROM store_closures WHERE outlet_id = $1 AND end_date >= CURRENT_DATE - 1 ORDER BY start_date`
+)
+
+// GetStoreSchedule loads an outlet's opening hours, the closures that haven't
+// ended yet and its manual switch
+func GetStoreSchedule(dbConn *sql.DB, outletID int) (*StoreSchedule, error) {
+	schedule := StoreSchedule{Hours: []OpeningHours{}, Closures: []StoreClosure{}}
+	err := dbConn.QueryRow(GetStoreModeQuery, outletID).Scan(&schedule.Timezone, &schedule.ManualClosed, &schedule.ClosedMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dbConn.Query(GetOpeningHoursQuery, outletID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h OpeningHours
+		if err := rows.Scan(&h.Weekday, &h.OpenTime, &h.CloseTime); err != nil {
+			return nil, err
+		}
+		schedule.Hours = append(schedule.Hours, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	closures, err := dbConn.Query(GetStoreClosuresQuery, outletID)
+	if err != nil {
+		return nil, err
+	}
+	defer closures.Close()
+	for closures.Next() {
+		var cl StoreClosure
+		if err := closures.Scan(&cl.ID, &cl.StartDate, &cl.EndDate, &cl.Reason, &cl.CreatedAt); err != nil {
+			return nil, err
+		}
+		schedule.Closures = append(schedule.Closures, cl)
+	}
+	return &schedule, closures.Err()
+}
@@ -0,0 +1,53 @@
+package db
+
+import "database/sql"
+
+// TableAreas are the zones a table can be placed in
+var TableAreas = []string{"indoor", "outdoor", "lesehan"}
+
+type Table struct {
+	ID        int    `json:"id"`
+	OutletID  int    `json:"outlet_id"`
+	Number    int    `json:"number"`
+	Label     string `json:"label"`
+	Area      string `json:"area"`
+	Capacity  int    `json:"capacity"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+const (
+	GetTableByNumberQuery = `SELECT id, outlet_id, number, label, area, capacity, active, created_at, updated_at FROM tables WHERE outlet_id = $1 AND number = $2`
+	GetTableByIDQuery     = `SELECT id, outlet_id, number, label, area, capacity, active, created_at, updated_at FROM tables WHERE id = $1`
+)
+
+func scanTable(row *sql.Row) (*Table, error) {
+	var table Table
+	err := row.Scan(
+		&table.ID, &table.OutletID, &table.Number, &table.Label, &table.Area, &table.Capacity, &table.Active, &table.CreatedAt, &table.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// GetTableByNumber finds an outlet's table by the number printed on it
+func GetTableByNumber(dbConn *sql.DB, outletID, number int) (*Table, error) {
+	return scanTable(dbConn.QueryRow(GetTableByNumberQuery, outletID, number))
+}
+
+// GetTableByID finds a table by its id, which is unique across outlets
+func GetTableByID(dbConn *sql.DB, id int) (*Table, error) {
+	return scanTable(dbConn.QueryRow(GetTableByIDQuery, id))
+}
+
+func IsTableArea(area string) bool {
+	for _, a := range TableAreas {
+		if a == area {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package db
+
+// Kinds of table session events
+const (
+	TableEventTransfer = "transfer"
+	TableEventMerge    = "merge"
+)
+
+// TableSessionEvent records a session moving to another table or being
+// merged into another session
+type TableSessionEvent struct {
+	ID              int    `json:"id"`
+	Event           string `json:"event"`
+	OrderCode       string `json:"order_code"`
+	FromTable       int    `json:"from_table"`
+	ToTable         int    `json:"to_table"`
+	TargetOrderCode string `json:"target_order_code,omitempty"`
+	StaffID         int    `json:"staff_id,omitempty"`
+	StaffName       string `json:"staff_name,omitempty"`
+	Note            string `json:"note"`
+	CreatedAt       string `json:"created_at"`
+}
+
+const (
+	CreateTableSessionEventQuery = `INSERT INTO table_session_events (event, order_code, from_table, to_table, target_order_code, staff_id, note, outlet_id)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), $7, $8)`
+)
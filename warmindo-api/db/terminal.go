@@ -0,0 +1,11 @@
+package db
+
+type Terminal struct {
+	ID         int    `json:"id"`
+	OutletID   int    `json:"outlet_id"`
+	Name       string `json:"name"`
+	Active     bool   `json:"active"`
+	LastSeenAt string `json:"last_seen_at,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	UpdatedAt  string `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"os"
+	"strconv"
+)
+
+// Kinds of records that are moved to the trash instead of being deleted
+const (
+	TrashStaff      = "staff"
+	TrashCategories = "categories"
+	TrashMenus      = "menus"
+	TrashOrders     = "orders"
+	TrashSessions   = "sessions"
+)
+
+// DefaultTrashRetentionDays is how long trashed records are kept when
+// TRASH_RETENTION_DAYS isn't set
+const DefaultTrashRetentionDays = 30
+
+// TrashTable describes where a kind of trashed record lives
+type TrashTable struct {
+	Table string
+	// Label is the SQL expression naming a row, over the table aliased x
+	Label string
+	// OutletScope limits the rows to outlet $1 for records that belong to an
+	// outlet; it is empty for shared ones like menus and categories
+	OutletScope string
+	// Kept records stay in the trash until restored and are never purged.
+	// Trashed order lines are always cancelled, and their void history has
+	// to outlive them.
+	Kept bool
+}
+
+// TrashTables lists the soft-deleted tables by trash type, in the order the
+// purge job empties them so that rows go before the rows they point to
+var TrashTables = []struct {
+	Type string
+	TrashTable
+}{
+	{TrashOrders, TrashTable{
+		Table:       "orders",
+		Label:       "x.order_code || ' - ' || (SELECT name FROM menus WHERE id = x.menu_id)",
+		OutletScope: "x.outlet_id = $1",
+		Kept:        true,
+	}},
+	{TrashSessions, TrashTable{
+		Table:       "customers",
+		Label:       "x.order_code || ' - meja ' || x.table_number",
+		OutletScope: "x.outlet_id = $1",
+	}},
+	{TrashMenus, TrashTable{Table: "menus", Label: "x.name"}},
+	{TrashCategories, TrashTable{Table: "categories", Label: "x.name"}},
+	{TrashStaff, TrashTable{
+		Table:       "staffs",
+		Label:       "x.name || ' (' || x.username || ')'",
+		OutletScope: "EXISTS (SELECT 1 FROM staff_outlets so WHERE so.staff_id = x.id AND so.outlet_id = $1)",
+	}},
+}
+
+// GetTrashTable looks up a trash type
+func GetTrashTable(trashType string) (TrashTable, bool) {
+	for _, t := range TrashTables {
+		if t.Type == trashType {
+			return t.TrashTable, true
+		}
+	}
+	return TrashTable{}, false
+}
+
+// TrashItem is a soft-deleted record as listed in the trash
+type TrashItem struct {
+	ID            int    `json:"id"`
+	Label         string `json:"label"`
+	DeletedAt     string `json:"deleted_at"`
+	DeletedBy     int    `json:"deleted_by,omitempty"`
+	DeletedByName string `json:"deleted_by_name,omitempty"`
+	// PurgeAt is when the purge job removes the record for good, null for
+	// records that are kept
+	PurgeAt *string `json:"purge_at"`
+}
+
+// TrashRetentionDays reads TRASH_RETENTION_DAYS, falling back to
+// DefaultTrashRetentionDays when it is unset or not a positive number
+func TrashRetentionDays() int {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		return DefaultTrashRetentionDays
+	}
+	return days
+}
@@ -0,0 +1,55 @@
+package db
+
+// OrderVoid records quantity taken off an order line. Cancelling a line
+// voids all of its remaining quantity; the line keeps that quantity and
+// only its status changes.
+type OrderVoid struct {
+	ID           int    `json:"id"`
+	OrderID      int    `json:"order_id"`
+	OrderCode    string `json:"order_code"`
+	MenuID       int    `json:"menu_id"`
+	MenuName     string `json:"menu_name"`
+	Quantity     int    `json:"quantity"`
+	UnitPrice    int    `json:"unit_price"`
+	Total        int    `json:"total"`
+	Cancelled    bool   `json:"cancelled"`
+	Reason       string `json:"reason"`
+	StaffID      int    `json:"staff_id"`
+	StaffName    string `json:"staff_name"`
+	ApprovedBy   int    `json:"approved_by,omitempty"`
+	ApproverName string `json:"approver_name,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// Refund gives back part or all of a payment, by the payment's method.
+// Cash refunds come out of the drawer of the refunding staff member's shift.
+type Refund struct {
+	ID         int    `json:"id"`
+	PaymentID  int    `json:"payment_id"`
+	OutletID   int    `json:"outlet_id"`
+	OrderCode  string `json:"order_code"`
+	Method     string `json:"method"`
+	Amount     int    `json:"amount"`
+	Reason     string `json:"reason"`
+	ShiftID    int    `json:"shift_id,omitempty"`
+	StaffID    int    `json:"staff_id"`
+	ApprovedBy int    `json:"approved_by,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// VoidTotals sums voids over a report period
+type VoidTotals struct {
+	Count    int `json:"count"`
+	Quantity int `json:"quantity"`
+	Total    int `json:"total"`
+}
+
+const (
+	CreateOrderVoidQuery = `INSERT INTO order_voids (order_id, outlet_id, quantity, unit_price, cancelled, reason, staff_id, approved_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0))
+	RETURNING id, created_at::text`
+
+	CreateRefundQuery = `INSERT INTO refunds (payment_id, outlet_id, amount, reason, shift_id, staff_id, approved_by)
+	VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, NULLIF($7, 0))
+	RETURNING id, created_at::text`
+)
@@ -0,0 +1,49 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	w        io.Writer
+	csv      *csv.Writer
+	sections int
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: w, csv: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Section(title string, columns []string) error {
+	if w.sections == 0 {
+		// The byte order mark makes Excel read the file as UTF-8
+		if _, err := io.WriteString(w.w, "\ufeff"); err != nil {
+			return err
+		}
+	} else if err := w.csv.Write(nil); err != nil {
+		return err
+	}
+	w.sections++
+
+	if err := w.csv.Write([]string{title}); err != nil {
+		return err
+	}
+	return w.csv.Write(columns)
+}
+
+func (w *csvWriter) Row(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = text(v)
+	}
+	if err := w.csv.Write(record); err != nil {
+		return err
+	}
+	return w.csv.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
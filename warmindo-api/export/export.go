@@ -0,0 +1,108 @@
+// Package export writes tabular reports as CSV, XLSX or PDF files. Rows are
+// written as they come so large exports don't have to be held in memory;
+// only PDF, whose layout needs the whole document, is buffered and capped.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Export formats
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+	PDF  = "pdf"
+)
+
+// Formats lists the export formats accepted in ?format=
+var Formats = []string{CSV, XLSX, PDF}
+
+// Writer writes a report made of sections, each a titled table. CSV puts the
+// sections one below the other, XLSX gives each a sheet and PDF a heading.
+type Writer interface {
+	// Section starts a table with the given column headers
+	Section(title string, columns []string) error
+	// Row adds a row to the current section. Values are strings, integers
+	// or floats, or pointers to them where nil is an empty cell; anything
+	// else is printed with fmt.
+	Row(values ...interface{}) error
+	// Close finishes the file. Nothing is complete before it is called.
+	Close() error
+}
+
+// NewWriter returns a writer for format writing to w. title heads the
+// document where the format has room for one.
+func NewWriter(format string, w io.Writer, title string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case XLSX:
+		return newXLSXWriter(w), nil
+	case PDF:
+		return newPDFWriter(w, title), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// IsFormat reports whether format is one of Formats
+func IsFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType is the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case PDF:
+		return "application/pdf"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Filename is name with the extension of format, stripped of characters
+// that don't belong in a Content-Disposition header
+func Filename(name, format string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r == '/' || r < ' ' {
+			return '-'
+		}
+		return r
+	}, name)
+	return name + "." + format
+}
+
+// text renders a cell value for the text based formats
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return text(*v)
+	case *int:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,324 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// report is a small report with a missing value, characters every format
+// has to escape and two sections with the same title
+func report(w Writer) error {
+	var missing *float64
+	if err := w.Section("Harian", []string{"Tanggal", "Penjualan", "Rata-rata"}); err != nil {
+		return err
+	}
+	if err := w.Row("2026-10-18", 150000, 12.5); err != nil {
+		return err
+	}
+	if err := w.Row("2026-10-19", 0, missing); err != nil {
+		return err
+	}
+	if err := w.Section("Menu", []string{"Menu"}); err != nil {
+		return err
+	}
+	if err := w.Row(`Es teh "manis" & <dingin>`); err != nil {
+		return err
+	}
+	if err := w.Section("menu", []string{"Menu"}); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := report(newCSVWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	// One byte order mark for the file, a blank line between sections and
+	// nothing for the missing value
+	want := "\ufeffHarian\nTanggal,Penjualan,Rata-rata\n2026-10-18,150000,12.5\n2026-10-19,0,\n" +
+		"\nMenu\nMenu\n\"Es teh \"\"manis\"\" & <dingin>\"\n" +
+		"\nmenu\nMenu\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+// xlsxCell is a worksheet cell as Excel reads it back
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+// readXLSX unzips a workbook and returns its sheet names and each sheet's
+// cells by reference
+func readXLSX(t *testing.T, data []byte) ([]string, []map[string]xlsxCell) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	read := func(name string, v interface{}) {
+		f, err := zr.Open(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer f.Close()
+		body, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := xml.Unmarshal(body, v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	read("xl/workbook.xml", &workbook)
+	read("[Content_Types].xml", new(interface{}))
+	read("xl/_rels/workbook.xml.rels", new(interface{}))
+	read("xl/styles.xml", new(interface{}))
+
+	names := []string{}
+	sheets := []map[string]xlsxCell{}
+	for i, s := range workbook.Sheets {
+		var sheet struct {
+			Cells []xlsxCell `xml:"sheetData>row>c"`
+		}
+		read(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), &sheet)
+		cells := map[string]xlsxCell{}
+		for _, c := range sheet.Cells {
+			cells[c.Ref] = c
+		}
+		names = append(names, s.Name)
+		sheets = append(sheets, cells)
+	}
+	return names, sheets
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := report(newXLSXWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	names, sheets := readXLSX(t, buf.Bytes())
+
+	// Sheet names are unique regardless of case
+	if got := strings.Join(names, ","); got != "Harian,Menu,menu 3" {
+		t.Fatalf("sheets = %s", got)
+	}
+
+	daily := sheets[0]
+	if c := daily["A1"]; c.Inline != "Tanggal" || c.Style != "1" {
+		t.Errorf("A1 = %+v, want the bold Tanggal header", c)
+	}
+	// Numbers are numeric cells so they can be summed in Excel
+	if c := daily["B2"]; c.Type != "" || c.Value != "150000" {
+		t.Errorf("B2 = %+v, want the number 150000", c)
+	}
+	if c := daily["C2"]; c.Type != "" || c.Value != "12.5" {
+		t.Errorf("C2 = %+v, want the number 12.5", c)
+	}
+	if c := daily["A3"]; c.Type != "inlineStr" || c.Inline != "2026-10-19" {
+		t.Errorf("A3 = %+v, want the text 2026-10-19", c)
+	}
+	if c, ok := daily["C3"]; ok {
+		t.Errorf("C3 = %+v, want no cell for the missing value", c)
+	}
+	if c := sheets[1]["A2"]; c.Inline != `Es teh "manis" & <dingin>` {
+		t.Errorf("A2 = %q, want the text unescaped as written", c.Inline)
+	}
+	if len(sheets[2]) != 1 {
+		t.Errorf("empty section has cells %v, want only its header", sheets[2])
+	}
+}
+
+func TestXLSXColumnsPastZ(t *testing.T) {
+	columns := make([]string, 54)
+	for i := range columns {
+		columns[i] = fmt.Sprint(i + 1)
+	}
+	var buf bytes.Buffer
+	w := newXLSXWriter(&buf)
+	if err := w.Section("Lebar", columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, sheets := readXLSX(t, buf.Bytes())
+	for ref, want := range map[string]string{"Z1": "26", "AA1": "27", "AZ1": "52", "BA1": "53", "BB1": "54"} {
+		if got := sheets[0][ref].Inline; got != want {
+			t.Errorf("%s = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestXLSXSheetNames(t *testing.T) {
+	// Excel refuses workbooks whose sheet names are longer than 31
+	// characters, repeat one or contain any of []:*?/\
+	long := strings.Repeat("Penjualan ", 4)
+	var buf bytes.Buffer
+	w := newXLSXWriter(&buf)
+	for _, title := range []string{"Harian 01/10: [kasir]", long, long, " "} {
+		if err := w.Section(title, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := readXLSX(t, buf.Bytes())
+	want := []string{"Harian 01 10   kasir ", long[:31], long[:29] + " 3", "Sheet4"}
+	if strings.Join(names, "|") != strings.Join(want, "|") {
+		t.Errorf("sheets = %q, want %q", names, want)
+	}
+}
+
+// pdfContent writes with a PDF writer left uncompressed so the text drawn
+// on its pages can be searched
+func pdfContent(t *testing.T, write func(Writer) error) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newPDFWriter(&buf, "Laporan penjualan")
+	w.pdf.SetCompression(false)
+	if err := write(w); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF-") || !strings.HasSuffix(strings.TrimSpace(out), "%%EOF") {
+		t.Fatalf("output is not a complete PDF (%d bytes)", len(out))
+	}
+	return out
+}
+
+// shown is how fpdf draws s on a page
+func shown(s string) string {
+	return "(" + s + ")Tj"
+}
+
+func TestPDF(t *testing.T) {
+	out := pdfContent(t, report)
+	for _, s := range []string{"Laporan penjualan", "Harian", "Tanggal", "150000", "12.5", "Menu", `Es teh "manis" & <dingin>`} {
+		if !strings.Contains(out, shown(s)) {
+			t.Errorf("PDF doesn't show %q", s)
+		}
+	}
+}
+
+func TestPDFRepeatsHeaderOnEveryPage(t *testing.T) {
+	out := pdfContent(t, func(w Writer) error {
+		if err := w.Section("Pesanan", []string{"Kode", "Menu"}); err != nil {
+			return err
+		}
+		for i := 1; i <= 100; i++ {
+			if err := w.Row(fmt.Sprintf("W-%03d", i), "Indomie goreng"); err != nil {
+				return err
+			}
+		}
+		return w.Close()
+	})
+
+	pages := strings.Count(out, "/Type /Page\n")
+	if pages < 2 {
+		t.Fatalf("100 rows fit on %d page", pages)
+	}
+	if headers := strings.Count(out, shown("Kode")); headers != pages {
+		t.Errorf("header shown %d times on %d pages", headers, pages)
+	}
+	if !strings.Contains(out, shown(fmt.Sprintf("Halaman %d", pages))) {
+		t.Errorf("last page isn't numbered %d", pages)
+	}
+	if !strings.Contains(out, shown("W-100")) {
+		t.Error("last row is missing")
+	}
+}
+
+func TestPDFCapsRows(t *testing.T) {
+	out := pdfContent(t, func(w Writer) error {
+		if err := w.Section("Pesanan", []string{"No"}); err != nil {
+			return err
+		}
+		for i := 1; i <= MaxPDFRows+1; i++ {
+			if err := w.Row(fmt.Sprintf("baris %d", i)); err != nil {
+				return err
+			}
+		}
+		// Nothing goes in once capped, not even a new section
+		if err := w.Section("Lainnya", []string{"No"}); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+
+	if !strings.Contains(out, shown(fmt.Sprintf("baris %d", MaxPDFRows))) {
+		t.Errorf("row %d is missing", MaxPDFRows)
+	}
+	if strings.Contains(out, shown(fmt.Sprintf("baris %d", MaxPDFRows+1))) {
+		t.Errorf("row %d is past the cap", MaxPDFRows+1)
+	}
+	if !strings.Contains(out, shown(fmt.Sprintf("Dipotong setelah %d baris, gunakan CSV atau XLSX untuk data lengkap", MaxPDFRows))) {
+		t.Error("no note that the export was cut off")
+	}
+	if strings.Contains(out, shown("Lainnya")) {
+		t.Error("section added after the cap")
+	}
+}
+
+func TestPDFShortensLongCells(t *testing.T) {
+	long := strings.Repeat("Nasi goreng spesial ", 10)
+	out := pdfContent(t, func(w Writer) error {
+		if err := w.Section("Menu", []string{"Menu", "Harga", "Kategori"}); err != nil {
+			return err
+		}
+		if err := w.Row(long, 25000, "Makanan"); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+
+	if strings.Contains(out, long) {
+		t.Error("long cell drawn in full over its neighbours")
+	}
+	if !strings.Contains(out, "...)Tj") {
+		t.Error("long cell not shortened with an ellipsis")
+	}
+	if !strings.Contains(out, shown("Makanan")) {
+		t.Error("cell after the long one is missing")
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	for _, format := range Formats {
+		if !IsFormat(format) {
+			t.Errorf("IsFormat(%q) = false", format)
+		}
+		if _, err := NewWriter(format, io.Discard, "Laporan"); err != nil {
+			t.Errorf("NewWriter(%q): %v", format, err)
+		}
+	}
+	if _, err := NewWriter("json", io.Discard, "Laporan"); err == nil || IsFormat("json") {
+		t.Error("json accepted as an export format")
+	}
+}
+
+func TestFilename(t *testing.T) {
+	// The name goes into a quoted Content-Disposition header
+	if got := Filename(`laporan "harian" a/b\c`+"\r\n", PDF); got != "laporan -harian- a-b-c--.pdf" {
+		t.Errorf("Filename = %q", got)
+	}
+}
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// MaxPDFRows caps the rows of a PDF export. The PDF is laid out in memory,
+// so longer exports should use CSV or XLSX.
+const MaxPDFRows = 5000
+
+const (
+	pdfFont       = "Helvetica"
+	pdfRowHeight  = 6.0
+	pdfMargin     = 10.0
+	pdfPageHeight = 210.0
+)
+
+// pdfWriter lays sections out as tables on landscape A4 pages, repeating a
+// section's header at the top of each page it runs onto
+type pdfWriter struct {
+	w       io.Writer
+	pdf     *fpdf.Fpdf
+	tr      func(string) string
+	columns []string
+	widths  []float64
+	rows    int
+	capped  bool
+}
+
+func newPDFWriter(w io.Writer, title string) *pdfWriter {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, pdfMargin)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin)
+		pdf.SetFont(pdfFont, "I", 7)
+		pdf.CellFormat(0, 4, fmt.Sprintf("Halaman %d", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+	pdf.SetFont(pdfFont, "B", 14)
+	pdf.CellFormat(0, 8, tr(title), "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 8)
+	pdf.CellFormat(0, 5, "Dibuat "+time.Now().Format("02/01/2006 15:04"), "", 1, "L", false, 0, "")
+
+	return &pdfWriter{w: w, pdf: pdf, tr: tr}
+}
+
+func (w *pdfWriter) Section(title string, columns []string) error {
+	if w.capped {
+		return nil
+	}
+	w.columns = columns
+	w.widths = make([]float64, len(columns))
+	pageWidth, _ := w.pdf.GetPageSize()
+	for i := range w.widths {
+		w.widths[i] = (pageWidth - 2*pdfMargin) / float64(len(columns))
+	}
+
+	// Keep the title with the header and at least one row
+	if w.pdf.GetY()+10+3*pdfRowHeight > pdfPageHeight-pdfMargin-5 {
+		w.pdf.AddPage()
+	} else {
+		w.pdf.Ln(4)
+	}
+	w.pdf.SetFont(pdfFont, "B", 11)
+	w.pdf.CellFormat(0, 7, w.tr(title), "", 1, "L", false, 0, "")
+	w.header()
+	return w.pdf.Error()
+}
+
+func (w *pdfWriter) header() {
+	w.pdf.SetFont(pdfFont, "B", 8)
+	w.pdf.SetFillColor(230, 230, 230)
+	for i, col := range w.columns {
+		w.pdf.CellFormat(w.widths[i], pdfRowHeight, w.tr(col), "1", 0, "C", true, 0, "")
+	}
+	w.pdf.Ln(-1)
+	w.pdf.SetFont(pdfFont, "", 8)
+}
+
+func (w *pdfWriter) Row(values ...interface{}) error {
+	if w.capped {
+		return nil
+	}
+	if w.rows == MaxPDFRows {
+		w.capped = true
+		w.pdf.Ln(2)
+		w.pdf.SetFont(pdfFont, "I", 8)
+		w.pdf.CellFormat(0, 5, fmt.Sprintf("Dipotong setelah %d baris, gunakan CSV atau XLSX untuk data lengkap", MaxPDFRows), "", 1, "L", false, 0, "")
+		return w.pdf.Error()
+	}
+	w.rows++
+
+	if w.pdf.GetY()+pdfRowHeight > pdfPageHeight-pdfMargin-5 {
+		w.pdf.AddPage()
+		w.header()
+	}
+	for i, v := range values {
+		if i >= len(w.widths) {
+			break
+		}
+		align := "L"
+		switch v.(type) {
+		case int, int64, float64, *float64, *int:
+			align = "R"
+		}
+		w.pdf.CellFormat(w.widths[i], pdfRowHeight, w.fit(text(v), w.widths[i]), "1", 0, align, false, 0, "")
+	}
+	w.pdf.Ln(-1)
+	return w.pdf.Error()
+}
+
+// fit shortens s until it fits a cell of the given width
+func (w *pdfWriter) fit(s string, width float64) string {
+	s = w.tr(s)
+	if w.pdf.GetStringWidth(s) <= width-2 {
+		return s
+	}
+	// Translated strings are single-byte encoded
+	r := []byte(s)
+	for len(r) > 0 && w.pdf.GetStringWidth(string(r)+"...") > width-2 {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "..."
+}
+
+func (w *pdfWriter) Close() error {
+	return w.pdf.Output(w.w)
+}
@@ -0,0 +1,210 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxWriter streams a minimal Office Open XML workbook: one sheet per
+// section, written row by row straight into the zip, with strings inline so
+// no shared string table has to be collected first
+type xlsxWriter struct {
+	zip    *zip.Writer
+	sheet  *bufio.Writer
+	sheets []string
+	row    int
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{zip: zip.NewWriter(w)}
+}
+
+const xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const xlsxSheetEnd = `</sheetData></worksheet>`
+
+func (w *xlsxWriter) Section(title string, columns []string) error {
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	w.sheets = append(w.sheets, sheetName(title, len(w.sheets)+1, w.sheets))
+	f, err := w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(f)
+	w.row = 0
+	if _, err := w.sheet.WriteString(xlsxSheetStart); err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = col
+	}
+	return w.writeRow(header, true)
+}
+
+func (w *xlsxWriter) Row(values ...interface{}) error {
+	if w.sheet == nil {
+		return fmt.Errorf("xlsx: row written before any section")
+	}
+	return w.writeRow(values, false)
+}
+
+func (w *xlsxWriter) writeRow(values []interface{}, bold bool) error {
+	w.row++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.row)
+	style := ""
+	if bold {
+		style = ` s="1"`
+	}
+	for i, v := range values {
+		ref := columnName(i) + strconv.Itoa(w.row)
+		switch n := v.(type) {
+		case int, int64, float64:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%v</v></c>`, ref, style, n)
+		case *float64:
+			if n != nil {
+				fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%v</v></c>`, ref, style, *n)
+			}
+		case *int:
+			if n != nil {
+				fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%d</v></c>`, ref, style, *n)
+			}
+		default:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">`, ref, style)
+			if err := xml.EscapeText(w.sheet, []byte(text(v))); err != nil {
+				return err
+			}
+			w.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (w *xlsxWriter) endSheet() error {
+	if w.sheet == nil {
+		return nil
+	}
+	if _, err := w.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	err := w.sheet.Flush()
+	w.sheet = nil
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	if len(w.sheets) == 0 {
+		if err := w.Section("Laporan", nil); err != nil {
+			return err
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+
+	for i, name := range w.sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlAttr(name), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		// Style 1 is the bold header row
+		{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, file := range files {
+		f, err := w.zip.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, file.body); err != nil {
+			return err
+		}
+	}
+	return w.zip.Close()
+}
+
+// columnName is the spreadsheet column letter of a zero-based index: A, B, ... Z, AA, ...
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// sheetName makes title a valid, unique sheet name: at most 31 characters
+// and none of the ones Excel forbids
+func sheetName(title string, n int, taken []string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = fmt.Sprintf("Sheet%d", n)
+	}
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	for _, t := range taken {
+		if strings.EqualFold(t, name) {
+			suffix := fmt.Sprintf(" %d", n)
+			r := []rune(name)
+			if len(r)+len(suffix) > 31 {
+				r = r[:31-len(suffix)]
+			}
+			return string(r) + suffix
+		}
+	}
+	return name
+}
+
+func xmlAttr(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return strings.ReplaceAll(b.String(), `"`, "&quot;")
+}
@@ -0,0 +1,49 @@
+// Package jobs holds the background work the API runs next to the HTTP server
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+	"warmindo-api/db"
+)
+
+// SessionIdleCheckInterval is how often abandoned customer sessions are looked for
+const SessionIdleCheckInterval = time.Minute
+
+// StartSessionIdleTimeout closes customer sessions that never placed an order
+// within settings.session_idle_minutes, so an abandoned QR scan doesn't block
+// its table forever. It runs until the process exits.
+func StartSessionIdleTimeout(dbConn *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := CloseIdleSessions(dbConn); err != nil {
+				log.Printf("session idle timeout: %v", err)
+			}
+		}
+	}()
+}
+
+// CloseIdleSessions runs one pass of the idle timeout and returns how many
+// sessions it closed
+func CloseIdleSessions(dbConn *sql.DB) (int, error) {
+	rows, err := dbConn.Query(db.CloseIdleSessionsQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	closed := 0
+	for rows.Next() {
+		var orderCode string
+		var tableNumber int
+		if err := rows.Scan(&orderCode, &tableNumber); err != nil {
+			return closed, err
+		}
+		log.Printf("session idle timeout: closed %s on table %d", orderCode, tableNumber)
+		closed++
+	}
+	return closed, rows.Err()
+}
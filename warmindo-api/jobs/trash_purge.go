@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+	"warmindo-api/db"
+
+	"github.com/lib/pq"
+)
+
+// TrashPurgeInterval is how often the trash is emptied of expired records
+const TrashPurgeInterval = time.Hour
+
+// StartTrashPurge deletes records that have been in the trash for longer
+// than db.TrashRetentionDays, apart from kept ones. It runs until the process exits.
+func StartTrashPurge(dbConn *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := PurgeTrash(dbConn, db.TrashRetentionDays()); err != nil {
+				log.Printf("trash purge: %v", err)
+			}
+		}
+	}()
+}
+
+// PurgeTrash runs one pass of the purge and returns how many records it
+// deleted. Kept tables like order lines are left alone. Rows are deleted
+// one at a time so that a record other records still point at, like a
+// staff member with shifts or a menu with orders, is skipped and stays in
+// the trash instead of failing the whole pass.
+func PurgeTrash(dbConn *sql.DB, retentionDays int) (int, error) {
+	purged := 0
+	for _, t := range db.TrashTables {
+		if t.Kept {
+			continue
+		}
+		ids, err := expiredTrash(dbConn, t.Table, retentionDays)
+		if err != nil {
+			return purged, err
+		}
+		for _, id := range ids {
+			_, err := dbConn.Exec("DELETE FROM "+t.Table+" WHERE id = $1 AND deleted_at IS NOT NULL", id)
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+				log.Printf("trash purge: kept %s %d, still referenced (%s)", t.Type, id, pqErr.Constraint)
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	if purged > 0 {
+		log.Printf("trash purge: deleted %d records", purged)
+	}
+	return purged, nil
+}
+
+func expiredTrash(dbConn *sql.DB, table string, retentionDays int) ([]int, error) {
+	rows, err := dbConn.Query("SELECT id FROM "+table+" WHERE deleted_at < NOW() - make_interval(days => $1) ORDER BY id", retentionDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -12,6 +12,8 @@ import (
 
 	"warmindo-api/api"
 	"warmindo-api/db"
+	"warmindo-api/jobs"
+	"warmindo-api/notify"
 )
 
 func main() {
@@ -26,20 +28,35 @@ func main() {
 	}
 	defer dbConn.Close()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(dbConn, os.Args[2:])
+		dbConn.Close()
+		os.Exit(code)
+	}
+	checkSchema(dbConn)
+
+	notifier, err := notify.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring notifications: %v", err)
+	}
+
+	jobs.StartSessionIdleTimeout(dbConn, jobs.SessionIdleCheckInterval)
+	jobs.StartTrashPurge(dbConn, jobs.TrashPurgeInterval)
+
 	app := fiber.New()
 	app.Use(logger.New())
 	app.Use(requestid.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     os.Getenv("CLIENT_URL"),
 		AllowCredentials: true,
-		AllowHeaders:     "Content-Type, Content-Length, Accept-Encoding, Authorization, accept, origin",
+		AllowHeaders:     "Content-Type, Content-Length, Accept-Encoding, Authorization, accept, origin, X-Customer-Token",
 		AllowMethods:     "POST, OPTIONS, GET, PUT, PATCH, DELETE",
-		ExposeHeaders:    "Set-Cookie",
+		ExposeHeaders:    "Set-Cookie, Retry-After",
 	}))
 
 	// Middleware untuk akses file statis
 	app.Static("/assets/images/", "./assets/images")
-	api.SetupRoutes(app, dbConn)
+	api.SetupRoutes(app, dbConn, notifier)
 
 	log.Fatal(app.Listen(os.Getenv("SERVER_PORT")))
 }
@@ -1,59 +1,271 @@
 package middleware
 
 import (
+	"database/sql"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"warmindo-api/db"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt"
 )
 
-// GenerateJWT generates a JWT token
-func GenerateJWT(userID string, roleID int) (string, error) {
+// AccessTokenTTL is how long an access token is accepted. Clients renew it
+// with their refresh token.
+const AccessTokenTTL = 15 * time.Minute
+
+// ScopePOS marks tokens issued by a PIN login on a POS terminal. Their
+// permissions are capped to db.POSPermissions.
+const ScopePOS = "pos"
+
+// TwoFactorChallengeTTL is how long a user has to enter their TOTP code after
+// the password step
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// Identity is the authenticated staff member behind a request
+type Identity struct {
+	UserID      int
+	RoleID      int
+	SessionID   int
+	OutletID    int
+	Scope       string
+	Permissions []string
+	// EnrollmentOnly is set while the role requires two-factor authentication
+	// and the user hasn't enrolled: only AuthMiddleware routes (profile,
+	// enrollment, logout) are allowed.
+	EnrollmentOnly bool
+}
+
+// HasPermission reports whether the identity's role grants the permission
+func (identity *Identity) HasPermission(permission string) bool {
+	for _, granted := range identity.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateJWT generates a short-lived access token bound to a login session
+// and the outlet it works in
+func GenerateJWT(userID string, roleID int, sessionID int, outletID int) (string, error) {
+	return GenerateScopedJWT(userID, roleID, sessionID, outletID, "", AccessTokenTTL)
+}
+
+// GenerateScopedJWT generates an access token with a restricted scope and lifetime
+func GenerateScopedJWT(userID string, roleID int, sessionID int, outletID int, scope string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":       userID,
+		"role_id":   roleID,
+		"sid":       sessionID,
+		"outlet_id": outletID,
+		"exp":       time.Now().Add(ttl).Unix(),
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("JWT_KEY")))
+}
+
+// GenerateChallengeJWT issues the short-lived token that carries a user from
+// the password step of a login to the two-factor step
+func GenerateChallengeJWT(userID string) (string, error) {
 	claims := jwt.MapClaims{
 		"sub":     userID,
-		"role_id": roleID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+		"purpose": "2fa",
+		"exp":     time.Now().Add(TwoFactorChallengeTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("JWT_KEY")))
 }
 
-// JWTProtected returns a middleware handler for JWT authentication
-func AuthMiddleware(requiredRole int) fiber.Handler {
+// ParseChallengeJWT returns the user id of a valid two-factor challenge token
+func ParseChallengeJWT(tokenString string) (int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(os.Getenv("JWT_KEY")), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, jwt.ErrSignatureInvalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "2fa" {
+		return 0, jwt.ErrSignatureInvalid
+	}
+
+	subject, _ := claims["sub"].(string)
+	return strconv.Atoi(subject)
+}
+
+// CurrentIdentity returns the identity stored by AuthMiddleware, or nil on public routes
+func CurrentIdentity(c *fiber.Ctx) *Identity {
+	identity, _ := c.Locals("identity").(*Identity)
+	return identity
+}
+
+// AuthMiddleware verifies the bearer token and stores the caller's identity,
+// including the permissions of their role, in c.Locals("identity").
+func AuthMiddleware(dbConn *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "No token provided"})
+		if _, err := authenticate(c, dbConn); err != nil {
+			return reject(c, err)
 		}
+		return c.Next()
+	}
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+// RequirePermission authenticates the caller and allows the request when their
+// role has at least one of the given permissions.
+func RequirePermission(dbConn *sql.DB, permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, err := authenticate(c, dbConn)
+		if err != nil {
+			return reject(c, err)
+		}
+		if identity.EnrollmentOnly {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Two-factor authentication must be enabled", "two_factor_enrollment_required": true})
+		}
 
-		// Parse token
-		secretKey := os.Getenv("JWT_KEY")
-		if secretKey == "" {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Server configuration error"})
+		for _, permission := range permissions {
+			if identity.HasPermission(permission) {
+				return c.Next()
+			}
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+}
+
+// RequireRole authenticates the caller and allows the request when they have one of the given roles.
+func RequireRole(dbConn *sql.DB, roleIDs ...int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, err := authenticate(c, dbConn)
+		if err != nil {
+			return reject(c, err)
+		}
+		if identity.EnrollmentOnly {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Two-factor authentication must be enabled", "two_factor_enrollment_required": true})
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
+		for _, roleID := range roleIDs {
+			if identity.RoleID == roleID {
+				return c.Next()
+			}
 		}
 
-		roleID, ok := claims["role_id"].(float64)
-		if !ok || int(roleID) != requiredRole { // Check if role_id is 1 (Admin)
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+}
+
+// authenticate parses the bearer token once per request. Failures are returned
+// as *fiber.Error so callers can answer with the matching status code.
+func authenticate(c *fiber.Ctx, dbConn *sql.DB) (*Identity, error) {
+	if identity := CurrentIdentity(c); identity != nil {
+		return identity, nil
+	}
+
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "No token provided")
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Parse token
+	secretKey := os.Getenv("JWT_KEY")
+	if secretKey == "" {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Server configuration error")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
 		}
+		return []byte(secretKey), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+	}
 
-		return c.Next()
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token claims")
+	}
+
+	subject, _ := claims["sub"].(string)
+	userID, err := strconv.Atoi(subject)
+	sessionID, ok := claims["sid"].(float64)
+	if err != nil || !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token claims")
+	}
+
+	// The role is read from the database rather than the token so that role
+	// changes, deleted staff and revoked sessions take effect immediately.
+	session, err := db.GetActiveSession(dbConn, int(sessionID), userID)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Session has been revoked")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to verify session")
+	}
+	roleID := session.RoleID
+
+	// A token issued before the session switched outlets is stale
+	outletID, _ := claims["outlet_id"].(float64)
+	if int(outletID) != session.OutletID {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Outlet has changed, refresh the token")
+	}
+
+	permissions, err := db.GetRolePermissions(dbConn, roleID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load permissions")
+	}
+
+	scope, _ := claims["scope"].(string)
+	if scope == ScopePOS {
+		permissions = intersect(permissions, db.POSPermissions)
+	}
+
+	identity := &Identity{
+		UserID:      userID,
+		RoleID:      roleID,
+		SessionID:   int(sessionID),
+		OutletID:    session.OutletID,
+		Scope:       scope,
+		Permissions: permissions,
+		// POS tokens are already capped to a few permissions and PIN logins
+		// have no second factor, so the enrollment restriction skips them.
+		EnrollmentOnly: session.TwoFactorEnrollmentRequired && scope != ScopePOS,
+	}
+	c.Locals("identity", identity)
+	return identity, nil
+}
+
+// reject answers an authentication failure in the API's JSON error format
+func reject(c *fiber.Ctx, err error) error {
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{"error": fiberErr.Message})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+func intersect(values, allowed []string) []string {
+	result := []string{}
+	for _, value := range values {
+		for _, a := range allowed {
+			if value == a {
+				result = append(result, value)
+				break
+			}
+		}
 	}
+	return result
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"warmindo-api/migrations"
+)
+
+const migrateUsage = `usage: warmindo-api migrate <command>
+
+  up [version]   apply pending migrations, up to version when given
+  down [steps]   roll back the last applied migration, or the last steps ones
+  status         list migrations and whether they are applied
+  baseline <version>
+                 record migrations up to version as applied without running
+                 them, for a schema already brought up to it by hand`
+
+// runMigrate runs the migrate subcommand and returns the process exit code
+func runMigrate(dbConn *sql.DB, args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	number := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		number = n
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		var done []migrations.Migration
+		done, err = migrations.Up(dbConn, number)
+		for _, m := range done {
+			log.Printf("migrate: applied %s", m)
+		}
+		if err == nil && len(done) == 0 {
+			log.Printf("migrate: nothing to apply")
+		}
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		var done []migrations.Migration
+		done, err = migrations.Down(dbConn, number)
+		for _, m := range done {
+			log.Printf("migrate: rolled back %s", m)
+		}
+		if err == nil && len(done) == 0 {
+			log.Printf("migrate: nothing to roll back")
+		}
+	case "baseline":
+		if number == 0 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		var done []migrations.Migration
+		done, err = migrations.Baseline(dbConn, number)
+		for _, m := range done {
+			log.Printf("migrate: marked %s as applied", m)
+		}
+	case "status":
+		if len(args) > 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = printMigrationStatus(dbConn)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(dbConn *sql.DB) error {
+	states, unknown, err := migrations.Status(dbConn)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		appliedAt := "pending"
+		if s.AppliedAt != "" {
+			appliedAt = "applied " + s.AppliedAt
+		}
+		fmt.Printf("%-32s %s\n", s.Migration, appliedAt)
+	}
+	for _, version := range unknown {
+		fmt.Printf("%04d%-28s %s\n", version, "", "applied, unknown to this binary")
+	}
+	return nil
+}
+
+// checkSchema refuses to serve against a database with pending migrations.
+// Versions newer than the binary are only logged, so an older build can
+// still run during a rolling deploy.
+func checkSchema(dbConn *sql.DB) {
+	states, unknown, err := migrations.Status(dbConn)
+	if err != nil {
+		log.Fatalf("Error checking database migrations: %v", err)
+	}
+	pending := 0
+	for _, s := range states {
+		if s.AppliedAt == "" {
+			pending++
+		}
+	}
+	if pending > 0 {
+		log.Fatalf("Database has %d pending migrations; run `%s migrate up` first", pending, os.Args[0])
+	}
+	if len(unknown) > 0 {
+		log.Printf("Database has migrations this build doesn't know about: %v", unknown)
+	}
+}
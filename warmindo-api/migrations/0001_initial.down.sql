@@ -0,0 +1,12 @@
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE category_translations;
+DROP TABLE menu_translations;
+DROP TABLE settings;
+DROP TABLE customers;
+DROP TABLE orders;
+DROP TABLE menus;
+DROP TABLE staffs;
+DROP TABLE categories;
+DROP TABLE statuses;
+DROP TABLE roles;
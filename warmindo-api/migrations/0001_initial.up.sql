@@ -0,0 +1,174 @@
+-- The schema as it stood before migrations. Databases set up from the
+-- create_db.sql of earlier releases already have these tables, so they are
+-- only created when missing and their columns are then brought in line
+-- with what create_db.sql got wrong: menus.deleted defaults to false,
+-- sessions have the active flag and no end date until they close, orders
+-- carry their table number and order_date defaults to the time the line is
+-- placed.
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS statuses (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS staffs (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    role_id INTEGER NOT NULL REFERENCES roles(id),
+    phone VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS menus (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    image VARCHAR(255),
+    description TEXT,
+    deleted BOOLEAN NOT NULL DEFAULT false,
+    price INTEGER NOT NULL,
+    category_id INTEGER NOT NULL REFERENCES categories(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    order_code VARCHAR(255) NOT NULL,
+    amount INTEGER NOT NULL,
+    status_id INTEGER NOT NULL REFERENCES statuses(id),
+    table_number INTEGER NOT NULL,
+    order_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    menu_id INTEGER NOT NULL REFERENCES menus(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS customers (
+    id SERIAL PRIMARY KEY,
+    order_code VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    table_number INTEGER NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    start_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    end_date TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS settings (
+    id SERIAL PRIMARY KEY,
+    total_table INTEGER NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    radius DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Columns of the older databases. Lines placed before orders had a table
+-- number take their session's table. Sessions that existed before the
+-- active flag are taken as closed, since their end date was set the moment
+-- they were opened.
+UPDATE menus SET deleted = false WHERE deleted IS NULL;
+ALTER TABLE menus ALTER COLUMN deleted SET DEFAULT false, ALTER COLUMN deleted SET NOT NULL;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS table_number INTEGER;
+UPDATE orders o SET table_number = COALESCE(
+    (SELECT cu.table_number FROM customers cu WHERE cu.order_code = o.order_code ORDER BY cu.id LIMIT 1), 0)
+WHERE o.table_number IS NULL;
+ALTER TABLE orders ALTER COLUMN table_number SET NOT NULL,
+    ALTER COLUMN order_date SET DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE customers ALTER COLUMN active SET DEFAULT true,
+    ALTER COLUMN name SET DEFAULT '',
+    ALTER COLUMN end_date DROP DEFAULT;
+
+-- Translations for menu and category content. The name/description stored on
+-- menus and categories is the default language (Indonesian).
+CREATE TABLE menu_translations (
+    menu_id INTEGER NOT NULL REFERENCES menus(id) ON DELETE CASCADE,
+    language VARCHAR(8) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (menu_id, language)
+);
+
+CREATE TABLE category_translations (
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    language VARCHAR(8) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (category_id, language)
+);
+
+-- Role based access control
+CREATE TABLE permissions (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) NOT NULL UNIQUE,
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO roles (id, name) VALUES
+    (1, 'Admin'),
+    (2, 'Kasir'),
+    (3, 'Dapur')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval('roles_id_seq', (SELECT MAX(id) FROM roles));
+
+INSERT INTO permissions (code, description) VALUES
+    ('menus:write', 'Membuat, mengubah dan menghapus menu'),
+    ('categories:write', 'Mengelola kategori'),
+    ('orders:read', 'Melihat semua pesanan'),
+    ('orders:update', 'Mengubah isi pesanan'),
+    ('orders:update_status', 'Mengubah status pesanan'),
+    ('orders:delete', 'Menghapus pesanan'),
+    ('users:read', 'Melihat data staf'),
+    ('users:write', 'Mengelola data staf'),
+    ('roles:read', 'Melihat daftar peran'),
+    ('settings:read', 'Melihat pengaturan'),
+    ('settings:write', 'Mengubah pengaturan');
+
+-- Admin gets everything, cashiers run the floor, the kitchen moves orders along.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 2, id FROM permissions WHERE code IN ('orders:read', 'orders:update', 'orders:update_status', 'settings:read');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 3, id FROM permissions WHERE code IN ('orders:read', 'orders:update_status');
+
+-- Role management
+INSERT INTO permissions (code, description) VALUES
+    ('roles:manage', 'Membuat, mengubah dan menghapus peran beserta izinnya');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'roles:manage';
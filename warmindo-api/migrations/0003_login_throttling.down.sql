@@ -0,0 +1,6 @@
+DROP TABLE login_attempts;
+
+ALTER TABLE staffs
+    DROP COLUMN failed_login_count,
+    DROP COLUMN last_failed_login_at,
+    DROP COLUMN locked_until;
@@ -0,0 +1,15 @@
+-- Login brute-force protection
+ALTER TABLE staffs
+    ADD COLUMN failed_login_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_failed_login_at TIMESTAMP,
+    ADD COLUMN locked_until TIMESTAMP;
+
+CREATE TABLE login_attempts (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    success BOOLEAN NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX login_attempts_ip_created_at_idx ON login_attempts (ip_address, created_at);
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'terminals:manage';
+
+ALTER TABLE auth_sessions DROP COLUMN terminal_id;
+DROP TABLE terminals;
+ALTER TABLE staffs DROP COLUMN pin_hash;
+ALTER TABLE login_attempts RENAME COLUMN identifier TO email;
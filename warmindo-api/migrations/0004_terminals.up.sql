@@ -0,0 +1,22 @@
+-- Login by username, and PIN login on registered POS terminals
+ALTER TABLE login_attempts RENAME COLUMN email TO identifier;
+
+ALTER TABLE staffs ADD COLUMN pin_hash VARCHAR(255);
+
+CREATE TABLE terminals (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    device_key_hash CHAR(64) NOT NULL UNIQUE,
+    active BOOLEAN NOT NULL DEFAULT true,
+    last_seen_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE auth_sessions ADD COLUMN terminal_id INTEGER REFERENCES terminals(id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('terminals:manage', 'Mendaftarkan dan menonaktifkan terminal POS');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'terminals:manage';
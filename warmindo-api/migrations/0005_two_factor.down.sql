@@ -0,0 +1,7 @@
+ALTER TABLE roles DROP COLUMN require_2fa;
+DROP TABLE recovery_codes;
+
+ALTER TABLE staffs
+    DROP COLUMN totp_secret,
+    DROP COLUMN totp_enabled,
+    DROP COLUMN totp_last_step;
@@ -0,0 +1,15 @@
+-- Two-factor authentication (TOTP)
+ALTER TABLE staffs
+    ADD COLUMN totp_secret VARCHAR(64),
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    staff_id INTEGER NOT NULL REFERENCES staffs(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE roles ADD COLUMN require_2fa BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+DROP TABLE tables;
+DELETE FROM permissions WHERE code = 'tables:manage';
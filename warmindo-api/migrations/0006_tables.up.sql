@@ -0,0 +1,22 @@
+-- Signed table QR codes
+INSERT INTO permissions (code, description) VALUES
+    ('tables:manage', 'Mengelola meja dan mencetak kode QR meja');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'tables:manage';
+
+-- Tables as first-class entities. Sessions and orders keep referring to the
+-- table number printed on the table.
+CREATE TABLE tables (
+    id SERIAL PRIMARY KEY,
+    number INTEGER NOT NULL UNIQUE,
+    label VARCHAR(100) NOT NULL,
+    area VARCHAR(50) NOT NULL DEFAULT 'indoor',
+    capacity INTEGER NOT NULL DEFAULT 4,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tables (number, label)
+SELECT n, 'Meja ' || n FROM settings, generate_series(1, settings.total_table) AS n WHERE settings.id = 1;
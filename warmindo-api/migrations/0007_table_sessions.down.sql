@@ -0,0 +1,3 @@
+DROP TABLE table_session_events;
+DROP INDEX customers_active_table_idx;
+ALTER TABLE customers DROP COLUMN merged_into;
@@ -0,0 +1,19 @@
+-- Table transfers and merges. A table can hold only one open session.
+ALTER TABLE customers ADD COLUMN merged_into VARCHAR(255);
+
+CREATE UNIQUE INDEX customers_active_table_idx ON customers (table_number) WHERE active = true;
+
+CREATE TABLE table_session_events (
+    id SERIAL PRIMARY KEY,
+    event VARCHAR(20) NOT NULL,
+    order_code VARCHAR(255) NOT NULL,
+    from_table INTEGER NOT NULL,
+    to_table INTEGER NOT NULL,
+    target_order_code VARCHAR(255),
+    staff_id INTEGER REFERENCES staffs(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX table_session_events_order_code_idx ON table_session_events (order_code);
+CREATE INDEX table_session_events_target_idx ON table_session_events (target_order_code);
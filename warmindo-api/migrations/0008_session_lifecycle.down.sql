@@ -0,0 +1,6 @@
+ALTER TABLE customers
+    DROP COLUMN closed_reason,
+    DROP COLUMN closed_by,
+    DROP COLUMN reopened_at;
+
+ALTER TABLE settings DROP COLUMN session_idle_minutes;
@@ -0,0 +1,11 @@
+-- Customer session lifecycle. Sessions without any order are closed after
+-- session_idle_minutes (0 turns the timeout off).
+ALTER TABLE settings ADD COLUMN session_idle_minutes INTEGER NOT NULL DEFAULT 60;
+
+ALTER TABLE customers
+    ADD COLUMN closed_reason VARCHAR(50),
+    ADD COLUMN closed_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL,
+    ADD COLUMN reopened_at TIMESTAMP;
+
+UPDATE customers SET closed_reason = 'paid' WHERE active = false AND merged_into IS NULL;
+UPDATE customers SET closed_reason = 'merged' WHERE merged_into IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE customers DROP COLUMN access_token_hash;
+ALTER TABLE customers DROP CONSTRAINT customers_order_code_key;
@@ -0,0 +1,6 @@
+-- Random order codes are kept unique by the database, and reading a session's
+-- orders takes the customer access token handed out with the code.
+ALTER TABLE customers ADD CONSTRAINT customers_order_code_key UNIQUE (order_code);
+ALTER TABLE customers ADD COLUMN access_token_hash VARCHAR(64);
+
+CREATE INDEX customers_access_token_hash_idx ON customers (access_token_hash);
@@ -0,0 +1,19 @@
+-- Geofences replace the single settings.latitude/longitude/radius circle.
+-- Circles carry an explicit radius unit; polygons are a JSON array of
+-- {"lat", "lng"} points. The old circle (in kilometres) becomes the first one.
+CREATE TABLE geofences (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('circle', 'polygon')),
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    radius DOUBLE PRECISION,
+    radius_unit VARCHAR(2) CHECK (radius_unit IN ('m', 'km')),
+    polygon JSONB,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO geofences (name, kind, latitude, longitude, radius, radius_unit)
+SELECT 'Warung', 'circle', latitude, longitude, radius, 'km' FROM settings WHERE id = 1;
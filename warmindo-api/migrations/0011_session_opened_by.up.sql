@@ -0,0 +1,2 @@
+-- Sessions opened by staff skip the location check; keep who opened them
+ALTER TABLE customers ADD COLUMN opened_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL;
@@ -0,0 +1,21 @@
+DELETE FROM permissions WHERE code = 'outlets:manage';
+
+ALTER TABLE auth_sessions DROP COLUMN outlet_id;
+DROP TABLE staff_outlets;
+DROP TABLE outlet_menus;
+
+ALTER TABLE table_session_events DROP COLUMN outlet_id;
+ALTER TABLE orders DROP COLUMN outlet_id;
+
+DROP INDEX customers_active_table_idx;
+ALTER TABLE customers DROP COLUMN outlet_id;
+CREATE UNIQUE INDEX customers_active_table_idx ON customers (table_number) WHERE active = true;
+
+ALTER TABLE terminals DROP COLUMN outlet_id;
+ALTER TABLE geofences DROP COLUMN outlet_id;
+
+ALTER TABLE tables DROP COLUMN outlet_id;
+ALTER TABLE tables ADD CONSTRAINT tables_number_key UNIQUE (number);
+
+ALTER TABLE settings DROP COLUMN outlet_id;
+DROP TABLE outlets;
@@ -0,0 +1,76 @@
+-- Outlets. Settings, tables, geofences, terminals, customer sessions and
+-- orders belong to one outlet; the menu catalog is shared and outlet_menus
+-- overrides price and availability per outlet. Staff work at the outlets
+-- they are assigned to. Existing data becomes the first outlet.
+CREATE TABLE outlets (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(20) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    phone VARCHAR(20) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO outlets (id, code, name) VALUES (1, 'PUSAT', 'Warmindo Pusat');
+SELECT setval('outlets_id_seq', (SELECT MAX(id) FROM outlets));
+
+ALTER TABLE settings ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id) ON DELETE CASCADE;
+ALTER TABLE settings ALTER COLUMN outlet_id DROP DEFAULT;
+ALTER TABLE settings ADD CONSTRAINT settings_outlet_id_key UNIQUE (outlet_id);
+
+-- A fresh database has no settings yet; the first outlet gets the same
+-- defaults as outlets created through the API
+INSERT INTO settings (outlet_id, total_table, latitude, longitude, radius)
+SELECT 1, 0, 0, 0, 0 WHERE NOT EXISTS (SELECT 1 FROM settings);
+
+ALTER TABLE tables ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id);
+ALTER TABLE tables ALTER COLUMN outlet_id DROP DEFAULT;
+ALTER TABLE tables DROP CONSTRAINT tables_number_key;
+ALTER TABLE tables ADD CONSTRAINT tables_outlet_number_key UNIQUE (outlet_id, number);
+
+ALTER TABLE geofences ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id) ON DELETE CASCADE;
+ALTER TABLE geofences ALTER COLUMN outlet_id DROP DEFAULT;
+
+ALTER TABLE terminals ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id);
+ALTER TABLE terminals ALTER COLUMN outlet_id DROP DEFAULT;
+
+ALTER TABLE customers ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id);
+ALTER TABLE customers ALTER COLUMN outlet_id DROP DEFAULT;
+DROP INDEX customers_active_table_idx;
+CREATE UNIQUE INDEX customers_active_table_idx ON customers (outlet_id, table_number) WHERE active = true;
+
+ALTER TABLE orders ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id);
+ALTER TABLE orders ALTER COLUMN outlet_id DROP DEFAULT;
+CREATE INDEX orders_outlet_id_idx ON orders (outlet_id);
+
+ALTER TABLE table_session_events ADD COLUMN outlet_id INTEGER NOT NULL DEFAULT 1 REFERENCES outlets(id);
+ALTER TABLE table_session_events ALTER COLUMN outlet_id DROP DEFAULT;
+
+CREATE TABLE outlet_menus (
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id) ON DELETE CASCADE,
+    menu_id INTEGER NOT NULL REFERENCES menus(id) ON DELETE CASCADE,
+    price INTEGER,
+    available BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (outlet_id, menu_id)
+);
+
+CREATE TABLE staff_outlets (
+    staff_id INTEGER NOT NULL REFERENCES staffs(id) ON DELETE CASCADE,
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id) ON DELETE CASCADE,
+    PRIMARY KEY (staff_id, outlet_id)
+);
+
+INSERT INTO staff_outlets (staff_id, outlet_id) SELECT id, 1 FROM staffs;
+
+-- The outlet a login session is working in; switching outlets updates it
+ALTER TABLE auth_sessions ADD COLUMN outlet_id INTEGER REFERENCES outlets(id);
+UPDATE auth_sessions SET outlet_id = 1;
+
+INSERT INTO permissions (code, description) VALUES
+    ('outlets:manage', 'Mengelola outlet, harga per outlet dan penempatan staf');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'outlets:manage';
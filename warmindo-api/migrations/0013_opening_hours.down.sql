@@ -0,0 +1,6 @@
+DROP TABLE store_closures;
+DROP TABLE opening_hours;
+
+ALTER TABLE settings DROP COLUMN closed_message;
+ALTER TABLE settings DROP COLUMN manual_closed;
+ALTER TABLE settings DROP COLUMN timezone;
@@ -0,0 +1,30 @@
+-- Opening hours. Each outlet has weekly opening periods (weekday 0 = Sunday;
+-- a period closing at or before its opening time runs past midnight), whole
+-- days it is closed for holidays, and a manual "close now" switch. An outlet
+-- without any opening periods is open around the clock.
+ALTER TABLE settings ADD COLUMN timezone TEXT NOT NULL DEFAULT 'Asia/Jakarta';
+ALTER TABLE settings ADD COLUMN manual_closed BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE settings ADD COLUMN closed_message TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE opening_hours (
+    id SERIAL PRIMARY KEY,
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    open_time TIME NOT NULL,
+    close_time TIME NOT NULL
+);
+
+CREATE INDEX opening_hours_outlet_id_idx ON opening_hours (outlet_id);
+
+CREATE TABLE store_closures (
+    id SERIAL PRIMARY KEY,
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date >= start_date)
+);
+
+CREATE INDEX store_closures_outlet_id_idx ON store_closures (outlet_id, end_date);
@@ -0,0 +1,6 @@
+-- Sales reports
+INSERT INTO permissions (code, description) VALUES
+    ('reports:read', 'Melihat laporan penjualan');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'reports:read';
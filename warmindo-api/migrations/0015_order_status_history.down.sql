@@ -0,0 +1,3 @@
+-- The seeded statuses stay: orders may be using them
+DROP TABLE order_status_events;
+ALTER TABLE statuses DROP COLUMN code;
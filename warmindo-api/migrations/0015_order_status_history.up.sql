@@ -0,0 +1,45 @@
+-- Order status codes and history. The API acts on statuses by code rather
+-- than by name; "served" sits between cooking and paid. Every status change
+-- is recorded with who made it, for the kitchen performance report.
+ALTER TABLE statuses ADD COLUMN code VARCHAR(32) UNIQUE;
+
+-- The API refers to statuses by these ids, so statuses already sitting at
+-- them must be the same ones. Anything else has to be sorted out by hand
+-- rather than have its codes reassigned.
+DO $$
+DECLARE
+    mismatch TEXT;
+BEGIN
+    SELECT string_agg(format('%s is %L, expected %L', s.id, s.name, e.name), '; ' ORDER BY s.id) INTO mismatch
+    FROM statuses s
+    JOIN (VALUES (1, 'Menunggu'), (2, 'Dimasak'), (3, 'Lunas'), (4, 'Disajikan')) AS e (id, name) ON e.id = s.id
+    WHERE lower(s.name) <> lower(e.name);
+    IF mismatch IS NOT NULL THEN
+        RAISE EXCEPTION 'statuses don''t match the ids the API uses: %', mismatch;
+    END IF;
+END $$;
+
+INSERT INTO statuses (id, name, code) VALUES
+    (1, 'Menunggu', 'pending'),
+    (2, 'Dimasak', 'cooking'),
+    (3, 'Lunas', 'paid'),
+    (4, 'Disajikan', 'served')
+ON CONFLICT (id) DO UPDATE SET code = EXCLUDED.code;
+SELECT setval('statuses_id_seq', (SELECT MAX(id) FROM statuses));
+
+CREATE TABLE order_status_events (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id),
+    status_id INTEGER NOT NULL REFERENCES statuses(id),
+    staff_id INTEGER REFERENCES staffs(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_status_events_order_id_idx ON order_status_events (order_id, status_id, created_at);
+CREATE INDEX order_status_events_outlet_id_idx ON order_status_events (outlet_id, created_at);
+
+-- Orders already past pending get their current status at their last update,
+-- the best guess available
+INSERT INTO order_status_events (order_id, outlet_id, status_id, created_at)
+SELECT id, outlet_id, status_id, updated_at FROM orders WHERE status_id <> 1;
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'shifts:operate';
+
+ALTER TABLE orders DROP COLUMN payment_id;
+DROP TABLE payments;
+DROP TABLE cash_movements;
+DROP TABLE shifts;
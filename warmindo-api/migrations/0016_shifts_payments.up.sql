@@ -0,0 +1,62 @@
+-- Cashier shifts and payments. A shift runs from counting the starting cash
+-- into the drawer to counting it at close; cash payments and pay-ins/outs
+-- recorded in between give the cash the drawer should hold, and the
+-- difference with the count is the shift's over/short. A staff member, and
+-- a terminal, have at most one open shift.
+CREATE TABLE shifts (
+    id SERIAL PRIMARY KEY,
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id),
+    staff_id INTEGER NOT NULL REFERENCES staffs(id),
+    terminal_id INTEGER REFERENCES terminals(id),
+    opening_cash INTEGER NOT NULL CHECK (opening_cash >= 0),
+    counted_cash INTEGER,
+    expected_cash INTEGER,
+    difference INTEGER,
+    open_note TEXT NOT NULL DEFAULT '',
+    close_note TEXT NOT NULL DEFAULT '',
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP,
+    closed_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX shifts_open_staff_idx ON shifts (staff_id) WHERE closed_at IS NULL;
+CREATE UNIQUE INDEX shifts_open_terminal_idx ON shifts (terminal_id) WHERE closed_at IS NULL;
+CREATE INDEX shifts_outlet_id_idx ON shifts (outlet_id, opened_at);
+
+CREATE TABLE cash_movements (
+    id SERIAL PRIMARY KEY,
+    shift_id INTEGER NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('pay_in', 'pay_out')),
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL,
+    staff_id INTEGER NOT NULL REFERENCES staffs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX cash_movements_shift_id_idx ON cash_movements (shift_id);
+
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id),
+    order_code VARCHAR(255) NOT NULL,
+    method VARCHAR(16) NOT NULL CHECK (method IN ('cash', 'qris', 'transfer', 'card')),
+    amount INTEGER NOT NULL,
+    tendered INTEGER NOT NULL,
+    change INTEGER NOT NULL DEFAULT 0,
+    shift_id INTEGER REFERENCES shifts(id),
+    staff_id INTEGER NOT NULL REFERENCES staffs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX payments_outlet_id_idx ON payments (outlet_id, created_at);
+CREATE INDEX payments_shift_id_idx ON payments (shift_id);
+CREATE INDEX payments_order_code_idx ON payments (order_code);
+
+-- The payment that settled an order line
+ALTER TABLE orders ADD COLUMN payment_id INTEGER REFERENCES payments(id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('shifts:operate', 'Membuka dan menutup shift kasir, menerima pembayaran dan mencatat kas masuk/keluar');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT role_id, id FROM permissions, (VALUES (1), (2)) AS r(role_id) WHERE code = 'shifts:operate';
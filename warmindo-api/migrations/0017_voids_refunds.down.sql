@@ -0,0 +1,7 @@
+-- The cancelled status stays: orders may be using it
+DELETE FROM permissions WHERE code IN ('orders:void', 'orders:approve_void');
+
+DROP TABLE refunds;
+DROP TABLE order_voids;
+ALTER TABLE settings DROP COLUMN void_approval_threshold;
+ALTER TABLE orders DROP COLUMN cancelled_at;
@@ -0,0 +1,61 @@
+-- Cancellations, voids and refunds. Order lines are no longer deleted: a
+-- cancelled line keeps its row with the cancelled status and cancelled_at
+-- set, which revenue and bill queries filter on. Every void, partial or
+-- whole, is recorded with its reason, who made it and, above the outlet's
+-- threshold, the manager who approved it. Refunds are given against the
+-- payments recorded for an order code.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM statuses WHERE id = 5 AND lower(name) <> 'dibatalkan') THEN
+        RAISE EXCEPTION 'status 5 is %, expected Dibatalkan', (SELECT name FROM statuses WHERE id = 5);
+    END IF;
+END $$;
+INSERT INTO statuses (id, name, code) VALUES (5, 'Dibatalkan', 'cancelled')
+ON CONFLICT (id) DO UPDATE SET code = EXCLUDED.code;
+SELECT setval('statuses_id_seq', (SELECT MAX(id) FROM statuses));
+
+ALTER TABLE orders ADD COLUMN cancelled_at TIMESTAMP;
+
+ALTER TABLE settings ADD COLUMN void_approval_threshold INTEGER NOT NULL DEFAULT 50000;
+
+CREATE TABLE order_voids (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id),
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price INTEGER NOT NULL,
+    cancelled BOOLEAN NOT NULL DEFAULT false,
+    reason TEXT NOT NULL CHECK (reason <> ''),
+    staff_id INTEGER NOT NULL REFERENCES staffs(id),
+    approved_by INTEGER REFERENCES staffs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_voids_outlet_id_idx ON order_voids (outlet_id, created_at);
+CREATE INDEX order_voids_order_id_idx ON order_voids (order_id);
+
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL REFERENCES payments(id),
+    outlet_id INTEGER NOT NULL REFERENCES outlets(id),
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL CHECK (reason <> ''),
+    shift_id INTEGER REFERENCES shifts(id),
+    staff_id INTEGER NOT NULL REFERENCES staffs(id),
+    approved_by INTEGER REFERENCES staffs(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX refunds_payment_id_idx ON refunds (payment_id);
+CREATE INDEX refunds_outlet_id_idx ON refunds (outlet_id, created_at);
+CREATE INDEX refunds_shift_id_idx ON refunds (shift_id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('orders:void', 'Membatalkan pesanan atau mengurangi jumlahnya dengan alasan'),
+    ('orders:approve_void', 'Menyetujui pembatalan dan pengembalian dana di atas batas outlet');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT role_id, id FROM permissions, (VALUES (1), (2)) AS r(role_id) WHERE code = 'orders:void';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'orders:approve_void';
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code = 'trash:manage';
+
+ALTER TABLE customers DROP COLUMN deleted_at, DROP COLUMN deleted_by;
+ALTER TABLE orders DROP COLUMN deleted_at, DROP COLUMN deleted_by;
+ALTER TABLE menus DROP COLUMN deleted_at, DROP COLUMN deleted_by;
+ALTER TABLE categories DROP COLUMN deleted_at, DROP COLUMN deleted_by;
+ALTER TABLE staffs DROP COLUMN deleted_at, DROP COLUMN deleted_by;
@@ -0,0 +1,30 @@
+-- Soft delete. Staff, categories, menus, order lines and customer sessions
+-- are moved to the trash by setting deleted_at instead of being deleted, so
+-- the shifts, payments and voids pointing at them stay intact. List queries
+-- leave trashed rows out; admins can list and restore them until the purge
+-- job deletes them after TRASH_RETENTION_DAYS (30 by default). Rows that
+-- are still referenced, like order lines with void records, stay trashed.
+ALTER TABLE staffs
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL;
+ALTER TABLE categories
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL;
+ALTER TABLE menus
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL;
+ALTER TABLE orders
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL;
+ALTER TABLE customers
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by INTEGER REFERENCES staffs(id) ON DELETE SET NULL;
+
+-- Menus deleted before now go to the trash as of the migration
+UPDATE menus SET deleted_at = COALESCE(updated_at, NOW()) WHERE deleted = true;
+
+INSERT INTO permissions (code, description) VALUES
+    ('trash:manage', 'Melihat dan memulihkan data yang dihapus');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE code = 'trash:manage';
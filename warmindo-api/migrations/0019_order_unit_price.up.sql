@@ -0,0 +1,10 @@
+-- Order lines keep the price they were sold at, like order_voids do, so a
+-- later menu or outlet price change doesn't rewrite past sales. Existing
+-- lines take today's price, the best that is known about them.
+ALTER TABLE orders ADD COLUMN unit_price INTEGER;
+
+UPDATE orders o SET unit_price = COALESCE(
+    (SELECT om.price FROM outlet_menus om WHERE om.outlet_id = o.outlet_id AND om.menu_id = o.menu_id),
+    (SELECT m.price FROM menus m WHERE m.id = o.menu_id));
+
+ALTER TABLE orders ALTER COLUMN unit_price SET NOT NULL;
@@ -0,0 +1 @@
+DROP INDEX login_attempts_identifier_created_at_idx;
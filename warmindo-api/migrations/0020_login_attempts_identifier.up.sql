@@ -0,0 +1,2 @@
+-- Logins for unknown identifiers are throttled from their recorded attempts
+CREATE INDEX login_attempts_identifier_created_at_idx ON login_attempts (identifier, created_at);
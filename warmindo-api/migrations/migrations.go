@@ -0,0 +1,316 @@
+// Package migrations holds the versioned database schema, embedded in the
+// binary. Each version is a pair of files, NNNN_name.up.sql and
+// NNNN_name.down.sql; applied versions are recorded in schema_migrations.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockKey serializes migration runs across processes through a Postgres
+// advisory lock
+const lockKey = 7260050
+
+const createVersionTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migration is one version of the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String names a migration the way its files are named
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// State is a migration with when it was applied, empty while pending
+type State struct {
+	Migration
+	AppliedAt string
+}
+
+// All returns the embedded migrations in version order
+func All() ([]Migration, error) {
+	return load(files)
+}
+
+// load reads the migrations at the root of fsys
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction := strings.TrimSuffix(fileName, ".sql"), ""
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base, direction = strings.TrimSuffix(base, ".up"), "up"
+		case strings.HasSuffix(base, ".down"):
+			base, direction = strings.TrimSuffix(base, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", fileName)
+		}
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", fileName)
+		}
+
+		body, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// applied returns the recorded versions with when they were applied. A
+// database never migrated has none.
+func applied(dbConn *sql.DB) (map[int]string, error) {
+	var exists bool
+	if err := dbConn.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	versions := map[int]string{}
+	if !exists {
+		return versions, nil
+	}
+
+	rows, err := dbConn.Query("SELECT version, applied_at::text FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// Status lists every embedded migration with when it was applied, and the
+// versions recorded in the database that this binary doesn't know about
+func Status(dbConn *sql.DB) ([]State, []int, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, nil, err
+	}
+	versions, err := applied(dbConn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	states := make([]State, 0, len(migrations))
+	for _, m := range migrations {
+		states = append(states, State{Migration: m, AppliedAt: versions[m.Version]})
+		delete(versions, m.Version)
+	}
+	unknown := make([]int, 0, len(versions))
+	for version := range versions {
+		unknown = append(unknown, version)
+	}
+	sort.Ints(unknown)
+	return states, unknown, nil
+}
+
+// Pending returns the migrations not applied yet, in the order Up runs them
+func Pending(dbConn *sql.DB) ([]Migration, error) {
+	states, _, err := Status(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range states {
+		if s.AppliedAt == "" {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations up to and including version target, or
+// all of them when target is 0. Each migration runs in its own transaction,
+// so a failing one leaves the versions before it applied.
+func Up(dbConn *sql.DB, target int) ([]Migration, error) {
+	pending, err := Pending(dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		if target > 0 && m.Version > target {
+			break
+		}
+		ran, err := run(dbConn, m, true)
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", m, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func Down(dbConn *sql.DB, steps int) ([]Migration, error) {
+	states, unknown, err := Status(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("database has versions this binary doesn't know about: %v", unknown)
+	}
+
+	var done []Migration
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		if states[i].AppliedAt == "" {
+			continue
+		}
+		m := states[i].Migration
+		ran, err := run(dbConn, m, false)
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", m, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// Baseline records the migrations up to and including version as applied
+// without running them, for adopting a database whose schema was created
+// by hand. It refuses when the database already has recorded versions.
+func Baseline(dbConn *sql.DB, version int) ([]Migration, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+	known := false
+	for _, m := range migrations {
+		if m.Version == version {
+			known = true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("no migration has version %d", version)
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(createVersionTableQuery); err != nil {
+		return nil, err
+	}
+	var recorded int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&recorded); err != nil {
+		return nil, err
+	}
+	if recorded > 0 {
+		return nil, fmt.Errorf("database already has %d recorded migrations", recorded)
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+			return nil, err
+		}
+		done = append(done, m)
+	}
+	return done, tx.Commit()
+}
+
+// run applies or rolls back one migration under the advisory lock. It
+// reports false without doing anything when another process got there first.
+func run(dbConn *sql.DB, m Migration, up bool) (bool, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(createVersionTableQuery); err != nil {
+		return false, err
+	}
+	var isApplied bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.Version).Scan(&isApplied); err != nil {
+		return false, err
+	}
+	if isApplied == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 || migrations[0].Name != "initial" {
+		t.Fatalf("first embedded migration is %v, want 0001_initial", migrations)
+	}
+	// Baseline and Up go by version, so a gap would be skipped silently
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %s is number %d, versions must run 1, 2, 3... without gaps", m, i+1)
+		}
+	}
+}
+
+var (
+	createTable = regexp.MustCompile(`(?i)CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+	alterTable  = regexp.MustCompile(`(?is)ALTER TABLE (\w+)(.*?);`)
+	addColumn   = regexp.MustCompile(`(?i)ADD COLUMN (?:IF NOT EXISTS )?(\w+)`)
+)
+
+// dropped reports whether sql drops the table, alone or in a list
+func dropped(sql, kind, name string) bool {
+	return regexp.MustCompile(`(?i)DROP ` + kind + ` (?:IF EXISTS )?(?:\w+, )*` + name + `\b`).MatchString(sql)
+}
+
+func TestDownUndoesUp(t *testing.T) {
+	migrations, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rolling back has to leave the schema as the previous version had it,
+	// or going up again fails on what was left behind
+	for _, m := range migrations {
+		for _, match := range createTable.FindAllStringSubmatch(m.Up, -1) {
+			if !dropped(m.Down, "TABLE", match[1]) {
+				t.Errorf("%s creates table %s but its down file doesn't drop it", m, match[1])
+			}
+		}
+		for _, alter := range alterTable.FindAllStringSubmatch(m.Up, -1) {
+			table := alter[1]
+			for _, column := range addColumn.FindAllStringSubmatch(alter[2], -1) {
+				if !dropped(m.Down, "TABLE", table) && !dropped(m.Down, "COLUMN", column[1]) {
+					t.Errorf("%s adds column %s.%s but its down file doesn't drop it", m, table, column[1])
+				}
+			}
+		}
+	}
+}
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoadOrdersByVersionNumber(t *testing.T) {
+	// Unpadded versions sort differently as text: 10 before 9
+	migrations, err := load(fstest.MapFS{
+		"10_menu_prices.up.sql":   file("ALTER TABLE menus ADD COLUMN price INTEGER;"),
+		"10_menu_prices.down.sql": file("ALTER TABLE menus DROP COLUMN price;"),
+		"9_menus.up.sql":          file("CREATE TABLE menus ();"),
+		"9_menus.down.sql":        file("DROP TABLE menus;"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].String() != "0009_menus" || migrations[1].String() != "0010_menu_prices" {
+		t.Fatalf("load = %v, want 0009_menus then 0010_menu_prices", migrations)
+	}
+	if m := migrations[1]; m.Up != "ALTER TABLE menus ADD COLUMN price INTEGER;" || m.Down != "ALTER TABLE menus DROP COLUMN price;" {
+		t.Errorf("0010 has up %q and down %q", m.Up, m.Down)
+	}
+}
+
+func TestLoadRejectsMisnamedFiles(t *testing.T) {
+	for want, fsys := range map[string]fstest.MapFS{
+		"needs both an up and a down file": {
+			"0001_initial.up.sql": file("SELECT 1;"),
+		},
+		"is named both": {
+			"0001_initial.up.sql": file("SELECT 1;"),
+			"0001_init.down.sql":  file("SELECT 1;"),
+		},
+		"must end in .up.sql or .down.sql": {
+			"0001_initial.sql": file("SELECT 1;"),
+		},
+		"must start with a version number": {
+			"initial.up.sql":   file("SELECT 1;"),
+			"initial.down.sql": file("SELECT 1;"),
+		},
+	} {
+		if _, err := load(fsys); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("load error = %v, want one saying it %s", err, want)
+		}
+	}
+
+	// Version 0 would sort before 0001_initial and never be recorded
+	_, err := load(fstest.MapFS{"0000_setup.up.sql": file("SELECT 1;"), "0000_setup.down.sql": file("SELECT 1;")})
+	if err == nil {
+		t.Error("version 0 accepted")
+	}
+}
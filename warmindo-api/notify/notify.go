@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier delivers a message to a staff member
+type Notifier interface {
+	Send(to, subject, body string) error
+}
+
+// FromEnv picks the notifier configured by NOTIFIER: "smtp", "file" or
+// "log". There is no default: messages carry reset links, so writing them
+// to the application log has to be asked for, for local development.
+func FromEnv() (Notifier, error) {
+	switch name := os.Getenv("NOTIFIER"); name {
+	case "smtp":
+		n := &SMTPNotifier{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+		if n.Host == "" || n.Port == "" || n.From == "" {
+			return nil, errors.New("NOTIFIER=smtp needs SMTP_HOST, SMTP_PORT and SMTP_FROM")
+		}
+		return n, nil
+	case "file":
+		path := os.Getenv("NOTIFIER_FILE")
+		if path == "" {
+			path = "notifications.log"
+		}
+		return &FileNotifier{Path: path}, nil
+	case "log":
+		return LogNotifier{}, nil
+	case "":
+		return nil, errors.New("NOTIFIER is not set; use smtp, file or log")
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q; use smtp, file or log", name)
+	}
+}
+
+// SMTPNotifier sends plain text email through an SMTP server
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (n *SMTPNotifier) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + n.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(n.Host+":"+n.Port, auth, n.From, []string{to}, []byte(msg))
+}
+
+// LogNotifier writes messages to the application log instead of sending them
+type LogNotifier struct{}
+
+func (LogNotifier) Send(to, subject, body string) error {
+	log.Printf("notify: to=%s subject=%q\n%s", to, subject, body)
+	return nil
+}
+
+// FileNotifier appends messages to a file, handy for testing flows locally
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (n *FileNotifier) Send(to, subject, body string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "=== %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+	return err
+}
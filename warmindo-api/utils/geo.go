@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"math"
+	"warmindo-api/db"
+)
+
+// EarthRadiusMeters is the mean Earth radius used for distances
+const EarthRadiusMeters = 6371000.0
+
+// DistanceMeters is the great-circle distance between two points (haversine)
+func DistanceMeters(a, b db.GeoPoint) float64 {
+	dLat := degreesToRadians(b.Lat - a.Lat)
+	dLng := degreesToRadians(b.Lng - a.Lng)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(degreesToRadians(a.Lat))*math.Cos(degreesToRadians(b.Lat))*
+			math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusMeters * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// InPolygon reports whether p lies inside the polygon (ray casting). The
+// polygon is implicitly closed.
+func InPolygon(p db.GeoPoint, polygon []db.GeoPoint) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// onEdgeMeters is how close to an edge a point counts as on it. Points on
+// the edge are a rounding error away from it after projecting.
+const onEdgeMeters = 1e-6
+
+// DistanceToPolygonMeters is 0 inside the polygon or on its boundary,
+// otherwise the distance to its nearest edge. Edges are measured on a local
+// flat projection, which is accurate at the scale of a restaurant.
+func DistanceToPolygonMeters(p db.GeoPoint, polygon []db.GeoPoint) float64 {
+	if len(polygon) == 0 {
+		return math.Inf(1)
+	}
+	if InPolygon(p, polygon) {
+		return 0
+	}
+
+	project := func(q db.GeoPoint) (float64, float64) {
+		x := degreesToRadians(q.Lng-p.Lng) * math.Cos(degreesToRadians(p.Lat)) * EarthRadiusMeters
+		y := degreesToRadians(q.Lat-p.Lat) * EarthRadiusMeters
+		return x, y
+	}
+
+	nearest := math.Inf(1)
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		ax, ay := project(polygon[j])
+		bx, by := project(polygon[i])
+		// Distance from the origin (p) to segment a-b
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if lenSq := dx*dx + dy*dy; lenSq > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lenSq))
+		}
+		nearest = math.Min(nearest, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	if nearest < onEdgeMeters {
+		return 0
+	}
+	return nearest
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"warmindo-api/db"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	monas := db.GeoPoint{Lat: -6.1754, Lng: 106.8272}
+	bundaranHI := db.GeoPoint{Lat: -6.1950, Lng: 106.8230}
+	if d := DistanceMeters(monas, bundaranHI); math.Abs(d-2228.3) > 1 {
+		t.Errorf("Monas to Bundaran HI = %.1f m, want about 2228.3", d)
+	}
+	if d, back := DistanceMeters(monas, bundaranHI), DistanceMeters(bundaranHI, monas); d != back {
+		t.Errorf("distance depends on direction: %.6f and %.6f", d, back)
+	}
+	if d := DistanceMeters(monas, monas); d != 0 {
+		t.Errorf("distance to itself = %v", d)
+	}
+
+	// Across the antimeridian the short way round is taken
+	east := db.GeoPoint{Lat: 0, Lng: 179.9995}
+	west := db.GeoPoint{Lat: 0, Lng: -179.9995}
+	if d := DistanceMeters(east, west); math.Abs(d-111.2) > 0.1 {
+		t.Errorf("across the antimeridian = %.1f m, want about 111.2", d)
+	}
+}
+
+// A warung of about 55 by 66 metres near Monas, its corners given
+// clockwise
+var warung = []db.GeoPoint{
+	{Lat: -6.17520, Lng: 106.82700},
+	{Lat: -6.17520, Lng: 106.82760},
+	{Lat: -6.17570, Lng: 106.82760},
+	{Lat: -6.17570, Lng: 106.82700},
+}
+
+func TestDistanceToPolygonBoundary(t *testing.T) {
+	// A diner standing on the fence line is inside, on every side and at
+	// every corner
+	onBoundary := []db.GeoPoint{
+		{Lat: -6.17520, Lng: 106.82730},
+		{Lat: -6.17545, Lng: 106.82760},
+		{Lat: -6.17570, Lng: 106.82730},
+		{Lat: -6.17545, Lng: 106.82700},
+	}
+	onBoundary = append(onBoundary, warung...)
+	for _, p := range onBoundary {
+		if d := DistanceToPolygonMeters(p, warung); d != 0 {
+			t.Errorf("%v on the boundary is %g m outside", p, d)
+		}
+	}
+
+	// A step of 0.000001 degrees, about 11 cm, across the north edge
+	if d := DistanceToPolygonMeters(db.GeoPoint{Lat: -6.175201, Lng: 106.8273}, warung); d != 0 {
+		t.Errorf("just inside the north edge is %g m outside", d)
+	}
+	if d := DistanceToPolygonMeters(db.GeoPoint{Lat: -6.175199, Lng: 106.8273}, warung); math.Abs(d-0.111) > 0.001 {
+		t.Errorf("just outside the north edge = %g m, want about 0.111", d)
+	}
+}
+
+func TestDistanceToPolygonOutside(t *testing.T) {
+	tests := []struct {
+		name string
+		p    db.GeoPoint
+		want float64
+	}{
+		// Straight out from an edge the distance is to the edge...
+		{"east of the east edge", db.GeoPoint{Lat: -6.17545, Lng: 106.82860}, 110.6},
+		// ...and past a corner it is to the corner
+		{"off the north-east corner", db.GeoPoint{Lat: -6.17420, Lng: 106.82860}, 156.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DistanceToPolygonMeters(tt.p, warung); math.Abs(got-tt.want) > 0.5 {
+				t.Errorf("DistanceToPolygonMeters = %.1f, want %.1f", got, tt.want)
+			}
+		})
+	}
+
+	if d := DistanceToPolygonMeters(warung[0], nil); !math.IsInf(d, 1) {
+		t.Errorf("distance to no polygon = %v, want +Inf", d)
+	}
+}
+
+func TestInPolygonConcave(t *testing.T) {
+	// A U open to the north: the notch between the arms is outside even
+	// though it lies within the U's bounding box
+	u := []db.GeoPoint{
+		{Lat: 0, Lng: 0}, {Lat: 0, Lng: 0.003}, {Lat: 0.003, Lng: 0.003}, {Lat: 0.003, Lng: 0.002},
+		{Lat: 0.001, Lng: 0.002}, {Lat: 0.001, Lng: 0.001}, {Lat: 0.003, Lng: 0.001}, {Lat: 0.003, Lng: 0},
+	}
+	reversed := make([]db.GeoPoint, len(u))
+	for i, p := range u {
+		reversed[len(u)-1-i] = p
+	}
+
+	tests := []struct {
+		name string
+		p    db.GeoPoint
+		want bool
+	}{
+		{"left arm", db.GeoPoint{Lat: 0.002, Lng: 0.0005}, true},
+		{"right arm", db.GeoPoint{Lat: 0.002, Lng: 0.0025}, true},
+		{"base", db.GeoPoint{Lat: 0.0005, Lng: 0.0015}, true},
+		{"notch", db.GeoPoint{Lat: 0.002, Lng: 0.0015}, false},
+		// The ray from here runs through the vertex at 0.001, 0.002
+		{"level with the notch's floor", db.GeoPoint{Lat: 0.001, Lng: 0.0005}, true},
+		{"north of the arms", db.GeoPoint{Lat: 0.004, Lng: 0.0005}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InPolygon(tt.p, u); got != tt.want {
+				t.Errorf("InPolygon = %v, want %v", got, tt.want)
+			}
+			if got := InPolygon(tt.p, reversed); got != tt.want {
+				t.Errorf("InPolygon with the corners in reverse = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if InPolygon(db.GeoPoint{}, []db.GeoPoint{{Lat: -1, Lng: -1}, {Lat: 1, Lng: 1}}) {
+		t.Error("a two-point polygon has an inside")
+	}
+}
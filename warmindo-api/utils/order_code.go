@@ -0,0 +1,25 @@
+package utils
+
+import "crypto/rand"
+
+// orderCodeAlphabet leaves out I, O, 0 and 1, which are easily misread. Its
+// 32 symbols let each random byte be mapped without modulo bias.
+const orderCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateOrderCode returns a random order code such as "K7QF-2MZX", 40 bits
+// drawn from crypto/rand. Uniqueness is left to the database.
+func GenerateOrderCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, 9)
+	for i, v := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, orderCodeAlphabet[v&31])
+	}
+	return string(code), nil
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"warmindo-api/db"
+
+	// Opening hours are read in the outlet's zone even on hosts without a
+	// zoneinfo database
+	_ "time/tzdata"
+)
+
+// storeLookaheadDays is how far ahead the next opening time is searched for
+const storeLookaheadDays = 14
+
+var dayNames = []string{"Minggu", "Senin", "Selasa", "Rabu", "Kamis", "Jumat", "Sabtu"}
+
+// DayName is the Indonesian name of a weekday
+func DayName(day time.Weekday) string {
+	return dayNames[day]
+}
+
+// ParseClock reads an "HH:MM" time of day as minutes after midnight
+func ParseClock(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// StoreLocation is the zone an outlet's opening hours are given in
+func StoreLocation(name string) *time.Location {
+	if loc, err := time.LoadLocation(name); err == nil && name != "" {
+		return loc
+	}
+	if loc, err := time.LoadLocation(db.DefaultStoreTimezone); err == nil {
+		return loc
+	}
+	return time.FixedZone("WIB", 7*60*60)
+}
+
+type openPeriod struct {
+	start, end time.Time
+}
+
+// StoreStatusAt works out whether an outlet with the given schedule is open at
+// now. The manual switch wins, then holiday closures, then the weekly hours.
+func StoreStatusAt(schedule db.StoreSchedule, now time.Time) db.StoreStatus {
+	loc := StoreLocation(schedule.Timezone)
+	now = now.In(loc)
+	status := db.StoreStatus{Now: now}
+
+	if schedule.ManualClosed {
+		status.Reason = db.StoreClosedManual
+		status.Message = schedule.ClosedMessage
+		if status.Message == "" {
+			status.Message = "Warung sedang tutup"
+		}
+		return status
+	}
+
+	hours := schedule.Hours
+	aroundTheClock := len(hours) == 0
+	if aroundTheClock {
+		for day := 0; day < 7; day++ {
+			hours = append(hours, db.OpeningHours{Weekday: day, OpenTime: "00:00", CloseTime: "00:00"})
+		}
+	}
+
+	// Periods belong to the day they start on, so yesterday's late period
+	// can still be running. A closed day drops the periods starting on it.
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	periods := []openPeriod{}
+	for offset := -1; offset <= storeLookaheadDays; offset++ {
+		day := today.AddDate(0, 0, offset)
+		if closureOn(schedule.Closures, day) != nil {
+			continue
+		}
+		for _, h := range hours {
+			if h.Weekday != int(day.Weekday()) {
+				continue
+			}
+			open, err1 := ParseClock(h.OpenTime)
+			closing, err2 := ParseClock(h.CloseTime)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			if closing <= open {
+				closing += 24 * 60
+			}
+			periods = append(periods, openPeriod{
+				start: day.Add(time.Duration(open) * time.Minute),
+				end:   day.Add(time.Duration(closing) * time.Minute),
+			})
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].start.Before(periods[j].start) })
+
+	for i, p := range periods {
+		if now.Before(p.start) || !now.Before(p.end) {
+			continue
+		}
+		// Back-to-back periods, like a shift ending at midnight and the next
+		// day's starting at midnight, count as one
+		end := p.end
+		for _, next := range periods[i+1:] {
+			if next.start.After(end) {
+				break
+			}
+			if next.end.After(end) {
+				end = next.end
+			}
+		}
+		status.Open = true
+		status.Message = "Warung buka"
+		if !aroundTheClock {
+			status.ClosesAt = &end
+		}
+		return status
+	}
+
+	status.Reason = db.StoreClosedHours
+	status.Message = "Warung sedang tutup"
+	if closure := closureOn(schedule.Closures, today); closure != nil {
+		status.Reason = db.StoreClosedHoliday
+		if closure.Reason != "" {
+			status.Message = "Warung tutup: " + closure.Reason
+		}
+	}
+	for _, p := range periods {
+		if p.start.After(now) {
+			opensAt := p.start
+			status.OpensAt = &opensAt
+			status.Message += fmt.Sprintf(", buka kembali %s %s", dayNames[opensAt.Weekday()], opensAt.Format("02/01 15:04"))
+			break
+		}
+	}
+	return status
+}
+
+// closureOn returns the closure covering day, if any
+func closureOn(closures []db.StoreClosure, day time.Time) *db.StoreClosure {
+	date := day.Format("2006-01-02")
+	for i := range closures {
+		if closures[i].StartDate <= date && date <= closures[i].EndDate {
+			return &closures[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"testing"
+	"time"
+	"warmindo-api/db"
+)
+
+func TestParseClock(t *testing.T) {
+	for in, want := range map[string]int{"00:00": 0, "08:30": 510, " 23:59 ": 1439} {
+		if got, err := ParseClock(in); err != nil || got != want {
+			t.Errorf("ParseClock(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	// Midnight closing is written 00:00, never 24:00
+	for _, in := range []string{"24:00", "12:60", "8:30", "08.30", "-1:00", ""} {
+		if got, err := ParseClock(in); err == nil {
+			t.Errorf("ParseClock(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+// A night warung: weeknights until 23:00, Friday and Saturday nights until
+// 03:00, closed on Sunday. In October 2026 the 18th is a Sunday.
+var nightHours = db.StoreSchedule{
+	Timezone: "Asia/Jakarta",
+	Hours: []db.OpeningHours{
+		{Weekday: 1, OpenTime: "17:00", CloseTime: "23:00"},
+		{Weekday: 2, OpenTime: "17:00", CloseTime: "23:00"},
+		{Weekday: 3, OpenTime: "17:00", CloseTime: "23:00"},
+		{Weekday: 4, OpenTime: "17:00", CloseTime: "23:00"},
+		{Weekday: 5, OpenTime: "17:00", CloseTime: "03:00"},
+		{Weekday: 6, OpenTime: "17:00", CloseTime: "03:00"},
+	},
+}
+
+var jakarta = StoreLocation("Asia/Jakarta")
+
+func october(day, hour, min int) time.Time {
+	return time.Date(2026, 10, day, hour, min, 0, 0, jakarta)
+}
+
+func assertOpen(t *testing.T, s db.StoreStatus, closesAt time.Time) {
+	t.Helper()
+	if !s.Open {
+		t.Fatalf("closed (%s: %s), want open", s.Reason, s.Message)
+	}
+	if s.OpensAt != nil || s.ClosesAt == nil || !s.ClosesAt.Equal(closesAt) {
+		t.Errorf("opens_at %v, closes_at %v; want closing at %v", s.OpensAt, s.ClosesAt, closesAt)
+	}
+}
+
+func assertClosed(t *testing.T, s db.StoreStatus, reason string, opensAt time.Time) {
+	t.Helper()
+	if s.Open || s.Reason != reason {
+		t.Fatalf("open = %v, reason = %q; want closed for %q", s.Open, s.Reason, reason)
+	}
+	if s.ClosesAt != nil || s.OpensAt == nil || !s.OpensAt.Equal(opensAt) {
+		t.Errorf("opens_at %v, closes_at %v; want opening at %v", s.OpensAt, s.ClosesAt, opensAt)
+	}
+}
+
+func TestStoreStatusOvernight(t *testing.T) {
+	// Friday night's period runs into Saturday morning
+	assertOpen(t, StoreStatusAt(nightHours, october(23, 23, 30)), october(24, 3, 0))
+	assertOpen(t, StoreStatusAt(nightHours, october(24, 2, 59)), october(24, 3, 0))
+	// Closing time itself is closed
+	assertClosed(t, StoreStatusAt(nightHours, october(24, 3, 0)), db.StoreClosedHours, october(24, 17, 0))
+	// Saturday night runs into Sunday, a closed day, and then stays shut
+	// until Monday evening
+	assertOpen(t, StoreStatusAt(nightHours, october(25, 1, 0)), october(25, 3, 0))
+	s := StoreStatusAt(nightHours, october(25, 12, 0))
+	assertClosed(t, s, db.StoreClosedHours, october(26, 17, 0))
+	if want := "Warung sedang tutup, buka kembali Senin 26/10 17:00"; s.Message != want {
+		t.Errorf("message = %q, want %q", s.Message, want)
+	}
+	// A weeknight doesn't run over
+	assertClosed(t, StoreStatusAt(nightHours, october(20, 0, 30)), db.StoreClosedHours, october(20, 17, 0))
+}
+
+func TestStoreStatusInOutletZone(t *testing.T) {
+	// 16:30 UTC on Friday is 23:30 in Jakarta. A server in UTC must still
+	// read the hours in the outlet's zone.
+	s := StoreStatusAt(nightHours, time.Date(2026, 10, 23, 16, 30, 0, 0, time.UTC))
+	assertOpen(t, s, october(24, 3, 0))
+	if s.Now.Location().String() != "Asia/Jakarta" {
+		t.Errorf("now is given in %s, want the outlet's zone", s.Now.Location())
+	}
+
+	// A zone that doesn't exist falls back to the default one
+	broken := nightHours
+	broken.Timezone = "Asia/Nowhere"
+	assertOpen(t, StoreStatusAt(broken, time.Date(2026, 10, 23, 16, 30, 0, 0, time.UTC)), october(24, 3, 0))
+}
+
+func TestStoreStatusMidnightJoin(t *testing.T) {
+	// A period ending at midnight and the next one starting at midnight are
+	// one stretch, so the store isn't reported closing at midnight
+	schedule := db.StoreSchedule{
+		Timezone: "Asia/Jakarta",
+		Hours: []db.OpeningHours{
+			{Weekday: 0, OpenTime: "18:00", CloseTime: "00:00"},
+			{Weekday: 1, OpenTime: "00:00", CloseTime: "03:00"},
+		},
+	}
+	assertOpen(t, StoreStatusAt(schedule, october(18, 23, 0)), october(19, 3, 0))
+	assertOpen(t, StoreStatusAt(schedule, october(19, 0, 0)), october(19, 3, 0))
+}
+
+func TestStoreStatusHolidays(t *testing.T) {
+	schedule := nightHours
+	schedule.Closures = []db.StoreClosure{{StartDate: "2026-10-23", EndDate: "2026-10-23", Reason: "Libur nasional"}}
+
+	// Thursday's period isn't cut short by Friday's closure
+	assertOpen(t, StoreStatusAt(schedule, october(22, 22, 0)), october(22, 23, 0))
+
+	// Friday's period doesn't start, so it doesn't run into Saturday either
+	s := StoreStatusAt(schedule, october(23, 20, 0))
+	assertClosed(t, s, db.StoreClosedHoliday, october(24, 17, 0))
+	if want := "Warung tutup: Libur nasional, buka kembali Sabtu 24/10 17:00"; s.Message != want {
+		t.Errorf("message = %q, want %q", s.Message, want)
+	}
+	assertClosed(t, StoreStatusAt(schedule, october(24, 1, 0)), db.StoreClosedHours, october(24, 17, 0))
+
+	// Saturday night is back to normal
+	assertOpen(t, StoreStatusAt(schedule, october(24, 18, 0)), october(25, 3, 0))
+}
+
+func TestStoreStatusManualClose(t *testing.T) {
+	schedule := nightHours
+	schedule.ManualClosed = true
+	s := StoreStatusAt(schedule, october(23, 20, 0))
+	if s.Open || s.Reason != db.StoreClosedManual || s.OpensAt != nil || s.Message != "Warung sedang tutup" {
+		t.Errorf("closed by hand = %+v", s)
+	}
+
+	// Staff can say why
+	schedule.ClosedMessage = "Tutup sementara, gas habis"
+	if s := StoreStatusAt(schedule, october(23, 20, 0)); s.Message != schedule.ClosedMessage {
+		t.Errorf("message = %q, want %q", s.Message, schedule.ClosedMessage)
+	}
+}
+
+func TestStoreStatusWithoutHours(t *testing.T) {
+	// An outlet that hasn't set any hours is open around the clock, with no
+	// closing time, except on its closures
+	schedule := db.StoreSchedule{Timezone: "Asia/Jakarta"}
+	if s := StoreStatusAt(schedule, october(20, 4, 0)); !s.Open || s.ClosesAt != nil {
+		t.Errorf("without hours = %+v, want open around the clock", s)
+	}
+
+	schedule.Closures = []db.StoreClosure{{StartDate: "2026-10-20", EndDate: "2026-10-21"}}
+	s := StoreStatusAt(schedule, october(20, 4, 0))
+	assertClosed(t, s, db.StoreClosedHoliday, october(22, 0, 0))
+	if want := "Warung sedang tutup, buka kembali Kamis 22/10 00:00"; s.Message != want {
+		t.Errorf("message = %q, want %q", s.Message, want)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// signed signs payload the way SignTableToken does, to make tokens it never
+// would
+func signed(payload string) string {
+	return payload + "." + tableTokenSignature(payload)
+}
+
+func TestVerifyTableToken(t *testing.T) {
+	t.Setenv("TABLE_TOKEN_KEY", "")
+	t.Setenv("JWT_KEY", "test-key")
+
+	token := SignTableToken(12)
+	if n, err := VerifyTableToken(token); err != nil || n != 12 {
+		t.Fatalf("VerifyTableToken(%q) = %d, %v; want 12", token, n, err)
+	}
+	// Scanner apps and copy-paste add whitespace around the token
+	if n, err := VerifyTableToken(" " + token + "\n"); err != nil || n != 12 {
+		t.Errorf("token with surrounding whitespace = %d, %v; want 12", n, err)
+	}
+
+	for name, token := range map[string]string{
+		"another table":       strings.Replace(token, "12", "13", 1),
+		"truncated signature": token[:len(token)-1],
+		"no signature":        "v2:12",
+		"empty signature":     "v2:12.",
+		"empty":               "",
+		// Codes printed before outlets existed carry a bare table number,
+		// which would otherwise be read as an id
+		"bare table number": signed("12"),
+		"signed zero":       signed("v2:0"),
+		"signed negative":   signed("v2:-1"),
+		"signed text":       signed("v2:meja"),
+	} {
+		if n, err := VerifyTableToken(token); err != ErrInvalidTableToken {
+			t.Errorf("%s: VerifyTableToken(%q) = %d, %v; want ErrInvalidTableToken", name, token, n, err)
+		}
+	}
+}
+
+func TestTableTokenKeyRotation(t *testing.T) {
+	t.Setenv("TABLE_TOKEN_KEY", "")
+	t.Setenv("JWT_KEY", "test-key")
+	printed := SignTableToken(5)
+
+	// Setting TABLE_TOKEN_KEY retires every printed code...
+	t.Setenv("TABLE_TOKEN_KEY", "rotated")
+	if _, err := VerifyTableToken(printed); err != ErrInvalidTableToken {
+		t.Fatalf("code printed before the rotation still verifies: %v", err)
+	}
+	reprinted := SignTableToken(5)
+
+	// ...and from then on, rotating the login key leaves the codes alone
+	t.Setenv("JWT_KEY", "new-login-key")
+	if n, err := VerifyTableToken(reprinted); err != nil || n != 5 {
+		t.Fatalf("code printed after the rotation = %d, %v; want 5", n, err)
+	}
+}
@@ -39,3 +39,8 @@ func ComparePassword(hash, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// ValidatePIN checks that a POS PIN is 4 to 6 digits
+func ValidatePIN(pin string) bool {
+	return regexp.MustCompile(`^[0-9]{4,6}$`).MatchString(pin)
+}